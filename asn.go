@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// asnLookupTimeout bounds every Team Cymru DNS query.
+const asnLookupTimeout = 5 * time.Second
+
+// ************************************************************************************************
+// asnSource implements -asn: the public addresses of the hosts are annotated with their
+// autonomous system, from a MaxMind DB ASN database (GeoLite2-ASN.mmdb) or, with "cymru", from the
+// Team Cymru IP to ASN DNS service.
+type asnSource struct {
+	// db is the ASN database, nil for DNS lookups.
+	db *mmdbReader
+
+	// names caches the AS names resolved over DNS, by AS number.
+	names map[int]string
+}
+
+// ************************************************************************************************
+// openASN loads the -asn source: "cymru" or the path of a MaxMind DB ASN database.
+func openASN(source string) (*asnSource, error) {
+	if strings.EqualFold(source, "cymru") {
+		return &asnSource{names: make(map[int]string)}, nil
+	}
+	db, err := openMMDB(source)
+	if err != nil {
+		return nil, err
+	}
+	return &asnSource{db: db}, nil
+}
+
+// Enrich implements hostEnricher. Private, loopback and link-local addresses are not looked up.
+func (s *asnSource) Enrich(h *Host) {
+	if h.ASN != nil {
+		return
+	}
+	ip, ok := publicAddr(h)
+	if !ok {
+		return
+	}
+	var info *ASNInfo
+	var err error
+	if s.db != nil {
+		info, err = s.lookupDB(ip)
+	} else {
+		info, err = s.lookupCymru(ip)
+	}
+	if err != nil {
+		slog.Debug("ASN lookup failed", "addr", ip, "err", err)
+		return
+	}
+	h.ASN = info
+}
+
+// lookupDB finds the AS of ip in the MaxMind DB database. The announced prefix is the network of
+// the database record.
+func (s *asnSource) lookupDB(ip netip.Addr) (*ASNInfo, error) {
+	rec, bits, err := s.db.lookup(ip)
+	if err != nil || rec == nil {
+		return nil, err
+	}
+	info := &ASNInfo{Number: int(mmdbUint(mmdbPath(rec, "autonomous_system_number")))}
+	info.Name, _ = mmdbPath(rec, "autonomous_system_organization").(string)
+	if p, err := ip.Prefix(bits); err == nil {
+		info.Prefix = p.String()
+	}
+	if info.Number == 0 {
+		return nil, nil
+	}
+	return info, nil
+}
+
+// lookupCymru queries the origin of ip ("15169 | 8.8.8.0/24 | US | arin | 2000-03-30") and the
+// name of its AS ("15169 | US | arin | 2000-03-30 | GOOGLE, US") from the Team Cymru DNS zones.
+func (s *asnSource) lookupCymru(ip netip.Addr) (*ASNInfo, error) {
+	fields, err := cymruTXT(cymruOriginName(ip))
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("unexpected origin record %q", strings.Join(fields, "|"))
+	}
+	// Addresses announced by several ASes list them all, space-separated, in the first field.
+	number, err := strconv.Atoi(strings.Fields(fields[0])[0])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected origin AS %q", fields[0])
+	}
+	info := &ASNInfo{Number: number, Prefix: fields[1]}
+	name, ok := s.names[number]
+	if !ok {
+		if fields, err := cymruTXT(fmt.Sprintf("AS%d.asn.cymru.com", number)); err == nil && len(fields) >= 5 {
+			name = fields[4]
+		}
+		s.names[number] = name
+	}
+	info.Name = name
+	return info, nil
+}
+
+// cymruOriginName returns the Team Cymru origin query name of ip: its reversed octets under
+// origin.asn.cymru.com, or its reversed nibbles under origin6.asn.cymru.com.
+func cymruOriginName(ip netip.Addr) string {
+	var labels []string
+	if ip.Is4() {
+		for _, b := range ip.As4() {
+			labels = append([]string{strconv.Itoa(int(b))}, labels...)
+		}
+		return strings.Join(labels, ".") + ".origin.asn.cymru.com"
+	}
+	for _, b := range ip.As16() {
+		labels = append([]string{strconv.FormatInt(int64(b&0xf), 16), strconv.FormatInt(int64(b>>4), 16)}, labels...)
+	}
+	return strings.Join(labels, ".") + ".origin6.asn.cymru.com"
+}
+
+// cymruTXT resolves a Team Cymru TXT record and returns its trimmed "|"-separated fields.
+func cymruTXT(name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), asnLookupTimeout)
+	defer cancel()
+	txt, err := net.DefaultResolver.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(txt) == 0 {
+		return nil, fmt.Errorf("no TXT record for %s", name)
+	}
+	fields := strings.Split(txt[0], "|")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields, nil
+}
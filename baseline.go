@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Statuses of the baseline mode rows.
+const (
+	baselineUnapproved  = "unapproved"
+	baselineMissing     = "missing"
+	baselineHostMissing = "host missing"
+)
+
+// ************************************************************************************************
+// baselineEntry is an approved host:port pair of a -baseline file. Host is an address or a
+// hostname; an empty protocol approves the port whatever its protocol.
+type baselineEntry struct {
+	Host     string
+	Port     int
+	Protocol string
+	Note     string
+
+	// seen is set when the pair is open in the scan.
+	seen bool
+}
+
+// matches reports whether the entry approves port p of the host with the given address and names.
+func (e *baselineEntry) matches(ip string, names []string, p *Port) bool {
+	if e.Port != p.PortID || (e.Protocol != "" && e.Protocol != p.Protocol) {
+		return false
+	}
+	return e.matchesHost(ip, names)
+}
+
+// matchesHost reports whether the entry designates the host with the given address and names.
+func (e *baselineEntry) matchesHost(ip string, names []string) bool {
+	if e.Host == ip {
+		return true
+	}
+	for _, n := range names {
+		if strings.EqualFold(e.Host, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// ************************************************************************************************
+// loadBaselinePairs reads a -baseline file of approved host:port pairs. A .json file holds an array of
+// "host:port" strings or of {"host", "port", "note"} objects; any other file is CSV, either with a
+// host:port column or with host and port columns, an optional note column and an optional header.
+// Ports are "443" (any protocol) or "443/tcp".
+func loadBaselinePairs(path string) ([]*baselineEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []*baselineEntry
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		entries, err = parseBaselineJSON(f)
+	} else {
+		entries, err = parseBaselineCSV(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// parseBaselineJSON parses a JSON baseline.
+func parseBaselineJSON(r io.Reader) ([]*baselineEntry, error) {
+	var items []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, err
+	}
+	var entries []*baselineEntry
+	for i, raw := range items {
+		var pair string
+		if json.Unmarshal(raw, &pair) == nil {
+			e, err := parseBaselinePair(pair)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %w", i+1, err)
+			}
+			entries = append(entries, e)
+			continue
+		}
+		var obj struct {
+			Host string          `json:"host"`
+			Port json.RawMessage `json:"port"`
+			Note string          `json:"note"`
+		}
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("entry %d: expected a \"host:port\" string or a host, port object", i+1)
+		}
+		e, err := newBaselineEntry(obj.Host, strings.Trim(string(obj.Port), `"`), obj.Note)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseBaselineCSV parses a CSV baseline.
+func parseBaselineCSV(r io.Reader) ([]*baselineEntry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+	var entries []*baselineEntry
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := range rec {
+			rec[i] = strings.TrimSpace(rec[i])
+		}
+		if len(rec) == 0 || rec[0] == "" {
+			continue
+		}
+		// A host:port column (a bare IPv6 address is not one), or host and port columns, then
+		// the note.
+		e, err := parseBaselinePair(rec[0])
+		switch {
+		case err == nil && len(rec) >= 2:
+			e.Note = rec[1]
+		case err != nil && len(rec) >= 2:
+			note := ""
+			if len(rec) >= 3 {
+				note = rec[2]
+			}
+			e, err = newBaselineEntry(rec[0], rec[1], note)
+		}
+		if err != nil {
+			// The first line may be a header.
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseBaselinePair parses a "host:port" pair, the host of an IPv6 pair being bracketed
+// ("[2001:db8::1]:443").
+func parseBaselinePair(pair string) (*baselineEntry, error) {
+	port := ""
+	if i := strings.Index(pair, "/"); i >= 0 {
+		pair, port = pair[:i], pair[i:]
+	}
+	host, num, err := net.SplitHostPort(pair)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pair %q, expected host:port", pair+port)
+	}
+	return newBaselineEntry(host, num+port, "")
+}
+
+// newBaselineEntry validates an approved pair.
+func newBaselineEntry(host, port, note string) (*baselineEntry, error) {
+	if host == "" {
+		return nil, fmt.Errorf("missing host")
+	}
+	num, proto, _ := strings.Cut(port, "/")
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 0 || n > 65535 {
+		return nil, fmt.Errorf("invalid port %q, expected 443 or 443/tcp", port)
+	}
+	return &baselineEntry{Host: host, Port: n, Protocol: strings.ToLower(proto), Note: note}, nil
+}
+
+// ************************************************************************************************
+// baselineAggregator implements the baseline mode (-baseline approved.csv): the open ports of the
+// up hosts are compared with a list of approved host:port pairs. Open ports not approved are
+// reported as unapproved, approved pairs not open in the scan as missing (or host missing, when
+// the host itself was not found).
+type baselineAggregator struct {
+	entries    []*baselineEntry
+	unapproved []BaselineInfo
+	hosts      []scannedHost
+}
+
+// scannedHost is the address and names of a host of the scan, to find the missing pairs.
+type scannedHost struct {
+	ip    string
+	names []string
+}
+
+// newBaselineAggregator creates a baseline mode aggregator comparing the inputs to entries.
+func newBaselineAggregator(entries []*baselineEntry) *baselineAggregator {
+	// Every run starts from unmatched entries, as -watch and -serve reuse them.
+	copies := make([]*baselineEntry, len(entries))
+	for i, e := range entries {
+		c := *e
+		c.seen = false
+		copies[i] = &c
+	}
+	return &baselineAggregator{entries: copies}
+}
+
+// Add implements Aggregator.
+func (a *baselineAggregator) Add(h *Host) {
+	if !h.IsUp() {
+		return
+	}
+	ip := h.IP()
+	var names []string
+	for _, n := range h.Hostnames {
+		names = append(names, n.Name)
+	}
+	a.hosts = append(a.hosts, scannedHost{ip: ip, names: names})
+	hostname := ""
+	if len(names) > 0 {
+		hostname = names[0]
+	}
+	for i := range h.Ports {
+		p := &h.Ports[i]
+		if p.State.State != "open" {
+			continue
+		}
+		approved := false
+		for _, e := range a.entries {
+			if e.matches(ip, names, p) {
+				e.seen, approved = true, true
+			}
+		}
+		if !approved {
+			a.unapproved = append(a.unapproved, BaselineInfo{
+				Status:   baselineUnapproved,
+				IP:       ip,
+				Hostname: hostname,
+				Port:     fmt.Sprintf("%d/%s", p.PortID, p.Protocol),
+				Service:  p.Service.Name,
+			})
+		}
+	}
+}
+
+// Report implements Aggregator. The unapproved ports come first, then the missing pairs, each
+// sorted by address and port.
+func (a *baselineAggregator) Report() *Report {
+	rows := append([]BaselineInfo(nil), a.unapproved...)
+	for _, e := range a.entries {
+		if e.seen {
+			continue
+		}
+		port := strconv.Itoa(e.Port)
+		if e.Protocol != "" {
+			port += "/" + e.Protocol
+		}
+		info := BaselineInfo{Status: baselineHostMissing, IP: e.Host, Port: port, Note: e.Note}
+		if net.ParseIP(e.Host) == nil {
+			info.IP, info.Hostname = "", e.Host
+		}
+		for _, h := range a.hosts {
+			if e.matchesHost(h.ip, h.names) {
+				info.Status, info.IP = baselineMissing, h.ip
+				if len(h.names) > 0 {
+					info.Hostname = h.names[0]
+				}
+				break
+			}
+		}
+		rows = append(rows, info)
+	}
+	order := map[string]int{baselineUnapproved: 0, baselineMissing: 1, baselineHostMissing: 2}
+	sort.SliceStable(rows, func(i, j int) bool {
+		ri, rj := rows[i], rows[j]
+		if ri.Status != rj.Status {
+			return order[ri.Status] < order[rj.Status]
+		}
+		if ri.IP != rj.IP {
+			return compareAddrs(ri.IP, rj.IP)
+		}
+		if ri.Hostname != rj.Hostname {
+			return ri.Hostname < rj.Hostname
+		}
+		return comparePorts(ri.Port, rj.Port)
+	})
+
+	report := &Report{Headers: []string{"Status", "IP", "Hostname", "Port/Proto", "Service", "Note"}, Records: rows}
+	for _, r := range rows {
+		report.Rows = append(report.Rows, []string{r.Status, r.IP, r.Hostname, r.Port, r.Service, r.Note})
+	}
+	return report
+}
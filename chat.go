@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// chatTopServices is the number of services listed by the chat summary.
+const chatTopServices = 5
+
+// ************************************************************************************************
+// chatSink implements -chat-webhook: once the inputs are read, a short summary (hosts up, open
+// ports, ports new since the -diff scan, top services) is posted to a Slack or Microsoft Teams
+// incoming webhook, so the team sees the results without opening the reports.
+type chatSink struct {
+	endpoint string
+	redacted string
+	format   string
+	client   *http.Client
+
+	sources  []string
+	up, open int
+	services map[string]int
+	diff     *diffAggregator
+	base     string
+}
+
+// chatFact is a line of the summary.
+type chatFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// ************************************************************************************************
+// newChatSink creates the sink posting to rawURL in format ("slack", "teams", or "auto" to guess
+// from the URL). When base is not nil, the ports opened since that scan, named by baseName, are
+// counted.
+func newChatSink(rawURL, format string, base scanSnapshot, baseName string) (*chatSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q, expected https://hooks.slack.com/services/...", rawURL)
+	}
+	switch format = strings.ToLower(format); format {
+	case "", "auto":
+		format = "slack"
+		if host := strings.ToLower(u.Hostname()); strings.HasSuffix(host, ".office.com") || strings.HasSuffix(host, ".azure.com") {
+			format = "teams"
+		}
+	case "slack", "teams":
+	default:
+		return nil, fmt.Errorf("unknown -chat-format %q, expected auto, slack or teams", format)
+	}
+	s := &chatSink{
+		endpoint: u.String(),
+		redacted: u.Redacted(),
+		format:   format,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		services: make(map[string]int),
+		base:     baseName,
+	}
+	if base != nil {
+		s.diff = newDiffAggregator(base)
+	}
+	return s, nil
+}
+
+// StartScan implements ScanStarter.
+func (s *chatSink) StartScan(source string) {
+	s.sources = append(s.sources, source)
+}
+
+// Add implements HostConsumer.
+func (s *chatSink) Add(h *Host) {
+	if !h.IsUp() {
+		return
+	}
+	s.up++
+	for _, p := range h.Ports {
+		if p.State.State == "open" {
+			s.open++
+			if p.Service.Name != "" {
+				s.services[p.Service.Name]++
+			}
+		}
+	}
+	if s.diff != nil {
+		s.diff.Add(h)
+	}
+}
+
+// Close implements hostSink: the summary is posted.
+func (s *chatSink) Close() error {
+	title, facts := s.summary()
+	var payload any
+	if s.format == "teams" {
+		payload = teamsCard(title, facts)
+	} else {
+		payload = slackMessage(title, facts)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	slog.Info("Summary posted", "url", s.redacted, "format", s.format)
+	return nil
+}
+
+// summary returns the title and the lines of the message.
+func (s *chatSink) summary() (string, []chatFact) {
+	title := "nmap2csv scan summary"
+	switch len(s.sources) {
+	case 0:
+	case 1:
+		title += ": " + filepath.Base(s.sources[0])
+	default:
+		title += fmt.Sprintf(": %s and %d more", filepath.Base(s.sources[0]), len(s.sources)-1)
+	}
+	facts := []chatFact{
+		{"Hosts up", fmt.Sprint(s.up)},
+		{"Open ports", fmt.Sprint(s.open)},
+	}
+	if s.diff != nil {
+		hosts, ports := map[string]bool{}, 0
+		for _, c := range s.diff.Report().Records.([]DiffInfo) {
+			switch c.Change {
+			case changeNewHost:
+				hosts[c.IP] = true
+				if c.Port != "" {
+					ports++
+				}
+			case changePortOpened:
+				ports++
+			}
+		}
+		facts = append(facts,
+			chatFact{"New hosts", fmt.Sprintf("%d (since %s)", len(hosts), s.base)},
+			chatFact{"New ports", fmt.Sprintf("%d (since %s)", ports, s.base)})
+	}
+	names := make([]string, 0, len(s.services))
+	for name := range s.services {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if s.services[names[i]] != s.services[names[j]] {
+			return s.services[names[i]] > s.services[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	var top []string
+	for _, name := range names[:min(len(names), chatTopServices)] {
+		top = append(top, fmt.Sprintf("%s (%d)", name, s.services[name]))
+	}
+	if len(top) > 0 {
+		facts = append(facts, chatFact{"Top services", strings.Join(top, ", ")})
+	}
+	return title, facts
+}
+
+// ************************************************************************************************
+// slackMessage renders the summary as a Slack message.
+func slackMessage(title string, facts []chatFact) any {
+	lines := []string{"*" + slackEscaper.Replace(title) + "*"}
+	for _, f := range facts {
+		lines = append(lines, fmt.Sprintf("• %s: %s", f.Title, slackEscaper.Replace(f.Value)))
+	}
+	return map[string]string{"text": strings.Join(lines, "\n")}
+}
+
+// slackEscaper escapes the characters Slack interprets as markup.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// teamsCard renders the summary as an Adaptive Card message, accepted by the Teams workflow and
+// connector webhooks.
+func teamsCard(title string, facts []chatFact) any {
+	return map[string]any{
+		"type": "message",
+		"attachments": []any{map[string]any{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body": []any{
+					map[string]any{"type": "TextBlock", "text": title, "weight": "Bolder", "size": "Medium", "wrap": true},
+					map[string]any{"type": "FactSet", "facts": facts},
+				},
+			},
+		}},
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/1mm0rt41PC/nmap2csv/pkg/nmapparse"
+)
+
+// Nagios plugin states, which are also the exit codes of -check.
+const (
+	checkOK       = 0
+	checkWarning  = 1
+	checkCritical = 2
+	checkUnknown  = 3
+)
+
+// checkStates names the plugin states in the status line.
+var checkStates = [...]string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// ************************************************************************************************
+// portChecker implements -check: the open ports of the up hosts are compared with the expected
+// ports. An open port that is not expected is CRITICAL (an unwanted exposure), an expected port
+// that is not open on a host is a WARNING (a service down); the ranges and service names of
+// the list only allow ports, as they cannot be missing.
+type portChecker struct {
+	expected PortSpec
+	required []int
+
+	up, open   int
+	unexpected []string
+	missing    []string
+}
+
+// ************************************************************************************************
+// newPortChecker creates a checker of the expected ports, in the -whereport syntax.
+func newPortChecker(expected string) *portChecker {
+	c := &portChecker{expected: nmapparse.ParsePortSpec(expected)}
+	for port := range c.expected.Ports {
+		c.required = append(c.required, port)
+	}
+	sort.Ints(c.required)
+	return c
+}
+
+// Add implements HostConsumer.
+func (c *portChecker) Add(h *Host) {
+	if !h.IsUp() {
+		return
+	}
+	c.up++
+	ip := h.IP()
+	open := make(map[int]bool)
+	for i := range h.Ports {
+		p := &h.Ports[i]
+		if p.State.State != "open" {
+			continue
+		}
+		c.open++
+		open[p.PortID] = true
+		if !c.expected.Match(p) {
+			finding := fmt.Sprintf("%s:%d/%s", ip, p.PortID, p.Protocol)
+			if p.Service.Name != "" {
+				finding += " (" + p.Service.Name + ")"
+			}
+			c.unexpected = append(c.unexpected, finding)
+		}
+	}
+	for _, port := range c.required {
+		if !open[port] {
+			c.missing = append(c.missing, ip+":"+strconv.Itoa(port))
+		}
+	}
+}
+
+// Result returns the plugin state and output: a status line with the performance data, followed by
+// one line per finding.
+func (c *portChecker) Result() (int, string) {
+	state := checkOK
+	summary := fmt.Sprintf("%d open port(s) on %d host(s) up match the expected ports", c.open, c.up)
+	var problems []string
+	if len(c.unexpected) > 0 {
+		problems = append(problems, fmt.Sprintf("%d unexpected open port(s)", len(c.unexpected)))
+	}
+	if len(c.missing) > 0 {
+		problems = append(problems, fmt.Sprintf("%d expected port(s) not open", len(c.missing)))
+	}
+	switch {
+	case c.up == 0:
+		state, summary = checkUnknown, "no host up in the scan"
+	case len(c.unexpected) > 0:
+		state = checkCritical
+	case len(c.missing) > 0:
+		state = checkWarning
+	}
+	if len(problems) > 0 && c.up > 0 {
+		summary = strings.Join(problems, ", ") + fmt.Sprintf(" on %d host(s) up", c.up)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "NMAP %s - %s | hosts_up=%d;;;0 open_ports=%d;;;0 unexpected_ports=%d;;0;0 missing_ports=%d;0;;0\n",
+		checkStates[state], summary, c.up, c.open, len(c.unexpected), len(c.missing))
+	for _, f := range c.unexpected {
+		fmt.Fprintf(&b, "unexpected: %s\n", f)
+	}
+	for _, f := range c.missing {
+		fmt.Fprintf(&b, "not open: %s\n", f)
+	}
+	return state, b.String()
+}
+
+// ************************************************************************************************
+// runCheck runs -check over the inputs given by patterns, prints the plugin output and returns the
+// exit code. Unreadable inputs are UNKNOWN rather than fatal, as a plain failure exit code (1)
+// would be reported as a WARNING by the monitoring system.
+func (o *Options) runCheck(patterns []string) int {
+	files, err := expandInputs(patterns)
+	if err != nil {
+		fmt.Fprintf(o.out(), "NMAP UNKNOWN - %v\n", err)
+		return checkUnknown
+	}
+	c := newPortChecker(o.Check)
+	if failed, _ := o.streamInputs(files, true, c); failed > 0 {
+		fmt.Fprintf(o.out(), "NMAP UNKNOWN - %d of %d scan(s) could not be read\n", failed, len(files))
+		return checkUnknown
+	}
+	state, output := c.Result()
+	fmt.Fprint(o.out(), output)
+	return state
+}
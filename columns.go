@@ -0,0 +1,486 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/1mm0rt41PC/nmap2csv/pkg/nmapparse"
+)
+
+// ************************************************************************************************
+// hostColumn is an optional column of the hostname mode, added with -columns.
+type hostColumn struct {
+	// Name identifies the column in -columns and is its key in structured outputs.
+	Name string
+
+	// Header is the column title in tabular outputs.
+	Header string
+
+	// value extracts the cell of the column from a host.
+	value func(h *Host) string
+}
+
+// hostColumns lists the optional hostname mode columns, in the order they are documented.
+var hostColumns = []hostColumn{
+	{
+		Name:   "os",
+		Header: "OS",
+		value: func(h *Host) string {
+			if m := h.BestOSMatch(); m != nil {
+				return m.Name
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "os-accuracy",
+		Header: "OSAccuracy",
+		value: func(h *Host) string {
+			if m := h.BestOSMatch(); m != nil {
+				return strconv.Itoa(m.Accuracy)
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "os-cpe",
+		Header: "OSCPE",
+		value: func(h *Host) string {
+			if m := h.BestOSMatch(); m != nil {
+				return strings.Join(m.CPEs(), " ")
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "status",
+		Header: "Status",
+		value: func(h *Host) string {
+			if h.Status != nil {
+				return h.Status.State
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "status-reason",
+		Header: "StatusReason",
+		value: func(h *Host) string {
+			if h.Status != nil {
+				return h.Status.Reason
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "start-time",
+		Header: "StartTime",
+		value:  func(h *Host) string { return formatUnix(h.StartTime) },
+	},
+	{
+		Name:   "end-time",
+		Header: "EndTime",
+		value:  func(h *Host) string { return formatUnix(h.EndTime) },
+	},
+	{
+		Name:   "scan-start",
+		Header: "ScanStart",
+		value:  func(h *Host) string { return formatUnix(h.ScanStart) },
+	},
+	{
+		Name:   "distance",
+		Header: "Distance",
+		value:  hostDistance,
+	},
+	{
+		Name:   "srtt",
+		Header: "SRTT",
+		value: func(h *Host) string {
+			if h.Times != nil {
+				return formatMicros(h.Times.SRTT)
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "rttvar",
+		Header: "RTTVar",
+		value: func(h *Host) string {
+			if h.Times != nil {
+				return formatMicros(h.Times.RTTVar)
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "port-summary",
+		Header: "PortSummary",
+		value:  portSummary,
+	},
+	{
+		Name:   "closed",
+		Header: "Closed",
+		value:  func(h *Host) string { return strconv.Itoa(h.PortCounts()["closed"]) },
+	},
+	{
+		Name:   "filtered",
+		Header: "Filtered",
+		value:  func(h *Host) string { return strconv.Itoa(h.PortCounts()["filtered"]) },
+	},
+	{
+		Name:   "os-family",
+		Header: "OSFamily",
+		value:  osFamily,
+	},
+	{
+		Name:   "device-type",
+		Header: "DeviceType",
+		value:  func(h *Host) string { return h.DeviceType },
+	},
+	{
+		Name:   "risk",
+		Header: "Risk",
+		value: func(h *Host) string {
+			if h.Risk != nil {
+				return strconv.Itoa(h.Risk.Score)
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "risk-factors",
+		Header: "RiskFactors",
+		value:  riskFactors,
+	},
+	{
+		Name:   "country",
+		Header: "Country",
+		value: func(h *Host) string {
+			if h.Geo != nil {
+				return h.Geo.Country
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "city",
+		Header: "City",
+		value: func(h *Host) string {
+			if h.Geo != nil {
+				return h.Geo.City
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "coordinates",
+		Header: "Coordinates",
+		value: func(h *Host) string {
+			if h.Geo != nil {
+				return h.Geo.Coordinates
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "asn",
+		Header: "ASN",
+		value: func(h *Host) string {
+			if h.ASN != nil {
+				return strconv.Itoa(h.ASN.Number)
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "as-name",
+		Header: "ASName",
+		value: func(h *Host) string {
+			if h.ASN != nil {
+				return h.ASN.Name
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "as-prefix",
+		Header: "ASPrefix",
+		value: func(h *Host) string {
+			if h.ASN != nil {
+				return h.ASN.Prefix
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "exposure-ports",
+		Header: "ExposurePorts",
+		value: func(h *Host) string {
+			if h.Exposure != nil {
+				return joinInts(h.Exposure.Ports, ",")
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "exposure-only",
+		Header: "ExposureOnly",
+		value: func(h *Host) string {
+			if h.Exposure != nil {
+				return joinInts(exposureOnly(h), ",")
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "exposure-tags",
+		Header: "ExposureTags",
+		value: func(h *Host) string {
+			if h.Exposure != nil {
+				return strings.Join(h.Exposure.Tags, ",")
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "exposure-seen",
+		Header: "ExposureLastSeen",
+		value: func(h *Host) string {
+			if h.Exposure != nil {
+				return h.Exposure.LastSeen
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "owner",
+		Header: "Owner",
+		value: func(h *Host) string {
+			if h.Owner != nil {
+				return h.Owner.Org
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "netname",
+		Header: "NetName",
+		value: func(h *Host) string {
+			if h.Owner != nil {
+				return h.Owner.NetName
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "netrange",
+		Header: "NetRange",
+		value: func(h *Host) string {
+			if h.Owner != nil {
+				return h.Owner.Range
+			}
+			return ""
+		},
+	},
+}
+
+// ************************************************************************************************
+// portColumn is an optional column of the long format mode, added with -port-columns.
+type portColumn struct {
+	// Name identifies the column in -port-columns and is its key in structured outputs.
+	Name string
+
+	// Header is the column title in tabular outputs.
+	Header string
+
+	// value extracts the cell of the column from a port.
+	value func(p *Port) string
+}
+
+// portColumns lists the optional long format mode columns, in the order they are documented.
+var portColumns = []portColumn{
+	{
+		Name:   "reason",
+		Header: "Reason",
+		value:  func(p *Port) string { return p.State.Reason },
+	},
+	{
+		Name:   "reason-ttl",
+		Header: "ReasonTTL",
+		value: func(p *Port) string {
+			if p.State.ReasonTTL > 0 {
+				return strconv.Itoa(p.State.ReasonTTL)
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "ssl",
+		Header: "SSL",
+		value: func(p *Port) string {
+			if p.TLS() {
+				return "yes"
+			}
+			return ""
+		},
+	},
+	{
+		Name:   "servicefp",
+		Header: "ServiceFP",
+		value:  func(p *Port) string { return flattenFingerprint(p.Service.Fingerprint) },
+	},
+	{
+		Name:   "banner",
+		Header: "Banner",
+		value:  func(p *Port) string { return p.ScriptOutput("banner") },
+	},
+	{
+		Name:   "http-title",
+		Header: "HTTPTitle",
+		value:  func(p *Port) string { return p.HTTPTitle() },
+	},
+	{
+		Name:   "method",
+		Header: "Method",
+		value:  func(p *Port) string { return p.Service.Method },
+	},
+	{
+		Name:   "conf",
+		Header: "Conf",
+		value: func(p *Port) string {
+			if p.Service.Conf > 0 {
+				return strconv.Itoa(p.Service.Conf)
+			}
+			return ""
+		},
+	},
+}
+
+// statusColumns are the hostname mode columns added by -include-down when -columns does not list any
+// of them.
+var statusColumns = []string{"status", "status-reason"}
+
+// geoColumns are the hostname mode columns added by -geoip when -columns does not list any of them.
+var geoColumns = []string{"country", "city", "coordinates"}
+
+// asnColumns are the hostname mode columns added by -asn when -columns does not list any of them.
+var asnColumns = []string{"asn", "as-name", "as-prefix"}
+
+// riskColumns are the hostname mode columns added by -risk when -columns does not list any of them.
+var riskColumns = []string{"risk", "risk-factors"}
+
+// ownerColumns are the hostname mode columns added by -rdap when -columns does not list any of them.
+var ownerColumns = []string{"owner", "netname", "netrange"}
+
+// exposureColumns are the hostname mode columns added by -exposure when -columns does not list any
+// of them.
+var exposureColumns = []string{"exposure-ports", "exposure-only", "exposure-tags", "exposure-seen"}
+
+// ************************************************************************************************
+// portSummary renders the number of ports of a host in every state, listed or only counted by Nmap,
+// e.g. "3 open, 997 filtered".
+func portSummary(h *Host) string {
+	counts := h.PortCounts()
+	var parts []string
+	for _, state := range nmapparse.KnownStates {
+		if n := counts[state]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, state))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ************************************************************************************************
+// hostDistance renders the network distance of a host in hops, "" when unknown.
+func hostDistance(h *Host) string {
+	if n := h.Hops(); n > 0 {
+		return strconv.Itoa(n)
+	}
+	return ""
+}
+
+// ************************************************************************************************
+// formatMicros renders a duration given in microseconds as milliseconds, e.g. "0.512".
+func formatMicros(us int) string {
+	return strconv.FormatFloat(float64(us)/1000, 'f', -1, 64)
+}
+
+// ************************************************************************************************
+// joinInts renders a list of numbers separated by sep.
+func joinInts(values []int, sep string) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, sep)
+}
+
+// ************************************************************************************************
+// parseColumns resolves a comma-separated -columns list against hostColumns, keeping the order
+// given by the user.
+func parseColumns(spec string) ([]hostColumn, error) {
+	var columns []hostColumn
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, c := range hostColumns {
+			if c.Name == name {
+				columns = append(columns, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q in -columns, expected one of: %s", name, columnNames())
+		}
+	}
+	return columns, nil
+}
+
+// ************************************************************************************************
+// parsePortColumns resolves a comma-separated -port-columns list against portColumns, keeping the
+// order given by the user.
+func parsePortColumns(spec string) ([]portColumn, error) {
+	var columns []portColumn
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		i := slices.IndexFunc(portColumns, func(c portColumn) bool { return c.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown column %q in -port-columns, expected one of: %s", name, portColumnNames())
+		}
+		columns = append(columns, portColumns[i])
+	}
+	return columns, nil
+}
+
+// ************************************************************************************************
+// columnNames returns the sorted names of the optional columns, for help and error messages.
+func columnNames() string {
+	names := make([]string, len(hostColumns))
+	for i, c := range hostColumns {
+		names[i] = c.Name
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// ************************************************************************************************
+// portColumnNames returns the sorted names of the optional long format mode columns, for help and
+// error messages.
+func portColumnNames() string {
+	names := make([]string, len(portColumns))
+	for i, c := range portColumns {
+		names[i] = c.Name
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
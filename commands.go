@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Flags shared by the subcommands, by purpose; every command takes the common ones.
+var (
+	inputFlags  = []string{"file", "workers", "lenient", "include-net", "exclude-net", "wherehostname", "filter", "min-os-accuracy", "merge-by"}
+	portFlags   = []string{"whereport", "whereservice", "excludeport", "state", "min-conf", "ssl-only"}
+	enrichFlags = []string{"rdns", "rdns-workers", "rdns-timeout", "oui", "geoip", "asn", "rdap", "exposure", "exposure-cache", "exposure-max-age", "exposure-rate", "device-rules", "risk", "risk-rules"}
+	outputFlags = []string{"csv", "delimiter", "tsv", "headers", "no-header", "no-sanitize", "excel", "json", "jsonl", "zabbix", "md", "template", "o", "force", "append", "dry-run"}
+	commonFlags = []string{"config", "log-level", "log-file", "structured-log", "cpuprofile", "memprofile", "timing"}
+)
+
+// ************************************************************************************************
+// command is a subcommand of the command line (nmap2csv hosts scan.xml), selecting one mode with
+// only the flags that apply to it. The flags are those of Options, registered by the same names.
+type command struct {
+	// Name is the subcommand word.
+	Name string
+
+	// Args describes the positional arguments in the usage line.
+	Args string
+
+	// Summary is the one-line description listed in the usage.
+	Summary string
+
+	// flags lists the names of the accepted flags.
+	flags [][]string
+
+	// setup selects the mode of the command and consumes its own positional arguments, returning
+	// the remaining inputs.
+	setup func(o *Options, args []string) ([]string, error)
+}
+
+// commands lists the subcommands, in usage order.
+var commands = []command{
+	{
+		Name:    "hosts",
+		Args:    "[flags] [scan.xml ...]",
+		Summary: "List the hosts with open ports, their addresses, vendor and open port count (-hostname)",
+		flags:   [][]string{inputFlags, portFlags, {"port-services", "port-sep", "columns", "min-open", "max-open", "include-down", "spill"}, enrichFlags, outputFlags, commonFlags},
+		setup: func(o *Options, args []string) ([]string, error) {
+			o.ShowHostnames = true
+			return args, nil
+		},
+	},
+	{
+		Name:    "ports",
+		Args:    "[flags] [scan.xml ...]",
+		Summary: "Count the hosts having every port/protocol pair open (-port)",
+		flags:   [][]string{inputFlags, {"state"}, outputFlags, commonFlags},
+		setup: func(o *Options, args []string) ([]string, error) {
+			o.ShowPorts = true
+			return args, nil
+		},
+	},
+	{
+		Name:    "vendors",
+		Args:    "[flags] [scan.xml ...]",
+		Summary: "Count the MAC addresses of every NIC vendor (-vendor)",
+		flags:   [][]string{inputFlags, {"oui"}, outputFlags, commonFlags},
+		setup: func(o *Options, args []string) ([]string, error) {
+			o.ShowVendors = true
+			return args, nil
+		},
+	},
+	{
+		Name:    "diff",
+		Args:    "[flags] old.xml [new.xml ...]",
+		Summary: "Compare scans with an older one: new and gone hosts, opened and closed ports (-diff)",
+		flags:   [][]string{inputFlags, outputFlags, commonFlags},
+		setup: func(o *Options, args []string) ([]string, error) {
+			if len(args) == 0 {
+				return nil, errors.New("missing the old scan")
+			}
+			o.Diff = args[0]
+			return args[1:], nil
+		},
+	},
+}
+
+// lookupCommand returns the subcommand of the given name, nil when there is none.
+func lookupCommand(name string) *command {
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// flagSet returns the flags of the command, bound to the fields of o. Every flag of Options is
+// registered first so that the flags the command does not take keep their defaults.
+func (c *command) flagSet(o *Options) *flag.FlagSet {
+	all := flag.NewFlagSet("nmap2csv", flag.ContinueOnError)
+	o.register(all)
+	fs := flag.NewFlagSet("nmap2csv "+c.Name, flag.ExitOnError)
+	for _, group := range c.flags {
+		for _, name := range group {
+			f := all.Lookup(name)
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: nmap2csv %s %s\n\n%s.\n\nFlags:\n", c.Name, c.Args, c.Summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// ************************************************************************************************
+// parseCommandLine parses the arguments of the program into o and returns the flag set used and
+// the input patterns. The first argument may be a subcommand, or help; without one, every flag of
+// Options is accepted and the modes are selected by flags (-hostname, -port...).
+func (o *Options) parseCommandLine(args []string) (*flag.FlagSet, []string) {
+	if len(args) > 0 && args[0] == "help" {
+		o.register(flag.CommandLine)
+		if len(args) > 1 {
+			if c := lookupCommand(args[1]); c != nil {
+				fs := c.flagSet(o)
+				fs.SetOutput(os.Stdout)
+				fs.Usage()
+				os.Exit(0)
+			}
+			fmt.Fprintf(os.Stderr, "nmap2csv: unknown command %q\n\n", args[1])
+			printUsage(os.Stderr, flag.CommandLine)
+			os.Exit(2)
+		}
+		printUsage(os.Stdout, flag.CommandLine)
+		os.Exit(0)
+	}
+	if len(args) > 0 {
+		if c := lookupCommand(args[0]); c != nil {
+			fs := c.flagSet(o)
+			fs.Parse(args[1:])
+			patterns, err := c.setup(o, fs.Args())
+			if err != nil {
+				fmt.Fprintf(fs.Output(), "nmap2csv %s: %v\n", c.Name, err)
+				fs.Usage()
+				os.Exit(2)
+			}
+			return fs, patterns
+		}
+	}
+	fs := flag.CommandLine
+	o.register(fs)
+	fs.Usage = func() { printUsage(fs.Output(), fs) }
+	fs.Parse(args)
+	return fs, fs.Args()
+}
+
+// printUsage writes the usage of the program to w: the subcommands, then every flag of fs.
+func printUsage(w io.Writer, fs *flag.FlagSet) {
+	printCommands(w)
+	fmt.Fprint(w, "\nFlags:\n")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+// printCommands writes the usage lines and the list of subcommands to w.
+func printCommands(w io.Writer) {
+	var b strings.Builder
+	b.WriteString("Usage:\n  nmap2csv <command> [flags] [scan.xml ...]\n  nmap2csv [flags] [scan.xml ...]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "  %-9s %s\n", c.Name, c.Summary)
+	}
+	b.WriteString("\nRun \"nmap2csv help <command>\" for the flags of a command, \"nmap2csv help\" for every flag.\n")
+	b.WriteString("Without a command, a mode flag (-hostname, -port, -vendor, -long, -diff...) or an output such\n")
+	b.WriteString("as -xlsx is required.\n")
+	fmt.Fprint(w, b.String())
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// configFile is the name of the default configuration file, in the home directory.
+const configFile = ".nmap2csv.yaml"
+
+// formatFlags maps the values of the format setting to the flag selecting them.
+var formatFlags = map[string]string{
+	"table": "", "csv": "csv", "tsv": "tsv", "excel": "excel", "json": "json", "jsonl": "jsonl", "md": "md", "zabbix": "zabbix",
+}
+
+// ************************************************************************************************
+// applyConfig reads the -config file, or ~/.nmap2csv.yaml when it exists, and applies its settings
+// to the flags not given on the command line. The file is a YAML mapping of flag names to
+// their default values (lists are joined with commas), plus a format key naming the default
+// output format and a presets mapping of named port lists, used as @name in -whereport,
+// -excludeport and -check:
+//
+//	format: csv
+//	columns: [os, devicetype]
+//	oui: /usr/share/ieee-data/oui.txt
+//	rdns: true
+//	presets:
+//	  windows: 135,139,445,3389
+//	  web: [80, 443, 8000-8100, http]
+func (o *Options) applyConfig(flags *flag.FlagSet) error {
+	path := o.Config
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, configFile)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && o.Config == "" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := o.parseConfig(data, flags); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// parseConfig applies a YAML configuration document to flags.
+func (o *Options) parseConfig(data []byte, flags *flag.FlagSet) error {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return err
+	}
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return fmt.Errorf("expected a mapping of settings")
+	}
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	// The settings of flags a subcommand does not take are ignored, other keys are typos.
+	known := flag.NewFlagSet("nmap2csv", flag.ContinueOnError)
+	(&Options{}).register(known)
+
+	keys := make([]string, 0, len(root))
+	for k := range root {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		switch key {
+		case "presets":
+			presets, ok := root[key].(map[string]any)
+			if !ok {
+				return fmt.Errorf("presets: expected a mapping of names to port lists")
+			}
+			o.presets = make(map[string]string, len(presets))
+			for name, ports := range presets {
+				o.presets[strings.ToLower(name)] = strings.Join(yamlList(ports), ",")
+			}
+		case "format":
+			name, _ := root[key].(string)
+			flagName, ok := formatFlags[strings.ToLower(name)]
+			if !ok {
+				return fmt.Errorf("format: unknown format %q, expected one of table, csv, tsv, excel, json, jsonl, md, zabbix", name)
+			}
+			explicit := false
+			for _, f := range formatFlags {
+				explicit = explicit || set[f]
+			}
+			if flagName != "" && !explicit && flags.Lookup(flagName) != nil {
+				if err := flags.Set(flagName, "true"); err != nil {
+					return fmt.Errorf("format: %w", err)
+				}
+			}
+		case "config":
+			return fmt.Errorf("config: a configuration file cannot include another one")
+		default:
+			if known.Lookup(key) == nil {
+				return fmt.Errorf("unknown setting %q, expected a flag name without the dash", key)
+			}
+			if set[key] || flags.Lookup(key) == nil {
+				continue
+			}
+			value, ok := root[key].(string)
+			if list, isList := root[key].([]any); isList {
+				value, ok = strings.Join(yamlList(list), ","), true
+			}
+			if !ok {
+				return fmt.Errorf("%s: expected a value or a list", key)
+			}
+			if err := flags.Set(key, value); err != nil {
+				return fmt.Errorf("%s: invalid value %q: %w", key, value, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ************************************************************************************************
+// expandPresets replaces the @name entries of a comma-separated port list with the ports of the
+// configuration presets of that name.
+func (o *Options) expandPresets(list string) (string, error) {
+	if !strings.Contains(list, "@") {
+		return list, nil
+	}
+	entries := strings.Split(list, ",")
+	for i, entry := range entries {
+		name, ok := strings.CutPrefix(strings.TrimSpace(entry), "@")
+		if !ok {
+			continue
+		}
+		ports, ok := o.presets[strings.ToLower(name)]
+		if !ok {
+			return "", fmt.Errorf("unknown port preset @%s, define it under presets in the configuration file", name)
+		}
+		entries[i] = ports
+	}
+	return strings.Join(entries, ","), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ************************************************************************************************
+// TestParseYAML checks the YAML subset of the configuration and rules files.
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want any
+		err  string
+	}{
+		{"empty", "# nothing\n", map[string]any{}, ""},
+		{"scalars", "a: 1\nb: 'it''s'\nc: \"x#y\" # comment\nd:\n", map[string]any{"a": "1", "b": "it's", "c": "x#y", "d": ""}, ""},
+		{"flow sequence", "ports: [22, \"80,443\", http]\n", map[string]any{"ports": []any{"22", "80,443", "http"}}, ""},
+		{"block sequence", "---\nports:\n  - 22\n  - 445\n", map[string]any{"ports": []any{"22", "445"}}, ""},
+		{"sequence of mappings", "rules:\n- name: ssh\n  ports: [22]\n- name: web\n", map[string]any{"rules": []any{
+			map[string]any{"name": "ssh", "ports": []any{"22"}},
+			map[string]any{"name": "web"},
+		}}, ""},
+		{"nested mapping", "presets:\r\n  web: 80,443\r\n", map[string]any{"presets": map[string]any{"web": "80,443"}}, ""},
+		{"tab indentation", "a:\n\tb: 1\n", nil, "line 2: tabs are not allowed in indentation"},
+		{"unterminated string", "a: \"b\n", nil, "line 1: unterminated string"},
+		{"unterminated flow", "a: [b, c\n", nil, "line 1: unterminated flow sequence"},
+		{"bad indentation", "a: 1\n  b: 2\n", nil, "line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.doc))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// ************************************************************************************************
+// TestParseConfig checks how the settings of a configuration file apply to the flags.
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		args  []string
+		check func(o *Options) bool
+		err   string
+	}{
+		{"flag values", "columns: [os, devicetype]\nmin-conf: 8\nrdns: true\n", nil, func(o *Options) bool {
+			return o.Columns == "os,devicetype" && o.MinConf == 8 && o.RDNS
+		}, ""},
+		{"command line wins", "whereport: 22\n", []string{"-whereport", "445"}, func(o *Options) bool {
+			return o.WherePorts == "445"
+		}, ""},
+		{"format", "format: csv\n", nil, func(o *Options) bool { return o.CSV }, ""},
+		{"explicit format wins", "format: csv\n", []string{"-json"}, func(o *Options) bool {
+			return o.JSON && !o.CSV
+		}, ""},
+		{"presets", "presets:\n  Windows: 135,445\n  web: [80, 443]\n", nil, func(o *Options) bool {
+			ports, err := o.expandPresets("@windows,@WEB,22")
+			return err == nil && ports == "135,445,80,443,22"
+		}, ""},
+		{"unknown preset", "presets:\n  web: 80\n", nil, func(o *Options) bool {
+			_, err := o.expandPresets("@db")
+			return err != nil
+		}, ""},
+		{"unknown setting", "wherports: 22\n", nil, nil, `unknown setting "wherports"`},
+		{"unknown format", "format: xml\n", nil, nil, `format: unknown format "xml"`},
+		{"include", "config: other.yaml\n", nil, nil, "cannot include another one"},
+		{"invalid value", "min-conf: high\n", nil, nil, `min-conf: invalid value "high"`},
+		{"not a mapping", "- a\n- b\n", nil, nil, "expected a mapping of settings"},
+		{"bad presets", "presets: 22\n", nil, nil, "presets: expected a mapping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{}
+			fs := flag.NewFlagSet("nmap2csv", flag.ContinueOnError)
+			o.register(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			err := o.parseConfig([]byte(tt.doc), fs)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(o) {
+				t.Error("the settings were not applied")
+			}
+		})
+	}
+}
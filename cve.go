@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ************************************************************************************************
+// cveFeed indexes the vulnerable configurations of an NVD feed by "part:vendor:product".
+type cveFeed map[string][]cveCriterion
+
+// cveCriterion is one vulnerable CPE match of a CVE: either an exact version (and update), or
+// every version within the optional bounds when Version is "*".
+type cveCriterion struct {
+	ID    string
+	Score float64
+
+	Version, Update string
+
+	StartIncl, StartExcl, EndIncl, EndExcl string
+}
+
+// nvdCPEMatch is a CPE match of the NVD JSON 1.1 feeds (cpe23Uri) and of the NVD API 2.0
+// (criteria).
+type nvdCPEMatch struct {
+	Vulnerable bool   `json:"vulnerable"`
+	URI        string `json:"cpe23Uri"`
+	Criteria   string `json:"criteria"`
+	StartIncl  string `json:"versionStartIncluding"`
+	StartExcl  string `json:"versionStartExcluding"`
+	EndIncl    string `json:"versionEndIncluding"`
+	EndExcl    string `json:"versionEndExcluding"`
+}
+
+// nvdNode is a configuration node: CPE matches and, in 1.1 feeds, nested nodes.
+type nvdNode struct {
+	Match11  []nvdCPEMatch `json:"cpe_match"`
+	Match20  []nvdCPEMatch `json:"cpeMatch"`
+	Children []nvdNode     `json:"children"`
+}
+
+// nvdScore holds a CVSS base score, in either feed format.
+type nvdScore struct {
+	CVSS   struct{ BaseScore float64 } `json:"cvssData"`
+	CVSSV3 struct{ BaseScore float64 } `json:"cvssV3"`
+	CVSSV2 struct{ BaseScore float64 } `json:"cvssV2"`
+}
+
+// nvdDocument covers the NVD JSON 1.1 feeds (CVE_Items) and the NVD API 2.0 responses
+// (vulnerabilities), decoding only the fields the CVE mode uses.
+type nvdDocument struct {
+	Items []struct {
+		CVE struct {
+			Meta struct {
+				ID string `json:"ID"`
+			} `json:"CVE_data_meta"`
+		} `json:"cve"`
+		Configurations struct {
+			Nodes []nvdNode `json:"nodes"`
+		} `json:"configurations"`
+		Impact struct {
+			V3 nvdScore `json:"baseMetricV3"`
+			V2 nvdScore `json:"baseMetricV2"`
+		} `json:"impact"`
+	} `json:"CVE_Items"`
+	Vulnerabilities []struct {
+		CVE struct {
+			ID      string `json:"id"`
+			Metrics struct {
+				V31 []nvdScore `json:"cvssMetricV31"`
+				V30 []nvdScore `json:"cvssMetricV30"`
+				V2  []nvdScore `json:"cvssMetricV2"`
+			} `json:"metrics"`
+			Configurations []struct {
+				Nodes []nvdNode `json:"nodes"`
+			} `json:"configurations"`
+		} `json:"cve"`
+	} `json:"vulnerabilities"`
+}
+
+// ************************************************************************************************
+// loadCVEFeed reads NVD JSON feeds (nvdcve-1.1-2024.json, optionally gzipped) or saved NVD API 2.0
+// responses, given as comma-separated paths, glob patterns or directories.
+func loadCVEFeed(patterns []string) (cveFeed, error) {
+	files, err := expandInputs(patterns)
+	if err != nil {
+		return nil, err
+	}
+	feed := make(cveFeed)
+	for _, file := range files {
+		if err := feed.load(file); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return feed, nil
+}
+
+// load adds the vulnerable configurations of one feed file.
+func (f cveFeed) load(path string) error {
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	br := bufio.NewReader(fh)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("gzip: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	var doc nvdDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return err
+	}
+	for _, item := range doc.Items {
+		score := item.Impact.V3.CVSSV3.BaseScore
+		if score == 0 {
+			score = item.Impact.V2.CVSSV2.BaseScore
+		}
+		for _, n := range item.Configurations.Nodes {
+			f.addNode(item.CVE.Meta.ID, score, n)
+		}
+	}
+	for _, v := range doc.Vulnerabilities {
+		score := 0.0
+		for _, metrics := range [][]nvdScore{v.CVE.Metrics.V31, v.CVE.Metrics.V30, v.CVE.Metrics.V2} {
+			if len(metrics) > 0 {
+				score = metrics[0].CVSS.BaseScore
+				break
+			}
+		}
+		for _, c := range v.CVE.Configurations {
+			for _, n := range c.Nodes {
+				f.addNode(v.CVE.ID, score, n)
+			}
+		}
+	}
+	return nil
+}
+
+// addNode indexes the vulnerable CPE matches of a configuration node and of its children. The
+// AND combinations of the configurations (vulnerable software running on a given platform) are
+// not evaluated: every vulnerable match is kept.
+func (f cveFeed) addNode(id string, score float64, n nvdNode) {
+	for _, m := range append(n.Match11, n.Match20...) {
+		uri := m.URI
+		if uri == "" {
+			uri = m.Criteria
+		}
+		c, ok := parseCPE(uri)
+		if !m.Vulnerable || !ok {
+			continue
+		}
+		f[c.key()] = append(f[c.key()], cveCriterion{
+			ID: id, Score: score, Version: c.version, Update: c.update,
+			StartIncl: m.StartIncl, StartExcl: m.StartExcl, EndIncl: m.EndIncl, EndExcl: m.EndExcl,
+		})
+	}
+	for _, child := range n.Children {
+		f.addNode(id, score, child)
+	}
+}
+
+// ************************************************************************************************
+// cpeName holds the fields of a CPE name used for matching.
+type cpeName struct {
+	part, vendor, product, version, update string
+}
+
+// parseCPE parses a CPE 2.2 URI (cpe:/a:openbsd:openssh:8.9p1, as reported by Nmap) or a CPE 2.3
+// formatted string (cpe:2.3:a:openbsd:openssh:8.9:p1:*:*:*:*:*:*).
+func parseCPE(s string) (cpeName, bool) {
+	var fields []string
+	switch {
+	case strings.HasPrefix(s, "cpe:2.3:"):
+		fields = splitCPE23(strings.TrimPrefix(s, "cpe:2.3:"))
+	case strings.HasPrefix(s, "cpe:/"):
+		for _, f := range strings.Split(strings.TrimPrefix(s, "cpe:/"), ":") {
+			if u, err := url.PathUnescape(f); err == nil {
+				f = u
+			}
+			fields = append(fields, f)
+		}
+	default:
+		return cpeName{}, false
+	}
+	for len(fields) < 5 {
+		fields = append(fields, "")
+	}
+	c := cpeName{part: fields[0], vendor: fields[1], product: fields[2], version: fields[3], update: fields[4]}
+	for _, f := range []*string{&c.part, &c.vendor, &c.product, &c.version, &c.update} {
+		*f = strings.ToLower(*f)
+	}
+	return c, c.vendor != "" && c.product != ""
+}
+
+// splitCPE23 splits the fields of a CPE 2.3 formatted string, unescaping "\:" and friends.
+func splitCPE23(s string) []string {
+	var fields []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+		case s[i] == ':':
+			fields = append(fields, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(fields, cur.String())
+}
+
+// key returns the index key of the CPE in a cveFeed.
+func (c cpeName) key() string {
+	return c.part + ":" + c.vendor + ":" + c.product
+}
+
+// ************************************************************************************************
+// matches returns the criteria of the feed matching a CPE reported by Nmap. The first word of
+// version (the service version) is used when an application CPE carries none. Without any version,
+// only the criteria covering every version match.
+func (f cveFeed) matches(c cpeName, version string) []cveCriterion {
+	if words := strings.Fields(version); c.version == "" && c.part == "a" && len(words) > 0 {
+		c.version = strings.ToLower(words[0])
+	}
+	// Nmap folds the update into the version (8.9p1) where NVD splits it (8.9 / p1).
+	base, update := c.version, c.update
+	if i := strings.IndexFunc(base, func(r rune) bool { return (r < '0' || r > '9') && r != '.' }); i > 0 && update == "" {
+		base, update = base[:i], strings.TrimLeft(base[i:], "-_. ")
+	}
+	var found []cveCriterion
+	for _, cr := range f[c.key()] {
+		if cveAny(cr.Version) {
+			if c.version == "" {
+				if cr.StartIncl == "" && cr.StartExcl == "" && cr.EndIncl == "" && cr.EndExcl == "" {
+					found = append(found, cr)
+				}
+				continue
+			}
+			if cr.inRange(c.version) {
+				found = append(found, cr)
+			}
+			continue
+		}
+		if cr.Version == c.version || (cr.Version == base && (cveAny(cr.Update) || cr.Update == update)) {
+			found = append(found, cr)
+		}
+	}
+	return found
+}
+
+// cveAny reports whether a CPE field value matches any value.
+func cveAny(v string) bool {
+	return v == "*" || v == "-" || v == ""
+}
+
+// inRange reports whether version is within the bounds of the criterion.
+func (cr cveCriterion) inRange(version string) bool {
+	switch {
+	case cr.StartIncl != "" && compareVersions(version, cr.StartIncl) < 0,
+		cr.StartExcl != "" && compareVersions(version, cr.StartExcl) <= 0,
+		cr.EndIncl != "" && compareVersions(version, cr.EndIncl) > 0,
+		cr.EndExcl != "" && compareVersions(version, cr.EndExcl) >= 0:
+		return false
+	}
+	return true
+}
+
+// compareVersions compares two version strings chunk by chunk: numbers numerically, letters
+// alphabetically ("8.9p1" < "8.10" < "9.3p2"). A version with more chunks is the greater one.
+func compareVersions(a, b string) int {
+	ca, cb := versionChunks(a), versionChunks(b)
+	for i := 0; i < len(ca) && i < len(cb); i++ {
+		na, errA := strconv.Atoi(ca[i])
+		nb, errB := strconv.Atoi(cb[i])
+		var c int
+		if errA == nil && errB == nil {
+			c = na - nb
+		} else {
+			c = strings.Compare(ca[i], cb[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return len(ca) - len(cb)
+}
+
+// versionChunks splits a version into runs of digits and runs of letters, dropping separators.
+func versionChunks(v string) []string {
+	var chunks []string
+	v = strings.ToLower(v)
+	start, digit := -1, false
+	for i, r := range v + "." {
+		isDigit := r >= '0' && r <= '9'
+		isLetter := r >= 'a' && r <= 'z'
+		if start >= 0 && (!(isDigit || isLetter) || isDigit != digit) {
+			chunks = append(chunks, v[start:i])
+			start = -1
+		}
+		if start < 0 && (isDigit || isLetter) {
+			start, digit = i, isDigit
+		}
+	}
+	return chunks
+}
+
+// ************************************************************************************************
+// cveAggregator implements the CVE mode (-cve feed.json): the CPEs of the version detection results
+// of every open port and of the best OS match are looked up in the feed, and every known
+// vulnerability becomes a row. Rows are sorted by descending CVSS score, in scan order otherwise.
+type cveAggregator struct {
+	feed    cveFeed
+	results []CVEInfo
+}
+
+// newCVEAggregator creates a CVE mode aggregator matching the hosts against feed.
+func newCVEAggregator(feed cveFeed) *cveAggregator {
+	return &cveAggregator{feed: feed}
+}
+
+// Add implements Aggregator.
+func (a *cveAggregator) Add(h *Host) {
+	hostname := ""
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	ip := h.IP()
+	seen := make(map[string]bool)
+	add := func(port, uri, version string) {
+		c, ok := parseCPE(uri)
+		if !ok {
+			return
+		}
+		for _, cr := range a.feed.matches(c, version) {
+			key := port + "\x00" + uri + "\x00" + cr.ID
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			a.results = append(a.results, CVEInfo{Hostname: hostname, IP: ip, Port: port, CPE: uri, CVE: cr.ID, CVSS: cr.Score})
+		}
+	}
+	for _, p := range h.Ports {
+		if p.State.State != "open" {
+			continue
+		}
+		for _, uri := range p.Service.CPEs {
+			add(fmt.Sprintf("%d/%s", p.PortID, p.Protocol), uri, p.Service.Version)
+		}
+	}
+	if m := h.BestOSMatch(); m != nil {
+		for _, class := range m.Classes {
+			for _, uri := range class.CPEs {
+				add("", uri, "")
+			}
+		}
+	}
+}
+
+// Report implements Aggregator.
+func (a *cveAggregator) Report() *Report {
+	sort.SliceStable(a.results, func(i, j int) bool {
+		return a.results[i].CVSS > a.results[j].CVSS
+	})
+	report := &Report{Headers: []string{"Hostname", "IP", "Port/Proto", "CPE", "CVE", "CVSS"}, Records: a.results}
+	for _, r := range a.results {
+		report.Rows = append(report.Rows, []string{r.Hostname, r.IP, r.Port, r.CPE, r.CVE, strconv.FormatFloat(r.CVSS, 'f', 1, 64)})
+	}
+	return report
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ************************************************************************************************
+// deviceRule classifies as Type the hosts satisfying a hostExpr condition.
+type deviceRule struct {
+	Type string
+	expr *hostExpr
+}
+
+// defaultDeviceRules are the built-in classification rules, tried in order after those of
+// -device-rules. They combine the OS detection device type, the MAC vendor and the open ports. The
+// vendor of a NIC is only a guess, ignored when OS detection is at least 90% sure of the host: a
+// Linux server with a Cisco NIC is not a switch.
+var defaultDeviceRules = []string{
+	`printer: osType contains "printer" || osAccuracy < 90 && vendor matches "(?i)(lexmark|xerox|brother|kyocera|ricoh|epson|konica|zebra|sharp)" || port(9100).open || port(515).open || service("ipp")`,
+	`camera: osType contains "webcam" || osAccuracy < 90 && vendor matches "(?i)(hikvision|dahua|axis comm|vivotek|hanwha|mobotix|amcrest|reolink|uniview)" || port(554).open || port(37777).open`,
+	`hypervisor: os matches "(?i)(esxi|vmware|proxmox|xenserver|hyper-v)" || port(902).open || port(8006).open || service("vmware-auth")`,
+	`switch: osType matches "(?i)(switch|router|firewall|bridge|wap|broadband|load balancer)" || osAccuracy < 90 && vendor matches "(?i)(cisco|juniper|aruba|netgear|ubiquiti|mikrotik|fortinet|palo alto|extreme networks|brocade|zyxel|tp-link|ruckus|allied telesis)" || port(161, "udp").open && countOpen == 1`,
+	`iot: osType matches "(?i)(specialized|media device|power-device|game console|phone|pda|terminal|security-misc)" || osAccuracy < 90 && vendor matches "(?i)(espressif|raspberry|tuya|sonos|philips lighting|nest labs|shelly|roku)" || port(1883).open || port(8883).open || port(5683, "udp").open`,
+	`server: os matches "(?i)server" || service("ldap") || service("mssql") || service("mysql") || service("postgresql") || service("oracle-tns") || service("smtp") || service("domain") || service("kerberos-sec")`,
+	`workstation: os matches "(?i)(windows (xp|vista|7|8|10|11)|mac ?os|ubuntu desktop)" || port(135).open || port(445).open || port(3389).open || port(5900).open`,
+	`server: port(22).open || service("http") || service("https")`,
+}
+
+// ************************************************************************************************
+// deviceClassifier fills the DeviceType of the hosts with the type of the first rule they satisfy.
+type deviceClassifier []deviceRule
+
+// ************************************************************************************************
+// newDeviceClassifier compiles the rules of path, when not empty, followed by the built-in rules.
+// A rules file has one "type: expression" rule per line, in the -filter language; blank lines and
+// lines starting with # are ignored:
+//
+//	# Our badge readers
+//	iot: vendor contains "HID Global" || port(4070).open
+func newDeviceClassifier(path string) (deviceClassifier, error) {
+	var c deviceClassifier
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for n := 1; sc.Scan(); n++ {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || line[0] == '#' {
+				continue
+			}
+			r, err := parseDeviceRule(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+			}
+			c = append(c, r)
+		}
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for _, line := range defaultDeviceRules {
+		r, err := parseDeviceRule(line)
+		if err != nil {
+			panic(fmt.Sprintf("built-in device rule %q: %v", line, err))
+		}
+		c = append(c, r)
+	}
+	return c, nil
+}
+
+// parseDeviceRule parses a "type: expression" rule.
+func parseDeviceRule(line string) (deviceRule, error) {
+	typ, src, ok := strings.Cut(line, ":")
+	typ = strings.TrimSpace(typ)
+	if !ok || typ == "" || strings.ContainsAny(typ, " \t\"") {
+		return deviceRule{}, fmt.Errorf("expected \"type: expression\", got %q", line)
+	}
+	expr, err := parseHostExpr(src)
+	if err != nil {
+		return deviceRule{}, err
+	}
+	return deviceRule{Type: typ, expr: expr}, nil
+}
+
+// Enrich implements hostEnricher. It must run after the other enrichers, whose data the rules may
+// use (vendors from -oui...).
+func (c deviceClassifier) Enrich(h *Host) {
+	if h.DeviceType != "" {
+		return
+	}
+	for _, r := range c {
+		if r.expr.Match(h) {
+			h.DeviceType = r.Type
+			return
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+// ************************************************************************************************
+// TestDeviceClassifier checks the precedence of the built-in rules: the device type of a confident
+// OS detection, then the MAC vendor, then the open ports.
+func TestDeviceClassifier(t *testing.T) {
+	c, err := newDeviceClassifier("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		osType   string
+		accuracy int
+		vendor   string
+		ports    []int
+		want     string
+	}{
+		{"confident OS class over vendor", "general purpose", 95, "Cisco Systems", []int{22}, "server"},
+		{"confident OS class over printer vendor", "switch", 96, "Lexmark", nil, "switch"},
+		{"vendor without OS detection", "", 0, "Cisco Systems", nil, "switch"},
+		{"vendor over a weak OS match", "general purpose", 85, "Cisco Systems", []int{22}, "switch"},
+		{"OS class without vendor", "printer", 92, "", nil, "printer"},
+		{"ports with a confident OS class", "general purpose", 98, "Hikvision", []int{554}, "camera"},
+		{"ports only", "", 0, "", []int{3389}, "workstation"},
+		{"nothing known", "", 0, "", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Host{Addresses: []Address{{Addr: "10.0.0.1", AddrType: "ipv4"}}}
+			if tt.vendor != "" {
+				h.Addresses = append(h.Addresses, Address{Addr: "00:11:22:33:44:55", AddrType: "mac", Vendor: tt.vendor})
+			}
+			if tt.osType != "" {
+				h.OS = &OS{Matches: []OSMatch{{Name: "Test OS", Accuracy: tt.accuracy, Classes: []OSClass{{Type: tt.osType, Accuracy: tt.accuracy}}}}}
+			}
+			for _, id := range tt.ports {
+				p := Port{PortID: id, Protocol: "tcp"}
+				p.State.State = "open"
+				h.Ports = append(h.Ports, p)
+			}
+			c.Enrich(h)
+			if h.DeviceType != tt.want {
+				t.Errorf("got %q, want %q", h.DeviceType, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// Changes reported by the diff mode, in output order.
+const (
+	changeNewHost    = "new host"
+	changeHostGone   = "host gone"
+	changePortOpened = "port opened"
+	changePortClosed = "port closed"
+)
+
+// ************************************************************************************************
+// scanSnapshot is the open ports of every host of a scan, keyed by host address, used as the
+// reference of the diff mode.
+type scanSnapshot map[string]*hostSnapshot
+
+// hostSnapshot is the state of one host in a scanSnapshot.
+type hostSnapshot struct {
+	hostname string
+
+	// open maps every open "port/proto" of the host to its service name.
+	open map[string]string
+}
+
+// ************************************************************************************************
+// add records the host in the snapshot. Hosts found in several inputs are merged.
+func (s scanSnapshot) add(h *Host) {
+	if !h.IsUp() {
+		return
+	}
+	addr := h.PrimaryAddr()
+	hs, ok := s[addr]
+	if !ok {
+		hs = &hostSnapshot{open: make(map[string]string)}
+		s[addr] = hs
+	}
+	if len(h.Hostnames) > 0 && hs.hostname == "" {
+		hs.hostname = h.Hostnames[0].Name
+	}
+	for _, p := range h.Ports {
+		if p.State.State == "open" {
+			hs.open[fmt.Sprintf("%d/%s", p.PortID, p.Protocol)] = p.Service.Name
+		}
+	}
+}
+
+// ************************************************************************************************
+// loadSnapshot reads the scans of the given patterns into a snapshot.
+func loadSnapshot(patterns []string) (scanSnapshot, error) {
+	files, err := expandInputs(patterns)
+	if err != nil {
+		return nil, err
+	}
+	snap := make(scanSnapshot)
+	for _, file := range files {
+		if _, err := loadScan(file, func(h *Host) error { snap.add(h); return nil }, nil); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return snap, nil
+}
+
+// ************************************************************************************************
+// diffAggregator implements the diff mode (-diff old.xml): the inputs are compared to an older
+// scan and the new hosts, disappeared hosts, newly opened ports and newly closed ports are
+// reported, one row per port. Hosts are matched by address.
+type diffAggregator struct {
+	old, cur scanSnapshot
+}
+
+// newDiffAggregator creates a diff mode aggregator comparing the inputs to old.
+func newDiffAggregator(old scanSnapshot) *diffAggregator {
+	return &diffAggregator{old: old, cur: make(scanSnapshot)}
+}
+
+// Add implements Aggregator.
+func (a *diffAggregator) Add(h *Host) {
+	a.cur.add(h)
+}
+
+// Report implements Aggregator.
+func (a *diffAggregator) Report() *Report {
+	var changes []DiffInfo
+	emit := func(change, addr string, hs *hostSnapshot, ports map[string]string) {
+		if len(ports) == 0 {
+			changes = append(changes, DiffInfo{Change: change, IP: addr, Hostname: hs.hostname})
+		}
+		for port, service := range ports {
+			changes = append(changes, DiffInfo{Change: change, IP: addr, Hostname: hs.hostname, Port: port, Service: service})
+		}
+	}
+	for addr, cur := range a.cur {
+		old, ok := a.old[addr]
+		if !ok {
+			emit(changeNewHost, addr, cur, cur.open)
+			continue
+		}
+		for port, service := range cur.open {
+			if _, ok := old.open[port]; !ok {
+				changes = append(changes, DiffInfo{Change: changePortOpened, IP: addr, Hostname: cur.hostname, Port: port, Service: service})
+			}
+		}
+		for port, service := range old.open {
+			if _, ok := cur.open[port]; !ok {
+				changes = append(changes, DiffInfo{Change: changePortClosed, IP: addr, Hostname: cur.hostname, Port: port, Service: service})
+			}
+		}
+	}
+	for addr, old := range a.old {
+		if _, ok := a.cur[addr]; !ok {
+			emit(changeHostGone, addr, old, old.open)
+		}
+	}
+
+	order := map[string]int{changeNewHost: 0, changeHostGone: 1, changePortOpened: 2, changePortClosed: 3}
+	sort.Slice(changes, func(i, j int) bool {
+		ci, cj := changes[i], changes[j]
+		if ci.Change != cj.Change {
+			return order[ci.Change] < order[cj.Change]
+		}
+		if ci.IP != cj.IP {
+			return compareAddrs(ci.IP, cj.IP)
+		}
+		return comparePorts(ci.Port, cj.Port)
+	})
+
+	report := &Report{Headers: []string{"Change", "IP", "Hostname", "Port/Proto", "Service"}, Records: changes}
+	for _, c := range changes {
+		report.Rows = append(report.Rows, []string{c.Change, c.IP, c.Hostname, c.Port, c.Service})
+	}
+	return report
+}
+
+// ************************************************************************************************
+// compareAddrs orders addresses numerically when both are IPs, as text otherwise.
+func compareAddrs(a, b string) bool {
+	ia, errA := netip.ParseAddr(a)
+	ib, errB := netip.ParseAddr(b)
+	if errA == nil && errB == nil {
+		return ia.Less(ib)
+	}
+	return a < b
+}
+
+// ************************************************************************************************
+// comparePorts orders "port/proto" keys by protocol, then port number.
+func comparePorts(a, b string) bool {
+	var pa, pb int
+	var protoA, protoB string
+	fmt.Sscanf(a, "%d/%s", &pa, &protoA)
+	fmt.Sscanf(b, "%d/%s", &pb, &protoB)
+	if protoA != protoB {
+		return protoA < protoB
+	}
+	return pa < pb
+}
@@ -0,0 +1,7 @@
+//go:build mysql
+
+package main
+
+// The MySQL driver is only linked into binaries built with -tags mysql, so that the default build
+// keeps depending on the standard library alone.
+import _ "github.com/go-sql-driver/mysql"
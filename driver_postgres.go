@@ -0,0 +1,7 @@
+//go:build postgres
+
+package main
+
+// The PostgreSQL driver is only linked into binaries built with -tags postgres, so that the default
+// build keeps depending on the standard library alone.
+import _ "github.com/jackc/pgx/v5/stdlib"
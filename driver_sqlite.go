@@ -0,0 +1,7 @@
+//go:build sqlite
+
+package main
+
+// The SQLite driver is only linked into binaries built with -tags sqlite, so that the default
+// build keeps depending on the standard library alone.
+import _ "modernc.org/sqlite"
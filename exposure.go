@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// exposureHTTPTimeout bounds every Shodan or Censys request.
+const exposureHTTPTimeout = 15 * time.Second
+
+// ************************************************************************************************
+// exposureSource implements -exposure: the public addresses of the hosts are looked up in an
+// internet-wide scanning service (Shodan or Censys) to compare the scans with what the whole
+// internet sees. Answers are cached on disk and requests are spaced by at least rate.
+type exposureSource struct {
+	provider  string
+	fetch     func(ip netip.Addr) (*ExposureInfo, error)
+	client    *http.Client
+	rate      time.Duration
+	last      time.Time
+	cachePath string
+	maxAge    time.Duration
+	cache     map[string]exposureCacheEntry
+}
+
+// exposureCacheEntry is a cached answer; a nil Info records an address unknown to the provider.
+type exposureCacheEntry struct {
+	Fetched time.Time     `json:"fetched"`
+	Info    *ExposureInfo `json:"info"`
+}
+
+// errExposureUnknown is returned by the fetchers for the addresses the provider has no data on.
+var errExposureUnknown = errors.New("address unknown to the provider")
+
+// ************************************************************************************************
+// openExposure creates the -exposure source for provider ("shodan" or "censys"), reading its
+// credentials from the environment (SHODAN_API_KEY, or CENSYS_API_ID and CENSYS_API_SECRET).
+// cachePath defaults to a file of the user cache directory.
+func openExposure(provider, cachePath string, maxAge, rate time.Duration) (*exposureSource, error) {
+	s := &exposureSource{
+		provider: strings.ToLower(provider),
+		client:   &http.Client{Timeout: exposureHTTPTimeout},
+		rate:     rate,
+		maxAge:   maxAge,
+		cache:    make(map[string]exposureCacheEntry),
+	}
+	switch s.provider {
+	case "shodan":
+		key := os.Getenv("SHODAN_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("-exposure shodan needs the SHODAN_API_KEY environment variable")
+		}
+		s.fetch = func(ip netip.Addr) (*ExposureInfo, error) { return s.fetchShodan(ip, key) }
+	case "censys":
+		id, secret := os.Getenv("CENSYS_API_ID"), os.Getenv("CENSYS_API_SECRET")
+		if id == "" || secret == "" {
+			return nil, fmt.Errorf("-exposure censys needs the CENSYS_API_ID and CENSYS_API_SECRET environment variables")
+		}
+		s.fetch = func(ip netip.Addr) (*ExposureInfo, error) { return s.fetchCensys(ip, id, secret) }
+	default:
+		return nil, fmt.Errorf("unknown -exposure provider %q, expected shodan or censys", provider)
+	}
+	if cachePath == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("no cache directory, use -exposure-cache: %w", err)
+		}
+		cachePath = filepath.Join(dir, "nmap2csv", "exposure-"+s.provider+".json")
+	}
+	s.cachePath = cachePath
+	if data, err := os.ReadFile(cachePath); err == nil {
+		if err := json.Unmarshal(data, &s.cache); err != nil {
+			return nil, fmt.Errorf("%s: %w", cachePath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Enrich implements hostEnricher. Private, loopback and link-local addresses are not looked up.
+func (s *exposureSource) Enrich(h *Host) {
+	if h.Exposure != nil {
+		return
+	}
+	ip, ok := publicAddr(h)
+	if !ok {
+		return
+	}
+	key := ip.String()
+	if e, ok := s.cache[key]; ok && (s.maxAge <= 0 || time.Since(e.Fetched) < s.maxAge) {
+		h.Exposure = e.Info
+		return
+	}
+	if wait := s.rate - time.Since(s.last); wait > 0 {
+		time.Sleep(wait)
+	}
+	s.last = time.Now()
+	info, err := s.fetch(ip)
+	if err != nil && !errors.Is(err, errExposureUnknown) {
+		slog.Warn("Exposure lookup failed", "provider", s.provider, "addr", key, "err", err)
+		return
+	}
+	s.cache[key] = exposureCacheEntry{Fetched: time.Now(), Info: info}
+	if err := s.saveCache(); err != nil {
+		slog.Warn("Cannot write the exposure cache", "file", s.cachePath, "err", err)
+	}
+	h.Exposure = info
+}
+
+// saveCache writes the cache file, replacing it atomically.
+func (s *exposureSource) saveCache() error {
+	return writeOutput(s.cachePath, true, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(s.cache)
+	})
+}
+
+// get performs an API request and decodes its JSON answer into v. A 404 answer means the
+// provider has no data on the address. Transport errors are returned without the request URL,
+// which may carry the API key.
+func (s *exposureSource) get(req *http.Request, v any) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errExposureUnknown
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// fetchShodan queries the Shodan host API.
+func (s *exposureSource) fetchShodan(ip netip.Addr, key string) (*ExposureInfo, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://api.shodan.io/shodan/host/"+ip.String()+"?minify=true&key="+url.QueryEscape(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	var answer struct {
+		Ports      []int    `json:"ports"`
+		Tags       []string `json:"tags"`
+		LastUpdate string   `json:"last_update"`
+	}
+	if err := s.get(req, &answer); err != nil {
+		return nil, err
+	}
+	sort.Ints(answer.Ports)
+	return &ExposureInfo{Ports: answer.Ports, Tags: answer.Tags, LastSeen: strings.SplitN(answer.LastUpdate, "T", 2)[0]}, nil
+}
+
+// fetchCensys queries the Censys Search 2.0 host API.
+func (s *exposureSource) fetchCensys(ip netip.Addr, id, secret string) (*ExposureInfo, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://search.censys.io/api/v2/hosts/"+ip.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(id, secret)
+	var answer struct {
+		Result struct {
+			Services []struct {
+				Port int `json:"port"`
+			} `json:"services"`
+			Labels        []string `json:"labels"`
+			LastUpdatedAt string   `json:"last_updated_at"`
+		} `json:"result"`
+	}
+	if err := s.get(req, &answer); err != nil {
+		return nil, err
+	}
+	info := &ExposureInfo{Tags: answer.Result.Labels, LastSeen: strings.SplitN(answer.Result.LastUpdatedAt, "T", 2)[0]}
+	for _, svc := range answer.Result.Services {
+		if !slices.Contains(info.Ports, svc.Port) {
+			info.Ports = append(info.Ports, svc.Port)
+		}
+	}
+	sort.Ints(info.Ports)
+	return info, nil
+}
+
+// ************************************************************************************************
+// exposureOnly returns the ports the provider saw on the host that the scans did not find open.
+func exposureOnly(h *Host) []int {
+	var only []int
+	for _, port := range h.Exposure.Ports {
+		open := false
+		for _, p := range h.Ports {
+			if p.PortID == port && p.State.State == "open" {
+				open = true
+				break
+			}
+		}
+		if !open {
+			only = append(only, port)
+		}
+	}
+	return only
+}
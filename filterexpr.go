@@ -0,0 +1,560 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/1mm0rt41PC/nmap2csv/pkg/nmapparse"
+)
+
+// ************************************************************************************************
+// hostExpr is a compiled -filter expression, evaluated against every host.
+//
+// The language combines host fields, literals and a few functions with the usual operators:
+//
+//	countOpen > 3 && vendor contains "Cisco" && port(22).open
+//	!(os matches "(?i)windows") || service("smb")
+//
+// Operators, by increasing precedence: ||, &&, ! and the comparisons ==, !=, <, <=, >, >=,
+// contains (case-insensitive substring) and matches (regular expression literal).
+// Expressions are type-checked when they are parsed, so a mistake is reported before any scan is
+// read.
+type hostExpr struct {
+	src  string
+	eval func(h *Host) any
+}
+
+// exprType is the static type of an expression node.
+type exprType int
+
+const (
+	exprBool exprType = iota
+	exprInt
+	exprString
+)
+
+// String returns the name of the type used in error messages.
+func (t exprType) String() string {
+	return [...]string{"bool", "number", "string"}[t]
+}
+
+// exprNode is a typed node of the expression tree. lit holds the value of literal nodes, so that
+// matches can compile its expression once.
+type exprNode struct {
+	typ  exprType
+	eval func(h *Host) any
+	lit  any
+}
+
+// exprField is a host field usable by name in an expression.
+type exprField struct {
+	typ   exprType
+	value func(h *Host) any
+}
+
+// exprFields lists the host fields of the expression language.
+var exprFields = map[string]exprField{
+	"hostname": {exprString, func(h *Host) any {
+		if len(h.Hostnames) > 0 {
+			return h.Hostnames[0].Name
+		}
+		return ""
+	}},
+	"ip":     {exprString, func(h *Host) any { return h.IP() }},
+	"mac":    {exprString, func(h *Host) any { return hostAddr(h, "mac").Addr }},
+	"vendor": {exprString, func(h *Host) any { return hostAddr(h, "mac").Vendor }},
+	"os": {exprString, func(h *Host) any {
+		if m := h.BestOSMatch(); m != nil {
+			return m.Name
+		}
+		return ""
+	}},
+	"osType": {exprString, func(h *Host) any {
+		if m := h.BestOSMatch(); m != nil && len(m.Classes) > 0 {
+			return m.Classes[0].Type
+		}
+		return ""
+	}},
+	"osFamily":   {exprString, func(h *Host) any { return osFamily(h) }},
+	"deviceType": {exprString, func(h *Host) any { return h.DeviceType }},
+	"status": {exprString, func(h *Host) any {
+		if h.Status == nil {
+			return "up"
+		}
+		return h.Status.State
+	}},
+	"countOpen": {exprInt, func(h *Host) any {
+		n := 0
+		for _, p := range h.Ports {
+			if p.State.State == "open" {
+				n++
+			}
+		}
+		return n
+	}},
+	"countPorts": {exprInt, func(h *Host) any { return len(h.Ports) }},
+	"osAccuracy": {exprInt, func(h *Host) any {
+		if m := h.BestOSMatch(); m != nil {
+			return m.Accuracy
+		}
+		return 0
+	}},
+}
+
+// exprPortFields lists the fields of the port(n) function result and their types.
+var exprPortFields = map[string]exprType{
+	"open":    exprBool,
+	"state":   exprString,
+	"service": exprString,
+	"product": exprString,
+	"version": exprString,
+}
+
+// hostAddr returns the first address of the host of the given type, the zero Address when none.
+func hostAddr(h *Host, addrType string) Address {
+	for _, a := range h.Addresses {
+		if a.AddrType == addrType {
+			return a
+		}
+	}
+	return Address{}
+}
+
+// ************************************************************************************************
+// parseHostExpr compiles a -filter expression.
+func parseHostExpr(src string) (*hostExpr, error) {
+	toks, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	if n.typ != exprBool {
+		return nil, fmt.Errorf("the expression is a %s, expected a condition", n.typ)
+	}
+	return &hostExpr{src: src, eval: n.eval}, nil
+}
+
+// Match reports whether the host satisfies the expression.
+func (e *hostExpr) Match(h *Host) bool {
+	return e.eval(h).(bool)
+}
+
+// ************************************************************************************************
+// Token kinds of the expression lexer.
+const (
+	tokEOF = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+// exprToken is a lexical token with its byte offset in the expression.
+type exprToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+// exprOperators lists the operator and punctuation tokens, longest first.
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", ",", "."}
+
+// lexExpr splits an expression into tokens.
+func lexExpr(src string) ([]exprToken, error) {
+	var toks []exprToken
+	i := 0
+next:
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at position %d", i+1)
+			}
+			s, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %w", i+1, err)
+			}
+			toks = append(toks, exprToken{tokString, s, i})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+				j++
+			}
+			toks = append(toks, exprToken{tokNumber, src[i:j], i})
+			i = j
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, exprToken{tokIdent, src[i:j], i})
+			i = j
+		default:
+			for _, op := range exprOperators {
+				if strings.HasPrefix(src[i:], op) {
+					toks = append(toks, exprToken{tokOp, op, i})
+					i += len(op)
+					continue next
+				}
+			}
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i+1)
+		}
+	}
+	return append(toks, exprToken{tokEOF, "end of expression", len(src)}), nil
+}
+
+// ************************************************************************************************
+// exprParser is a recursive descent parser building the typed expression tree.
+type exprParser struct {
+	toks []exprToken
+	pos  int
+}
+
+// peek returns the current token without consuming it.
+func (p *exprParser) peek() exprToken {
+	return p.toks[p.pos]
+}
+
+// next consumes and returns the current token.
+func (p *exprParser) next() exprToken {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the current token when it is the operator or keyword text.
+func (p *exprParser) accept(text string) bool {
+	if t := p.peek(); (t.kind == tokOp || t.kind == tokIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect consumes the operator text or fails.
+func (p *exprParser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		return p.errorf(t, "expected %q, found %q", text, t.text)
+	}
+	return nil
+}
+
+// errorf returns a parse error located at the token.
+func (p *exprParser) errorf(t exprToken, format string, args ...any) error {
+	return fmt.Errorf("position %d: %s", t.pos+1, fmt.Sprintf(format, args...))
+}
+
+// parseOr parses a || b || ...
+func (p *exprParser) parseOr() (*exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !p.accept("||") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if left.typ != exprBool || right.typ != exprBool {
+			return nil, p.errorf(t, "|| needs conditions on both sides")
+		}
+		l, r := left.eval, right.eval
+		left = &exprNode{typ: exprBool, eval: func(h *Host) any { return l(h).(bool) || r(h).(bool) }}
+	}
+}
+
+// parseAnd parses a && b && ...
+func (p *exprParser) parseAnd() (*exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !p.accept("&&") {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if left.typ != exprBool || right.typ != exprBool {
+			return nil, p.errorf(t, "&& needs conditions on both sides")
+		}
+		l, r := left.eval, right.eval
+		left = &exprNode{typ: exprBool, eval: func(h *Host) any { return l(h).(bool) && r(h).(bool) }}
+	}
+}
+
+// parseUnary parses !a and comparisons.
+func (p *exprParser) parseUnary() (*exprNode, error) {
+	t := p.peek()
+	if p.accept("!") {
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if n.typ != exprBool {
+			return nil, p.errorf(t, "! needs a condition")
+		}
+		e := n.eval
+		return &exprNode{typ: exprBool, eval: func(h *Host) any { return !e(h).(bool) }}, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses a primary optionally compared with another one.
+func (p *exprParser) parseComparison() (*exprNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	var op string
+	for _, candidate := range []string{"==", "!=", "<=", ">=", "<", ">", "contains", "matches"} {
+		if p.accept(candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return left, nil
+	}
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	l, r := left.eval, right.eval
+	switch op {
+	case "contains":
+		if left.typ != exprString || right.typ != exprString {
+			return nil, p.errorf(t, "contains needs strings on both sides")
+		}
+		return &exprNode{typ: exprBool, eval: func(h *Host) any {
+			return strings.Contains(strings.ToLower(l(h).(string)), strings.ToLower(r(h).(string)))
+		}}, nil
+	case "matches":
+		pattern, ok := right.lit.(string)
+		if left.typ != exprString || !ok {
+			return nil, p.errorf(t, "matches needs a string and a regular expression literal")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, p.errorf(t, "invalid regular expression: %v", err)
+		}
+		return &exprNode{typ: exprBool, eval: func(h *Host) any { return re.MatchString(l(h).(string)) }}, nil
+	}
+	if left.typ != right.typ {
+		return nil, p.errorf(t, "cannot compare a %s with a %s", left.typ, right.typ)
+	}
+	if left.typ == exprBool && op != "==" && op != "!=" {
+		return nil, p.errorf(t, "%s cannot compare conditions", op)
+	}
+	return &exprNode{typ: exprBool, eval: func(h *Host) any { return compareValues(op, l(h), r(h)) }}, nil
+}
+
+// compareValues applies a comparison operator to two values of the same type.
+func compareValues(op string, a, b any) bool {
+	var c int
+	switch a := a.(type) {
+	case int:
+		c = a - b.(int)
+	case string:
+		c = strings.Compare(a, b.(string))
+	case bool:
+		if a != b.(bool) {
+			c = 1
+		}
+	}
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// parsePrimary parses literals, fields, function calls and parenthesized expressions.
+func (p *exprParser) parsePrimary() (*exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		n, err := strconv.Atoi(t.text)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %q", t.text)
+		}
+		return &exprNode{typ: exprInt, eval: func(*Host) any { return n }, lit: n}, nil
+	case tokString:
+		s := t.text
+		return &exprNode{typ: exprString, eval: func(*Host) any { return s }, lit: s}, nil
+	case tokOp:
+		if t.text == "(" {
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		}
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			b := t.text == "true"
+			return &exprNode{typ: exprBool, eval: func(*Host) any { return b }, lit: b}, nil
+		}
+		if p.accept("(") {
+			return p.parseCall(t)
+		}
+		if f, ok := exprFields[t.text]; ok {
+			return &exprNode{typ: f.typ, eval: f.value}, nil
+		}
+		return nil, p.errorf(t, "unknown field %q", t.text)
+	}
+	return nil, p.errorf(t, "unexpected %q", t.text)
+}
+
+// parseCall parses the arguments of a function call whose name and "(" were consumed.
+func (p *exprParser) parseCall(name exprToken) (*exprNode, error) {
+	var args []*exprNode
+	if !p.accept(")") {
+		for {
+			a, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, a)
+			if p.accept(")") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	switch name.text {
+	case "port":
+		return p.parsePortCall(name, args)
+	case "service", "cleartext", "script":
+		if len(args) != 1 || args[0].lit == nil || args[0].typ != exprString {
+			return nil, p.errorf(name, "%s() takes a string literal", name.text)
+		}
+		arg := args[0].lit.(string)
+		if name.text != "script" {
+			// cleartext() only counts the ports not wrapped in SSL/TLS (Port.TLS).
+			filter := nmapparse.NewPortFilter("", arg, "", nil)
+			cleartext := name.text == "cleartext"
+			return &exprNode{typ: exprBool, eval: func(h *Host) any {
+				for i := range h.Ports {
+					if filter.Selected(&h.Ports[i]) && !(cleartext && h.Ports[i].TLS()) {
+						return true
+					}
+				}
+				return false
+			}}, nil
+		}
+		return &exprNode{typ: exprBool, eval: func(h *Host) any { return hasScript(h, arg) }}, nil
+	}
+	return nil, p.errorf(name, "unknown function %q", name.text)
+}
+
+// parsePortCall parses port(n) or port(n, "proto") and the mandatory field selector following it.
+// The port is looked up when the expression is evaluated; a port missing from the host has an empty
+// state and is not open.
+func (p *exprParser) parsePortCall(name exprToken, args []*exprNode) (*exprNode, error) {
+	if len(args) < 1 || len(args) > 2 || args[0].typ != exprInt || args[0].lit == nil {
+		return nil, p.errorf(name, "port() takes a port number and an optional protocol")
+	}
+	id, proto := args[0].lit.(int), ""
+	if len(args) == 2 {
+		s, ok := args[1].lit.(string)
+		if !ok {
+			return nil, p.errorf(name, "the protocol of port() must be a string literal")
+		}
+		proto = strings.ToLower(s)
+	}
+	if err := p.expect("."); err != nil {
+		return nil, err
+	}
+	field := p.next()
+	typ, ok := exprPortFields[field.text]
+	if field.kind != tokIdent || !ok {
+		return nil, p.errorf(field, "unknown port field %q", field.text)
+	}
+	lookup := func(h *Host) *Port {
+		for i := range h.Ports {
+			if h.Ports[i].PortID == id && (proto == "" || h.Ports[i].Protocol == proto) {
+				return &h.Ports[i]
+			}
+		}
+		return nil
+	}
+	return &exprNode{typ: typ, eval: func(h *Host) any {
+		port := lookup(h)
+		if port == nil {
+			if typ == exprBool {
+				return false
+			}
+			return ""
+		}
+		switch field.text {
+		case "open":
+			return port.State.State == "open"
+		case "state":
+			return port.State.State
+		case "service":
+			return port.Service.Name
+		case "product":
+			return port.Service.Product
+		}
+		return port.Service.Version
+	}}, nil
+}
+
+// hasScript reports whether a host or port script of the host has an id matching the glob pattern.
+func hasScript(h *Host, pattern string) bool {
+	scripts := h.Scripts
+	for _, p := range h.Ports {
+		scripts = append(scripts[:len(scripts):len(scripts)], p.Scripts...)
+	}
+	for _, s := range scripts {
+		if ok, _ := path.Match(pattern, s.ID); ok {
+			return true
+		}
+	}
+	return false
+}
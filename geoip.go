@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// ************************************************************************************************
+// geoIPDB implements -geoip: the public addresses of the hosts are located with a MaxMind DB City
+// or Country database (GeoLite2-City.mmdb).
+type geoIPDB struct {
+	db *mmdbReader
+}
+
+// ************************************************************************************************
+// openGeoIP loads the -geoip database.
+func openGeoIP(path string) (*geoIPDB, error) {
+	db, err := openMMDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &geoIPDB{db: db}, nil
+}
+
+// Enrich implements hostEnricher. Private, loopback and link-local addresses are not looked up.
+func (g *geoIPDB) Enrich(h *Host) {
+	if h.Geo != nil {
+		return
+	}
+	ip, ok := publicAddr(h)
+	if !ok {
+		return
+	}
+	rec, _, err := g.db.lookup(ip)
+	if err != nil || rec == nil {
+		return
+	}
+	country := mmdbPath(rec, "country")
+	if country == nil {
+		country = mmdbPath(rec, "registered_country")
+	}
+	loc := &GeoLocation{}
+	loc.Country, _ = mmdbPath(country, "names", "en").(string)
+	loc.CountryCode, _ = mmdbPath(country, "iso_code").(string)
+	loc.City, _ = mmdbPath(rec, "city", "names", "en").(string)
+	lat, okLat := mmdbPath(rec, "location", "latitude").(float64)
+	lon, okLon := mmdbPath(rec, "location", "longitude").(float64)
+	if okLat && okLon {
+		loc.Coordinates = fmt.Sprintf("%.4f,%.4f", lat, lon)
+	}
+	if loc.Country != "" || loc.City != "" || loc.Coordinates != "" {
+		h.Geo = loc
+	}
+}
+
+// ************************************************************************************************
+// publicAddr returns the address of the host used for lookups (Host.IP) when it is a public one.
+func publicAddr(h *Host) (netip.Addr, bool) {
+	ip, err := netip.ParseAddr(h.IP())
+	if err != nil {
+		return ip, false
+	}
+	ip = ip.Unmap()
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return ip, false
+	}
+	return ip, true
+}
+
+// ************************************************************************************************
+// countryAggregator implements the country mode (-country): the hosts located by -geoip are
+// counted per country with their open ports. Hosts without a location (private addresses,
+// addresses missing from the database) are left out. Rows are sorted by descending host count.
+type countryAggregator struct {
+	countries map[string]*CountryInfo
+}
+
+// newCountryAggregator creates an empty country mode aggregator.
+func newCountryAggregator() *countryAggregator {
+	return &countryAggregator{countries: make(map[string]*CountryInfo)}
+}
+
+// Add implements Aggregator.
+func (a *countryAggregator) Add(h *Host) {
+	if h.Geo == nil || !h.IsUp() {
+		return
+	}
+	key := h.Geo.CountryCode + "\x00" + h.Geo.Country
+	c, ok := a.countries[key]
+	if !ok {
+		c = &CountryInfo{Country: h.Geo.Country, CountryCode: h.Geo.CountryCode}
+		a.countries[key] = c
+	}
+	c.Hosts++
+	for _, p := range h.Ports {
+		if p.State.State == "open" {
+			c.OpenPorts++
+		}
+	}
+}
+
+// Report implements Aggregator.
+func (a *countryAggregator) Report() *Report {
+	var countries []CountryInfo
+	for _, c := range a.countries {
+		countries = append(countries, *c)
+	}
+	sort.Slice(countries, func(i, j int) bool {
+		if countries[i].Hosts != countries[j].Hosts {
+			return countries[i].Hosts > countries[j].Hosts
+		}
+		return countries[i].Country < countries[j].Country
+	})
+
+	report := &Report{Headers: []string{"Count", "Country", "CountryCode", "OpenPorts"}, Records: countries}
+	for _, c := range countries {
+		report.Rows = append(report.Rows, []string{fmt.Sprint(c.Hosts), c.Country, c.CountryCode, fmt.Sprint(c.OpenPorts)})
+	}
+	return report
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// hecBatch is the number of events sent per HTTP Event Collector request.
+const hecBatch = 500
+
+// ************************************************************************************************
+// hecConfig holds the -splunk-* options of the HTTP Event Collector sink.
+type hecConfig struct {
+	// Events is "host" for one event per host or "port" for one event per selected port.
+	Events string
+
+	// Index and SourceType override the index of the token and the default sourcetype
+	// (nmap2csv:host or nmap2csv:port).
+	Index      string
+	SourceType string
+
+	// Insecure disables the verification of the collector certificate (self-signed by default).
+	Insecure bool
+
+	// filter selects the ports of the events and columns adds the -columns values to host events.
+	filter  *PortFilter
+	columns []hostColumn
+}
+
+// hecOptions returns the configuration of the -splunk-hec sink.
+func (o *Options) hecOptions() hecConfig {
+	return hecConfig{
+		Events:     o.SplunkEvents,
+		Index:      o.SplunkIndex,
+		SourceType: o.SplunkSourceType,
+		Insecure:   o.SplunkInsecure,
+		filter:     o.portFilter(),
+		columns:    o.columns,
+	}
+}
+
+// ************************************************************************************************
+// hecSink implements -splunk-hec: the hosts, or their ports, are sent as events to a Splunk HTTP
+// Event Collector. The events of a scan are timestamped with its start time, only known once the
+// scan is read, so they are buffered until its metadata arrives (or the next scan starts).
+type hecSink struct {
+	endpoint string
+	redacted string
+	token    string
+	cfg      hecConfig
+	client   *http.Client
+	source   string
+	pending  []hecEvent
+	sent     int
+	err      error
+}
+
+// hecEvent is the JSON envelope of an event in the collector protocol.
+type hecEvent struct {
+	Time       int64          `json:"time"`
+	Host       string         `json:"host,omitempty"`
+	Source     string         `json:"source,omitempty"`
+	SourceType string         `json:"sourcetype"`
+	Index      string         `json:"index,omitempty"`
+	Event      map[string]any `json:"event"`
+}
+
+// ************************************************************************************************
+// newHECSink creates the sink for the collector at rawURL. A URL without a path gets the
+// /services/collector/event endpoint. The token is read from the SPLUNK_HEC_TOKEN environment
+// variable, so it never appears in shell histories or process lists.
+func newHECSink(rawURL string, cfg hecConfig) (*hecSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q, expected https://host:8088", rawURL)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/services/collector/event"
+	}
+	token := os.Getenv("SPLUNK_HEC_TOKEN")
+	if token == "" {
+		return nil, errors.New("the SPLUNK_HEC_TOKEN environment variable is not set")
+	}
+	switch cfg.Events {
+	case "":
+		cfg.Events = "host"
+	case "host", "port":
+	default:
+		return nil, fmt.Errorf("unknown -splunk-events %q, expected host or port", cfg.Events)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Insecure {
+		slog.Warn("Splunk HEC certificate verification disabled", "url", u.Redacted())
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &hecSink{
+		endpoint: u.String(),
+		redacted: u.Redacted(),
+		token:    token,
+		cfg:      cfg,
+		client:   &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}, nil
+}
+
+// StartScan implements ScanStarter: the events of the previous scan are sent, stamped with the
+// import time when it had no start time.
+func (s *hecSink) StartScan(source string) {
+	s.flush(0)
+	s.source = source
+}
+
+// AddMeta implements MetaConsumer: the pending events get the scan start time and are sent.
+func (s *hecSink) AddMeta(m *ScanMeta) {
+	s.flush(m.Start)
+}
+
+// Add implements HostConsumer.
+func (s *hecSink) Add(h *Host) {
+	if !h.IsUp() {
+		return
+	}
+	ip := h.IP()
+	hostname := ""
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	if s.cfg.Events == "port" {
+		for i := range h.Ports {
+			p := &h.Ports[i]
+			if !s.cfg.filter.Selected(p) {
+				continue
+			}
+			s.queue("nmap2csv:port", ip, map[string]any{
+				"ip":       ip,
+				"hostname": hostname,
+				"port":     p.PortID,
+				"protocol": p.Protocol,
+				"state":    p.State.State,
+				"service":  p.Service.Name,
+				"product":  p.Service.Product,
+				"version":  p.Service.Version,
+			})
+		}
+		return
+	}
+	mac := hostAddr(h, "mac")
+	event := map[string]any{
+		"ip":       ip,
+		"hostname": hostname,
+		"mac":      mac.Addr,
+		"vendor":   mac.Vendor,
+		"status":   "up",
+	}
+	ports, open := []string{}, 0
+	for i := range h.Ports {
+		p := &h.Ports[i]
+		if p.State.State == "open" {
+			open++
+		}
+		if s.cfg.filter.Selected(p) {
+			ports = append(ports, fmt.Sprintf("%d/%s", p.PortID, p.Protocol))
+		}
+	}
+	event["ports"] = ports
+	event["count_open"] = open
+	for _, c := range s.cfg.columns {
+		event[c.Name] = c.value(h)
+	}
+	s.queue("nmap2csv:host", ip, event)
+}
+
+// queue buffers an event until its scan time is known.
+func (s *hecSink) queue(sourceType, ip string, event map[string]any) {
+	if s.cfg.SourceType != "" {
+		sourceType = s.cfg.SourceType
+	}
+	s.pending = append(s.pending, hecEvent{Host: ip, Source: s.source, SourceType: sourceType, Index: s.cfg.Index, Event: event})
+}
+
+// flush sends the pending events, timestamped with start, or the current time when it is 0.
+func (s *hecSink) flush(start int64) {
+	if start == 0 {
+		start = time.Now().Unix()
+	}
+	for i := range s.pending {
+		s.pending[i].Time = start
+	}
+	for len(s.pending) > 0 && s.err == nil {
+		n := min(len(s.pending), hecBatch)
+		if s.err = s.post(s.pending[:n]); s.err == nil {
+			s.sent += n
+		}
+		s.pending = s.pending[n:]
+	}
+	s.pending = nil
+}
+
+// post sends a batch of events, concatenated in one request as the protocol allows.
+func (s *hecSink) post(events []hecEvent) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Close implements hostSink.
+func (s *hecSink) Close() error {
+	s.flush(0)
+	if s.err != nil {
+		return s.err
+	}
+	slog.Info("Events sent to Splunk", "url", s.redacted, "events", s.sent)
+	return nil
+}
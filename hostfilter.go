@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ************************************************************************************************
+// hostFilter selects the hosts passed to the modes and exports, before any of them runs.
+// The zero value keeps every host.
+type hostFilter struct {
+	// includeNets, when not empty, keeps only the hosts with an address in one of the networks.
+	includeNets []netip.Prefix
+
+	// excludeNets drops the hosts with an address in one of the networks.
+	excludeNets []netip.Prefix
+
+	// hostname, when set, keeps only the hosts with a hostname matching the expression.
+	hostname *regexp.Regexp
+
+	// expr, when set, keeps only the hosts satisfying the -filter expression.
+	expr *hostExpr
+
+	// minOSAccuracy, when not 0, keeps only the hosts whose best OS match has at least this accuracy.
+	minOSAccuracy int
+}
+
+// ************************************************************************************************
+// Match reports whether the host is kept by the filter.
+func (f *hostFilter) Match(h *Host) bool {
+	if f.hostname != nil && !f.matchHostname(h) {
+		return false
+	}
+	if f.expr != nil && !f.expr.Match(h) {
+		return false
+	}
+	if f.minOSAccuracy > 0 {
+		if m := h.BestOSMatch(); m == nil || m.Accuracy < f.minOSAccuracy {
+			return false
+		}
+	}
+	if len(f.includeNets) == 0 && len(f.excludeNets) == 0 {
+		return true
+	}
+	included := len(f.includeNets) == 0
+	for _, a := range h.Addresses {
+		if a.AddrType != "ipv4" && a.AddrType != "ipv6" {
+			continue
+		}
+		ip, err := netip.ParseAddr(a.Addr)
+		if err != nil {
+			continue
+		}
+		ip = ip.Unmap()
+		if containsAddr(f.excludeNets, ip) {
+			return false
+		}
+		included = included || containsAddr(f.includeNets, ip)
+	}
+	return included
+}
+
+// String describes the active parts of the filter in the flag=value form of PortFilter.String,
+// empty when every host is kept.
+func (f *hostFilter) String() string {
+	var parts []string
+	for _, nets := range []struct {
+		flag string
+		nets []netip.Prefix
+	}{{"include-net", f.includeNets}, {"exclude-net", f.excludeNets}} {
+		if len(nets.nets) > 0 {
+			list := make([]string, len(nets.nets))
+			for i, n := range nets.nets {
+				list[i] = n.String()
+			}
+			parts = append(parts, nets.flag+"="+strings.Join(list, ","))
+		}
+	}
+	if f.hostname != nil {
+		parts = append(parts, "wherehostname="+f.hostname.String())
+	}
+	if f.expr != nil {
+		parts = append(parts, "filter="+f.expr.src)
+	}
+	if f.minOSAccuracy > 0 {
+		parts = append(parts, "min-os-accuracy="+strconv.Itoa(f.minOSAccuracy))
+	}
+	return strings.Join(parts, " ")
+}
+
+// matchHostname reports whether one of the hostnames of the host matches the hostname expression.
+func (f *hostFilter) matchHostname(h *Host) bool {
+	for _, n := range h.Hostnames {
+		if f.hostname.MatchString(n.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAddr reports whether one of the networks contains ip.
+func containsAddr(nets []netip.Prefix, ip netip.Addr) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ************************************************************************************************
+// parseNets parses a comma-separated list of CIDR networks or single IP addresses.
+func parseNets(flagName, list string) ([]netip.Prefix, error) {
+	var nets []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -%s entry %q: expected a CIDR network or an IP address", flagName, entry)
+			}
+			nets = append(nets, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+		n, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -%s entry %q: expected a CIDR network or an IP address", flagName, entry)
+		}
+		nets = append(nets, n.Masked())
+	}
+	return nets, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ************************************************************************************************
+// influxExporter is a HostConsumer writing the hosts and their selected ports (open ones by
+// default) as InfluxDB line protocol, for Telegraf or `influx write`: one nmap_host point per up
+// host and one nmap_port point per port, timestamped with the start time of their scan. That time
+// is only known once the scan is read, so the points of a scan are buffered until its metadata
+// arrives (or the next scan starts).
+type influxExporter struct {
+	f       *os.File
+	w       *bufio.Writer
+	filter  *PortFilter
+	source  string
+	pending []string
+	err     error
+}
+
+// ************************************************************************************************
+// newInfluxExporter creates path, receiving the points of the ports selected by filter.
+func newInfluxExporter(path string, filter *PortFilter) (*influxExporter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &influxExporter{f: f, w: bufio.NewWriter(f), filter: filter}, nil
+}
+
+// StartScan implements ScanStarter: the points of the previous scan are written, stamped with the
+// import time when it had no start time.
+func (e *influxExporter) StartScan(source string) {
+	e.flush(0)
+	e.source = filepath.Base(source)
+}
+
+// AddMeta implements MetaConsumer: the pending points get the scan start time and are written.
+func (e *influxExporter) AddMeta(m *ScanMeta) {
+	e.flush(m.Start)
+}
+
+// Add implements HostConsumer.
+func (e *influxExporter) Add(h *Host) {
+	if !h.IsUp() {
+		return
+	}
+	hostname := ""
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	tags := influxTags([][2]string{{"host", h.IP()}, {"hostname", hostname}, {"source", e.source}})
+	open := 0
+	for i := range h.Ports {
+		p := &h.Ports[i]
+		if p.State.State == "open" {
+			open++
+		}
+		if !e.filter.Selected(p) {
+			continue
+		}
+		portTags := influxTags([][2]string{
+			{"port", strconv.Itoa(p.PortID)},
+			{"protocol", p.Protocol},
+			{"state", p.State.State},
+			{"service", p.Service.Name},
+		})
+		fields := []string{"open=" + influxBool(p.State.State == "open")}
+		for _, kv := range [][2]string{{"product", p.Service.Product}, {"version", p.Service.Version}} {
+			if kv[1] != "" {
+				fields = append(fields, kv[0]+"="+influxString(kv[1]))
+			}
+		}
+		e.pending = append(e.pending, "nmap_port"+tags+portTags+" "+strings.Join(fields, ","))
+	}
+	e.pending = append(e.pending, fmt.Sprintf("nmap_host%s up=1i,open_ports=%di", tags, open))
+}
+
+// flush writes the pending points, timestamped with start, or the current time when it is 0.
+func (e *influxExporter) flush(start int64) {
+	if start == 0 {
+		start = time.Now().Unix()
+	}
+	// Line protocol timestamps are in nanoseconds unless the writer is told otherwise.
+	ts := " " + strconv.FormatInt(start, 10) + "000000000\n"
+	for _, line := range e.pending {
+		if e.err != nil {
+			break
+		}
+		_, e.err = e.w.WriteString(line + ts)
+	}
+	e.pending = nil
+}
+
+// Close writes the pending points and closes the file. It returns the first error met while
+// writing.
+func (e *influxExporter) Close() error {
+	e.flush(0)
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	if err := e.f.Close(); e.err == nil {
+		e.err = err
+	}
+	return e.err
+}
+
+// ************************************************************************************************
+// influxTags renders the non-empty tags as ",key=value" pairs. InfluxDB rejects empty tag values,
+// so those tags are left out.
+func influxTags(tags [][2]string) string {
+	var b strings.Builder
+	for _, kv := range tags {
+		if kv[1] != "" {
+			b.WriteString("," + kv[0] + "=" + influxTagEscaper.Replace(kv[1]))
+		}
+	}
+	return b.String()
+}
+
+// influxTagEscaper escapes the characters separating the tags of a point.
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `)
+
+// influxString quotes a string field value.
+func influxString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ").Replace(s) + `"`
+}
+
+// influxBool renders a boolean as an integer field, which dashboards can sum.
+func influxBool(b bool) string {
+	if b {
+		return "1i"
+	}
+	return "0i"
+}
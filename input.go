@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/1mm0rt41PC/nmap2csv/pkg/nmapparse"
+)
+
+// stdinPath is the input name that designates standard input.
+const stdinPath = "-"
+
+// ************************************************************************************************
+// loadScan streams a single scan file through fn, in any format nmapparse.Stream understands. The
+// special path "-" reads from stdin. Scan-level information is passed to meta, which may be nil.
+func loadScan(path string, fn HostHandler, meta MetaHandler) (int, error) {
+	return (&Options{}).loadScan(path, fn, meta)
+}
+
+// loadScan streams a scan file as the loadScan function does, reading "-" from the stdin of the
+// options, os.Stdin unless replaced. With -lenient, a truncated scan is only reported with a
+// warning, its complete hosts having been delivered.
+func (o *Options) loadScan(path string, fn HostHandler, meta MetaHandler) (int, error) {
+	var count int
+	var err error
+	if path == stdinPath {
+		in := o.stdin
+		if in == nil {
+			in = os.Stdin
+		}
+		count, err = nmapparse.Stream(in, fn, meta)
+	} else {
+		f, openErr := os.Open(path)
+		if openErr != nil {
+			return 0, openErr
+		}
+		defer f.Close()
+		count, err = nmapparse.Stream(f, fn, meta)
+	}
+	if errors.Is(err, nmapparse.ErrTruncated) {
+		if !o.Lenient {
+			return count, fmt.Errorf("%w (use -lenient to keep its complete hosts)", err)
+		}
+		slog.Warn("Scan truncated, keeping the complete hosts", "file", path, "hosts", count, "err", err)
+		return count, nil
+	}
+	return count, err
+}
+
+// ************************************************************************************************
+// expandInputs resolves the list of scan files given on the command line.
+// Every entry may be a plain path or a glob pattern (e.g. "scans/*.xml"); patterns are expanded
+// with filepath.Glob and sorted, while "-" designates stdin and is kept as is. A directory stands for
+// the files it directly contains. A pattern that matches nothing is reported as an error so
+// typos do not silently produce empty reports. Duplicate paths are read only once.
+func expandInputs(patterns []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		matches := []string{pattern}
+		if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+			if matches, err = dirFiles(pattern); err != nil {
+				return nil, err
+			}
+		} else if pattern != stdinPath && strings.ContainsAny(pattern, "*?[") {
+			var err error
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no file matches %q", pattern)
+			}
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no input file given")
+	}
+	return files, nil
+}
+
+// ************************************************************************************************
+// dirFiles returns the sorted regular files of dir, hidden files excluded.
+func dirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+// ************************************************************************************************
+// stdinIsPiped reports whether standard input is connected to a pipe or file rather than a terminal,
+// meaning a scan can be read from it when no input file was given.
+func stdinIsPiped() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice == 0
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kafka protocol constants: the API keys and versions used, supported by every broker since 1.0,
+// including 4.x which dropped the older versions.
+const (
+	kafkaProduce         = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadata        = 3
+	kafkaMetadataVersion = 4
+)
+
+// kafkaBatch is the number of buffered messages triggering a produce request, and kafkaTimeout
+// bounds the connections, every request and the replication of a batch (acks=all).
+const (
+	kafkaBatch   = 500
+	kafkaTimeout = 30 * time.Second
+)
+
+// kafkaErrors names the broker error codes worth explaining; the others are reported by number.
+var kafkaErrors = map[int16]string{
+	2:  "corrupt message",
+	3:  "unknown topic or partition",
+	5:  "leader not available",
+	6:  "not leader for partition",
+	7:  "request timed out",
+	10: "message too large",
+	19: "not enough replicas",
+	29: "topic authorization failed",
+	35: "unsupported version",
+	87: "invalid record",
+}
+
+// castagnoli is the CRC-32C table of the record batch checksums.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ************************************************************************************************
+// kafkaSink implements -kafka: every host of the hostname mode (the hosts with a port selected by
+// -whereport...) is published as a JSON message, its -json record, to a Kafka topic. Messages are
+// keyed by host address and partitioned like the Java client does (murmur2), so the messages of a
+// host always go to the same partition.
+//
+// The producer is a minimal, dependency-free implementation of the Kafka protocol: plaintext
+// connections only (no TLS, no SASL), uncompressed record batches, acks=all, no idempotence nor
+// retries. The topic must exist.
+type kafkaSink struct {
+	bootstrap string
+	topic     string
+	hosts     *hostnameAggregator
+
+	// brokers maps the node ids of the cluster to their address, and leaders the partitions of the
+	// topic to the node id of their leader.
+	brokers map[int32]string
+	leaders []int32
+	conns   map[int32]*kafkaConn
+
+	pending  map[int32][]kafkaRecord
+	buffered int
+	sent     int
+	err      error
+}
+
+// kafkaRecord is a message waiting to be produced.
+type kafkaRecord struct {
+	key, value []byte
+	time       time.Time
+}
+
+// ************************************************************************************************
+// newKafkaSink connects to the brokers of spec, "host1:9092,host2:9092/topic", and looks up the
+// leaders of the partitions of the topic. Hosts are rendered by hosts.
+func newKafkaSink(spec string, hosts *hostnameAggregator) (*kafkaSink, error) {
+	i := strings.LastIndex(spec, "/")
+	if i <= 0 || i == len(spec)-1 {
+		return nil, fmt.Errorf("invalid value %q, expected broker:9092[,broker:9092...]/topic", spec)
+	}
+	s := &kafkaSink{
+		topic:     spec[i+1:],
+		hosts:     hosts,
+		conns:     make(map[int32]*kafkaConn),
+		pending:   make(map[int32][]kafkaRecord),
+		bootstrap: spec[:i],
+	}
+	var errs []error
+	for _, addr := range strings.Split(spec[:i], ",") {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "9092")
+		}
+		err := s.loadMetadata(addr)
+		if err == nil {
+			return s, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// loadMetadata asks the broker at addr for the brokers of the cluster and the partition leaders of
+// the topic.
+func (s *kafkaSink) loadMetadata(addr string) error {
+	c, err := dialKafka(addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	var req kafkaEncoder
+	req.int32(1)
+	req.string(s.topic)
+	req.int8(0) // allow_auto_topic_creation
+	resp, err := c.roundTrip(kafkaMetadata, kafkaMetadataVersion, req)
+	if err != nil {
+		return err
+	}
+
+	d := &kafkaDecoder{buf: resp}
+	d.int32() // throttle_time_ms
+	s.brokers = make(map[int32]string)
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id, host, port := d.int32(), d.string(), d.int32()
+		d.string() // rack
+		s.brokers[id] = net.JoinHostPort(host, fmt.Sprint(port))
+	}
+	d.string() // cluster_id
+	d.int32()  // controller_id
+	type partition struct{ index, leader int32 }
+	var parts []partition
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		code, name := d.int16(), d.string()
+		d.int8() // is_internal
+		var topicParts []partition
+		for m := d.int32(); m > 0 && d.err == nil; m-- {
+			d.int16() // partition error_code, the leader tells whether it can be used
+			topicParts = append(topicParts, partition{index: d.int32(), leader: d.int32()})
+			d.int32Array() // replica_nodes
+			d.int32Array() // isr_nodes
+		}
+		if name != s.topic || d.err != nil {
+			continue
+		}
+		if code != 0 {
+			return fmt.Errorf("topic %q: %s", s.topic, kafkaError(code))
+		}
+		parts = topicParts
+	}
+	if d.err != nil {
+		return fmt.Errorf("invalid metadata response: %w", d.err)
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("topic %q: %s", s.topic, kafkaError(3))
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].index < parts[j].index })
+	s.leaders = make([]int32, len(parts))
+	for i, p := range parts {
+		if _, ok := s.brokers[p.leader]; !ok || p.index != int32(i) {
+			return fmt.Errorf("topic %q partition %d: %s", s.topic, p.index, kafkaError(5))
+		}
+		s.leaders[i] = p.leader
+	}
+	return nil
+}
+
+// Add implements HostConsumer.
+func (s *kafkaSink) Add(h *Host) {
+	if s.err != nil || !h.IsUp() {
+		return
+	}
+	info, ok := s.hosts.hostInfo(h)
+	if !ok {
+		return
+	}
+	value, err := json.Marshal(info)
+	if err != nil {
+		s.err = err
+		return
+	}
+	key := []byte(h.IP())
+	partition := int32(uint32(murmur2(key))&0x7fffffff) % int32(len(s.leaders))
+	s.pending[partition] = append(s.pending[partition], kafkaRecord{key: key, value: value, time: time.Now()})
+	if s.buffered++; s.buffered >= kafkaBatch {
+		s.flush()
+	}
+}
+
+// flush produces the buffered messages, with one request per partition leader.
+func (s *kafkaSink) flush() {
+	byLeader := make(map[int32][]int32)
+	for partition := range s.pending {
+		leader := s.leaders[partition]
+		byLeader[leader] = append(byLeader[leader], partition)
+	}
+	for leader, partitions := range byLeader {
+		if s.err != nil {
+			break
+		}
+		s.err = s.produce(leader, partitions)
+	}
+	s.pending = make(map[int32][]kafkaRecord)
+	s.buffered = 0
+}
+
+// produce sends the pending messages of partitions to their leader and checks the result of
+// every partition.
+func (s *kafkaSink) produce(leader int32, partitions []int32) error {
+	c, ok := s.conns[leader]
+	if !ok {
+		var err error
+		if c, err = dialKafka(s.brokers[leader]); err != nil {
+			return err
+		}
+		s.conns[leader] = c
+	}
+	var req kafkaEncoder
+	req.int16(-1) // transactional_id
+	req.int16(-1) // acks: all in-sync replicas
+	req.int32(int32(kafkaTimeout / time.Millisecond))
+	req.int32(1)
+	req.string(s.topic)
+	req.int32(int32(len(partitions)))
+	count := 0
+	for _, p := range partitions {
+		batch := recordBatch(s.pending[p])
+		req.int32(p)
+		req.int32(int32(len(batch)))
+		req = append(req, batch...)
+		count += len(s.pending[p])
+	}
+	resp, err := c.roundTrip(kafkaProduce, kafkaProduceVersion, req)
+	if err != nil {
+		return err
+	}
+
+	d := &kafkaDecoder{buf: resp}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.string() // topic
+		for m := d.int32(); m > 0 && d.err == nil; m-- {
+			index, code := d.int32(), d.int16()
+			d.int64() // base_offset
+			d.int64() // log_append_time_ms
+			if code != 0 && d.err == nil {
+				return fmt.Errorf("partition %d: %s", index, kafkaError(code))
+			}
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("invalid produce response: %w", d.err)
+	}
+	s.sent += count
+	return nil
+}
+
+// Close implements hostSink.
+func (s *kafkaSink) Close() error {
+	if s.err == nil {
+		s.flush()
+	}
+	for _, c := range s.conns {
+		c.Close()
+	}
+	if s.err != nil {
+		return s.err
+	}
+	slog.Info("Messages published to Kafka", "brokers", s.bootstrap, "topic", s.topic, "messages", s.sent)
+	return nil
+}
+
+// ************************************************************************************************
+// recordBatch encodes records as an uncompressed record batch (message format v2), the first
+// record having offset delta 0.
+func recordBatch(records []kafkaRecord) []byte {
+	first, last := records[0].time.UnixMilli(), records[0].time.UnixMilli()
+	for _, r := range records {
+		last = max(last, r.time.UnixMilli())
+	}
+
+	// The checksum covers everything from the attributes to the end of the batch.
+	var body kafkaEncoder
+	body.int16(0) // attributes: no compression, create time
+	body.int32(int32(len(records) - 1))
+	body.int64(first)
+	body.int64(last)
+	body.int64(-1) // producer_id
+	body.int16(-1) // producer_epoch
+	body.int32(-1) // base_sequence
+	body.int32(int32(len(records)))
+	for i, r := range records {
+		var rec kafkaEncoder
+		rec.int8(0) // attributes
+		rec.varint(r.time.UnixMilli() - first)
+		rec.varint(int64(i))
+		rec.varint(int64(len(r.key)))
+		rec = append(rec, r.key...)
+		rec.varint(int64(len(r.value)))
+		rec = append(rec, r.value...)
+		rec.varint(0) // headers
+		body.varint(int64(len(rec)))
+		body = append(body, rec...)
+	}
+
+	var batch kafkaEncoder
+	batch.int64(0) // base_offset, assigned by the broker
+	batch.int32(int32(len(body) + 9))
+	batch.int32(-1) // partition_leader_epoch
+	batch.int8(2)   // magic
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(body, castagnoli))
+	return append(batch, body...)
+}
+
+// murmur2 is the hash of the Java client default partitioner, so that keyed messages land on the
+// same partitions whichever client produced them.
+func murmur2(data []byte) int32 {
+	const m, r = 0x5bd1e995, 24
+	n := len(data)
+	h := uint32(0x9747b28c) ^ uint32(n)
+	for i := 0; i+4 <= n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[n&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// kafkaError describes a broker error code.
+func kafkaError(code int16) string {
+	if msg, ok := kafkaErrors[code]; ok {
+		return fmt.Sprintf("%s (error %d)", msg, code)
+	}
+	return fmt.Sprintf("error %d", code)
+}
+
+// ************************************************************************************************
+// kafkaConn is a connection to a broker, sending one request at a time.
+type kafkaConn struct {
+	net.Conn
+	r           *bufio.Reader
+	correlation int32
+}
+
+// dialKafka connects to the broker at addr.
+func dialKafka(addr string) (*kafkaConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, kafkaTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaConn{Conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// roundTrip sends a request with the v1 header and returns the body of its response.
+func (c *kafkaConn) roundTrip(apiKey, version int16, body []byte) ([]byte, error) {
+	c.correlation++
+	var req kafkaEncoder
+	req.int32(0) // size, set below
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(c.correlation)
+	req.string("nmap2csv")
+	req = append(req, body...)
+	binary.BigEndian.PutUint32(req, uint32(len(req)-4))
+
+	// The produce requests wait for the replication, up to kafkaTimeout.
+	c.SetDeadline(time.Now().Add(2 * kafkaTimeout))
+	if _, err := c.Write(req); err != nil {
+		return nil, err
+	}
+	var header [8]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	if size < 4 || size > 64<<20 {
+		return nil, fmt.Errorf("invalid response size %d", size)
+	}
+	if id := int32(binary.BigEndian.Uint32(header[4:])); id != c.correlation {
+		return nil, fmt.Errorf("response %d to request %d", id, c.correlation)
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ************************************************************************************************
+// kafkaEncoder appends the big-endian primitives of the Kafka protocol.
+type kafkaEncoder []byte
+
+func (e *kafkaEncoder) int8(v int8)   { *e = append(*e, byte(v)) }
+func (e *kafkaEncoder) int16(v int16) { *e = binary.BigEndian.AppendUint16(*e, uint16(v)) }
+func (e *kafkaEncoder) int32(v int32) { *e = binary.BigEndian.AppendUint32(*e, uint32(v)) }
+func (e *kafkaEncoder) int64(v int64) { *e = binary.BigEndian.AppendUint64(*e, uint64(v)) }
+
+// varint appends a zigzag-encoded variable-length integer, as used inside record batches.
+func (e *kafkaEncoder) varint(v int64) { *e = binary.AppendVarint(*e, v) }
+
+// string appends a string prefixed by its int16 length.
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	*e = append(*e, s...)
+}
+
+// ************************************************************************************************
+// kafkaDecoder reads the big-endian primitives of the Kafka protocol. Reading past the end sets err
+// and returns zero values, so a response is checked once decoded.
+type kafkaDecoder struct {
+	buf []byte
+	err error
+}
+
+// next returns the next n bytes, nil past the end.
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil || n < 0 || n > len(d.buf) {
+		if d.err == nil {
+			d.err = io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a string prefixed by its int16 length, -1 for null.
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n == -1 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+// int32Array skips an array of int32.
+func (d *kafkaDecoder) int32Array() {
+	n := d.int32()
+	if n > 0 {
+		d.next(4 * int(n))
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// ************************************************************************************************
+// parseLogLevel converts a -log-level flag value (debug, info, warn, error) into a slog.Level.
+// The comparison is case-insensitive and "warning" is accepted as an alias of "warn".
+func parseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q (expected debug|info|warn|error)", s)
+}
+
+// ************************************************************************************************
+// setupLogger installs the default slog logger at the requested level.
+// Log lines go to stderr, or are appended to logFile when it is not empty; the returned closer
+// releases that file. When structured is set, records are emitted as JSON objects instead of
+// key=value text. Messages emitted through the standard log package are routed through the
+// same handler.
+func setupLogger(level, logFile string, structured bool) (io.Closer, error) {
+	lvl, err := parseLogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	var out io.WriteCloser = nopCloser{os.Stderr}
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open log file: %w", err)
+		}
+		out = f
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler = slog.NewTextHandler(out, opts)
+	if structured {
+		handler = slog.NewJSONHandler(out, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	return out, nil
+}
+
+// ************************************************************************************************
+// nopCloser wraps a writer that must not be closed by the logger (stderr).
+type nopCloser struct {
+	io.Writer
+}
+
+// Close implements io.Closer and does nothing.
+func (nopCloser) Close() error { return nil }
+
+// ************************************************************************************************
+// failure logs msg at error level with the given key/value attributes and returns the exit code of
+// a failed run.
+func failure(msg string, args ...any) int {
+	slog.Error(msg, args...)
+	return 1
+}
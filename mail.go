@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// mailTimeout bounds the whole SMTP conversation of -mail-to.
+const mailTimeout = 2 * time.Minute
+
+// ************************************************************************************************
+// mailConfig is the configuration of the -mail-to report delivery.
+type mailConfig struct {
+	// Server is the SMTP server, as host:port. Port 465 uses implicit TLS; on other ports the
+	// connection is upgraded with STARTTLS when the server offers it.
+	Server string
+
+	From     string
+	To       []string
+	User     string
+	Password string
+	Subject  string
+
+	// Attach is the format of the attached reports: csv or html.
+	Attach string
+}
+
+// mailAttachment is a file attached to the report mail.
+type mailAttachment struct {
+	name    string
+	mime    string
+	content []byte
+}
+
+// ************************************************************************************************
+// mailOptions returns the configuration of the -mail-to delivery. The password comes from
+// -mail-password or, to keep it out of shell histories and process lists, SMTP_PASSWORD.
+func (o *Options) mailOptions() mailConfig {
+	password := o.MailPassword
+	if password == "" {
+		password = os.Getenv("SMTP_PASSWORD")
+	}
+	var to []string
+	for _, addr := range strings.Split(o.MailTo, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	return mailConfig{
+		Server:   o.MailSMTP,
+		From:     o.MailFrom,
+		To:       to,
+		User:     o.MailUser,
+		Password: password,
+		Subject:  o.MailSubject,
+		Attach:   o.MailAttach,
+	}
+}
+
+// ************************************************************************************************
+// mailReports sends the reports of the selected modes to the -mail-to recipients, attached as CSV
+// or HTML files named after their -outdir file, with the summary mode report as message body.
+func (o *Options) mailReports(selected []mode, reports []*Report, summary *Report) error {
+	cfg := o.mailOptions()
+	var attachments []mailAttachment
+	var names []string
+	for i, report := range reports {
+		var buf bytes.Buffer
+		a := mailAttachment{name: selected[i].File + ".csv", mime: "text/csv; charset=utf-8"}
+		if cfg.Attach == "html" {
+			a.name, a.mime = selected[i].File+".html", "text/html; charset=utf-8"
+			writeHTMLReport(&buf, selected[i].Name, report)
+		} else if err := report.WriteCSV(&buf, o.render); err != nil {
+			return err
+		}
+		a.content = buf.Bytes()
+		attachments = append(attachments, a)
+		names = append(names, fmt.Sprintf("%s (%d rows)", a.name, len(report.Rows)))
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "Scan report generated by nmap2csv on %s.\n\n", time.Now().Format("2006-01-02 15:04 MST"))
+	fmt.Fprintf(&body, "Attached: %s.\n\n", strings.Join(names, ", "))
+	if err := summary.WriteTable(&body, RenderOptions{}); err != nil {
+		return err
+	}
+	msg, err := buildMail(cfg, body.String(), attachments)
+	if err != nil {
+		return err
+	}
+	if err := sendMail(cfg, msg); err != nil {
+		return err
+	}
+	slog.Info("Report mailed", "to", strings.Join(cfg.To, ","), "attachments", len(attachments))
+	return nil
+}
+
+// ************************************************************************************************
+// buildMail returns the MIME message carrying body as text and the attachments.
+func buildMail(cfg mailConfig, body string, attachments []mailAttachment) ([]byte, error) {
+	var msg bytes.Buffer
+	mw := multipart.NewWriter(&msg)
+	id := make([]byte, 12)
+	rand.Read(id)
+	header := []string{
+		"From: " + cfg.From,
+		"To: " + strings.Join(cfg.To, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", cfg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		fmt.Sprintf("Message-ID: <%x@nmap2csv>", id),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/mixed; boundary=" + mw.Boundary(),
+	}
+	msg.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(part, []byte(body))
+	for _, a := range attachments {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.mime},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, a.content)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// writeBase64 writes data base64 encoded, in the 76 character lines required by MIME.
+func writeBase64(w io.Writer, data []byte) {
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		io.WriteString(w, enc[:76]+"\r\n")
+		enc = enc[76:]
+	}
+	io.WriteString(w, enc+"\r\n")
+}
+
+// ************************************************************************************************
+// sendMail delivers msg through the SMTP server of cfg. Authentication is only attempted over TLS
+// (or to localhost), so the password is never sent in clear text.
+func sendMail(cfg mailConfig, msg []byte) error {
+	host, port, err := net.SplitHostPort(cfg.Server)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP server %q, expected host:port", cfg.Server)
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	if port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", cfg.Server, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", cfg.Server)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(mailTimeout))
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if port != "465" {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.User != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.User, cfg.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, to := range cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// ************************************************************************************************
+// writeHTMLReport renders report as a standalone HTML page titled after its mode, readable in a
+// browser or a mail client.
+func writeHTMLReport(w io.Writer, name string, report *Report) {
+	title := html.EscapeString("nmap2csv " + name + " report")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s</title>\n", title)
+	io.WriteString(w, "<style>body{font-family:sans-serif}table{border-collapse:collapse}"+
+		"th,td{border:1px solid #ccc;padding:4px 8px;text-align:left}th{background:#eee}</style>\n")
+	fmt.Fprintf(w, "</head><body>\n<h1>%s</h1>\n<table>\n<tr>", title)
+	for _, h := range report.Headers {
+		fmt.Fprintf(w, "<th>%s</th>", html.EscapeString(h))
+	}
+	io.WriteString(w, "</tr>\n")
+	for _, row := range report.Rows {
+		io.WriteString(w, "<tr>")
+		for _, cell := range row {
+			fmt.Fprintf(w, "<td>%s</td>", html.EscapeString(cell))
+		}
+		io.WriteString(w, "</tr>\n")
+	}
+	io.WriteString(w, "</table>\n</body></html>\n")
+}
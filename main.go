@@ -1,315 +1,496 @@
 package main
 
 import (
-	"encoding/csv"
-	"encoding/xml"
-	"flag"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"os"
-	"sort"
-	"strconv"
+	"slices"
 	"strings"
-	"text/tabwriter"
 )
 
 // ************************************************************************************************
-// NmapRun represents the root structure of an Nmap XML scan output.
-// It contains a collection of all scanned hosts with their associated information.
-type NmapRun struct {
-	Hosts []Host `xml:"host"`
+// ServiceInfo holds the number of hosts running one service/product/version combination, for the
+// service mode.
+type ServiceInfo struct {
+	// Service is the service name (e.g. "ssh").
+	Service string `json:"service"`
+
+	// Product and Version are the detected software and its version (e.g. "OpenSSH", "8.9p1").
+	Product string `json:"product"`
+	Version string `json:"version"`
+
+	// Count is the number of hosts with an open port running this combination.
+	Count int `json:"count"`
 }
 
 // ************************************************************************************************
-// Host represents a single scanned host in the Nmap output.
-// It contains network addresses, hostnames, and open ports discovered during the scan.
-type Host struct {
-	Addresses []Address  `xml:"address"`
-	Hostnames []Hostname `xml:"hostnames>hostname"`
-	Ports     []Port     `xml:"ports>port"`
+// ServiceDetail holds the version detection results of one open port, for the service detail mode.
+type ServiceDetail struct {
+	// Hostname is the first resolved DNS hostname of the host.
+	Hostname string `json:"hostname"`
+
+	// IP is the IPv4 address of the host, or its IPv6 address when it has none.
+	IP string `json:"ip"`
+
+	// Port and Protocol identify the port.
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+
+	// State is the port state, set when -state selects other states than open.
+	State string `json:"state,omitempty"`
+
+	// Service, Product, Version, ExtraInfo and OSType are the <service> attributes.
+	Service   string `json:"service"`
+	Product   string `json:"product"`
+	Version   string `json:"version"`
+	ExtraInfo string `json:"extrainfo"`
+	OSType    string `json:"ostype"`
 }
 
 // ************************************************************************************************
-// Address represents a network address associated with a host.
-// This can be an IPv4, IPv6, or MAC address with optional vendor information.
-type Address struct {
-	// Addr is the actual address value (IP or MAC).
-	Addr string `xml:"addr,attr"`
+// BannerInfo holds the raw data of one port returned by a service, for the banner mode.
+type BannerInfo struct {
+	// Hostname is the first resolved DNS hostname of the host.
+	Hostname string `json:"hostname"`
 
-	// AddrType indicates the type of address (ipv4, ipv6, mac).
-	AddrType string `xml:"addrtype,attr"`
+	// IP is the IPv4 address of the host, or its IPv6 address when it has none.
+	IP string `json:"ip"`
 
-	// Vendor is the manufacturer name for MAC addresses (empty for IP addresses).
-	Vendor string `xml:"vendor,attr"`
+	// Port and Protocol identify the port.
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+
+	// Service is the service name, a guess from the port number for unrecognised services.
+	Service string `json:"service"`
+
+	// Banner is the output of the banner NSE script.
+	Banner string `json:"banner"`
+
+	// Fingerprint is the service fingerprint of an unrecognised service.
+	Fingerprint string `json:"servicefp"`
 }
 
 // ************************************************************************************************
-// Hostname represents a DNS hostname associated with a host.
-type Hostname struct {
-	// Name is the resolved hostname.
-	Name string `xml:"name,attr"`
+// WebInfo holds one web service, for the web mode.
+type WebInfo struct {
+	// Hostname is the first resolved DNS hostname of the host.
+	Hostname string `json:"hostname"`
+
+	// IP is the IPv4 address of the host, or its IPv6 address when it has none.
+	IP string `json:"ip"`
+
+	// Port and Protocol identify the port.
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+
+	// Service and Product are the service name and the product detected by version detection.
+	Service string `json:"service"`
+	Product string `json:"product"`
+
+	// URL is the address of the service, https:// for the services wrapped in SSL/TLS.
+	URL string `json:"url"`
+
+	// Title is the page title found by the http-title NSE script.
+	Title string `json:"title"`
 }
 
 // ************************************************************************************************
-// Port represents a single port on a scanned host.
-// It includes the port number, protocol, state, and service information.
-type Port struct {
-	// Protocol is the transport protocol (tcp, udp, sctp).
-	Protocol string `xml:"protocol,attr"`
+// OSInfo holds the number of hosts whose best OS detection match is one operating system, for the
+// OS mode.
+type OSInfo struct {
+	// Name is the operating system name.
+	Name string `json:"os"`
+
+	// Accuracy is the highest accuracy, in percent, with which a host matched this OS.
+	Accuracy int `json:"accuracy"`
+
+	// Count is the number of hosts matching this OS.
+	Count int `json:"count"`
+}
+
+// ************************************************************************************************
+// ScriptInfo holds one NSE script result, for the script mode.
+type ScriptInfo struct {
+	// Hostname is the first resolved DNS hostname of the host.
+	Hostname string `json:"hostname"`
+
+	// IP is the IPv4 address of the host, or its IPv6 address when it has none.
+	IP string `json:"ip"`
 
-	// PortID is the port number (0-65535).
-	PortID int `xml:"portid,attr"`
+	// Port is the "port/proto" the script ran against, empty for host scripts.
+	Port string `json:"port"`
 
-	// State contains the current state of the port (open, closed, filtered).
-	State State `xml:"state"`
+	// ID is the script name.
+	ID string `json:"script"`
 
-	// Service contains information about the service running on this port.
-	Service Service `xml:"service"`
+	// Output is the script output.
+	Output string `json:"output"`
 }
 
 // ************************************************************************************************
-// State represents the current state of a port.
-type State struct {
-	// State indicates whether the port is open, closed, or filtered.
-	State string `xml:"state,attr"`
+// MetricInfo is one line of the summary mode: a named statistic and its value.
+type MetricInfo struct {
+	// Name is the statistic name (e.g. "Hosts up").
+	Name string `json:"metric"`
+
+	// Value is the statistic value, formatted for display.
+	Value string `json:"value"`
 }
 
 // ************************************************************************************************
-// Service represents a network service detected on a port.
-type Service struct {
-	// Name is the service name (http, ssh, ftp, etc.).
-	Name string `xml:"name,attr"`
+// SubnetInfo holds the exposure of one network prefix, for the subnet mode.
+type SubnetInfo struct {
+	// Subnet is the network prefix (e.g. "10.0.1.0/24").
+	Subnet string `json:"subnet"`
+
+	// Hosts is the number of hosts found up in the subnet.
+	Hosts int `json:"hosts"`
+
+	// OpenPorts is the total number of open ports of those hosts.
+	OpenPorts int `json:"open_ports"`
+
+	// TopServices lists the most common services of the subnet with their number of open ports,
+	// e.g. "http(12) ssh(5)".
+	TopServices string `json:"top_services"`
 }
 
 // ************************************************************************************************
-// HostInfo holds aggregated information about a single host for display in hostname mode.
-// This structure combines data from multiple sources (addresses, hostnames, ports) into
-// a single record that can be easily sorted and displayed in table or CSV format.
-type HostInfo struct {
-	// Hostname is the resolved DNS hostname for this host (first hostname if multiple exist).
-	Hostname string
+// CVEInfo holds one known vulnerability of a service or operating system, for the CVE mode.
+type CVEInfo struct {
+	// Hostname is the first resolved DNS hostname of the host.
+	Hostname string `json:"hostname"`
 
-	// IPv4 is the IPv4 address of the host.
-	IPv4 string
+	// IP is the IPv4 address of the host, or its IPv6 address when it has none.
+	IP string `json:"ip"`
 
-	// MAC is the MAC address of the host's network interface.
-	MAC string
+	// Port is the affected port ("22/tcp"), empty for operating system CPEs.
+	Port string `json:"port"`
+
+	// CPE is the platform identifier reported by Nmap, and CVE the vulnerability affecting it.
+	CPE string `json:"cpe"`
+	CVE string `json:"cve"`
+
+	// CVSS is the base score of the vulnerability (CVSS v3 when available, v2 otherwise).
+	CVSS float64 `json:"cvss"`
+}
 
-	// Vendor is the NIC manufacturer name associated with the MAC address.
-	Vendor string
+// ************************************************************************************************
+// CountryInfo holds the hosts located in one country, for the country mode.
+type CountryInfo struct {
+	// Country and CountryCode are the English country name and its ISO 3166-1 code.
+	Country     string `json:"country"`
+	CountryCode string `json:"country_code"`
 
-	// CountOpen is the total number of open ports detected on this host.
-	CountOpen int
+	// Hosts is the number of hosts found up in the country.
+	Hosts int `json:"hosts"`
 
-	// Ports is a comma-separated list of matching open port numbers that meet the filter criteria.
-	Ports string
+	// OpenPorts is the total number of open ports of those hosts.
+	OpenPorts int `json:"open_ports"`
 }
 
 // ************************************************************************************************
-// PortInfo holds aggregated information about a port/protocol combination across all scanned hosts.
-// This structure is used in port analysis mode to show which ports are most commonly open
-// in the network, along with their associated service names.
-type PortInfo struct {
-	// Key is the port number and protocol combination in the format "portnum/protocol" (e.g., "80/tcp", "53/udp").
-	Key string
-
-	// Service is the detected service name for this port (e.g., "http", "ssh", "dns").
-	Service string
-
-	// Count is the number of hosts that have this port open in the scan results.
-	Count int
+// GroupInfo holds the hosts sharing a -group-by value, for the group mode.
+type GroupInfo struct {
+	// Group is the value of the attribute (e.g. "Windows"), "Unknown" for the hosts without one.
+	Group string `json:"group"`
+
+	// Hosts is the number of hosts found up in the group.
+	Hosts int `json:"hosts"`
+
+	// OpenPorts is the total number of open ports of those hosts.
+	OpenPorts int `json:"open_ports"`
 }
 
 // ************************************************************************************************
-// VendorInfo holds aggregated information about a network interface card vendor.
-// This structure is used in vendor analysis mode to identify the distribution of
-// hardware manufacturers across the scanned network.
-type VendorInfo struct {
-	// Name is the vendor or manufacturer name (e.g., "Intel Corporate", "Cisco Systems").
-	Name string
-
-	// Count is the number of devices from this vendor found in the scan results.
-	Count int
+// DiffInfo holds one change between two scans, for the diff mode.
+type DiffInfo struct {
+	// Change is "new host", "host gone", "port opened" or "port closed".
+	Change string `json:"change"`
+
+	// IP is the address the hosts of both scans are matched by.
+	IP string `json:"ip"`
+
+	// Hostname is the first resolved DNS hostname of the host.
+	Hostname string `json:"hostname"`
+
+	// Port is the "port/proto" affected by the change, empty for a host without open ports.
+	Port string `json:"port"`
+
+	// Service is the service name of the port.
+	Service string `json:"service"`
+}
+
+// ************************************************************************************************
+// PolicyViolation holds an open port denied by a -policy rule, for the policy mode.
+type PolicyViolation struct {
+	// Rule is the name of the violated rule.
+	Rule string `json:"rule"`
+
+	// IP is the IPv4 address of the host, or its IPv6 address when it has none.
+	IP string `json:"ip"`
+
+	// Hostname is the first resolved DNS hostname of the host.
+	Hostname string `json:"hostname"`
+
+	// Port is the denied "port/proto".
+	Port string `json:"port"`
+
+	// Service is the service name of the port.
+	Service string `json:"service"`
+}
+
+// ************************************************************************************************
+// BaselineInfo holds a difference between the scan and the approved host:port pairs, for the
+// baseline mode.
+type BaselineInfo struct {
+	// Status is "unapproved" for an open port missing from the baseline, "missing" for an approved
+	// pair not open on its host, "host missing" when the host itself is not in the scan.
+	Status string `json:"status"`
+
+	// IP is the address of the host, empty for a missing host designated by its hostname.
+	IP string `json:"ip"`
+
+	// Hostname is the first resolved DNS hostname of the host, or the hostname of the baseline.
+	Hostname string `json:"hostname"`
+
+	// Port is the "port/proto", or the bare port of a baseline pair approving every protocol.
+	Port string `json:"port"`
+
+	// Service is the service name of an unapproved port.
+	Service string `json:"service"`
+
+	// Note is the note of the baseline pair.
+	Note string `json:"note"`
+}
+
+// ************************************************************************************************
+// TrendInfo holds the history of a host, or of one open port of a host, across dated scans, for
+// the trend mode.
+type TrendInfo struct {
+	// IP is the address of the host.
+	IP string `json:"ip"`
+
+	// Hostname is the last known DNS hostname of the host.
+	Hostname string `json:"hostname"`
+
+	// Port is the open "port/proto", empty for the row tracking the host itself.
+	Port string `json:"port"`
+
+	// FirstSeen and LastSeen are the dates (RFC 3339) of the first and last scans it was found in.
+	FirstSeen string `json:"first_seen"`
+	LastSeen  string `json:"last_seen"`
+
+	// Scans is the number of scans it was found in.
+	Scans int `json:"scans"`
+
+	// Status is "active" when it is present in the most recent scan, "gone" otherwise.
+	Status string `json:"status"`
+
+	// active is set while building the timeline when the latest scan contains it.
+	active bool
+}
+
+// ************************************************************************************************
+// HopInfo holds one hop of the route to a host, for the trace mode.
+type HopInfo struct {
+	// IP is the address of the traced host.
+	IP string `json:"ip"`
+
+	// Hostname is the first resolved DNS hostname of the traced host.
+	Hostname string `json:"hostname"`
+
+	// TTL is the position of the hop on the path.
+	TTL int `json:"ttl"`
+
+	// HopIP and HopHost are the address and reverse DNS name of the hop.
+	HopIP   string `json:"hop_ip"`
+	HopHost string `json:"hop_host"`
+
+	// RTT is the round-trip time to the hop in milliseconds, as reported by Nmap.
+	RTT string `json:"rtt"`
+}
+
+// ************************************************************************************************
+// HostPortInfo holds one open port of one host for the long format mode, where every host/port pair
+// is its own row so the output is tidy data for pivot tables and SIEM ingestion.
+type HostPortInfo struct {
+	// Hostname is the first resolved DNS hostname of the host.
+	Hostname string `json:"hostname"`
+
+	// IP is the IPv4 address of the host, or its IPv6 address when it has none.
+	IP string `json:"ip"`
+
+	// Port is the port number.
+	Port int `json:"port"`
+
+	// Protocol is the transport protocol (tcp, udp, sctp).
+	Protocol string `json:"protocol"`
+
+	// State is the port state reported by the scanner.
+	State string `json:"state"`
+
+	// Service is the detected service name.
+	Service string `json:"service"`
+
+	// Columns holds the optional columns selected with -port-columns, by column name.
+	Columns map[string]string `json:"columns,omitempty"`
+}
+
+// ************************************************************************************************
+// ValidationInfo holds the result of the parsing of one scan file, for -validate.
+type ValidationInfo struct {
+	// File is the path of the scan file.
+	File string `json:"file"`
+
+	// Status is "ok", "warning" when anomalies were found, or "invalid" when the file could not be
+	// parsed, is truncated or holds no scan at all.
+	Status string `json:"status"`
+
+	// Scanner is the scanner name and version, and Args its command line, empty for the formats
+	// that carry none.
+	Scanner string `json:"scanner"`
+	Args    string `json:"args"`
+
+	// Hosts is the number of hosts listed in the file, Up the number of those found up and
+	// OpenPorts the number of open ports of the latter.
+	Hosts     int `json:"hosts"`
+	Up        int `json:"up"`
+	OpenPorts int `json:"open_ports"`
+
+	// Anomalies lists the problems found in the file (e.g. "truncated", "no host up").
+	Anomalies []string `json:"anomalies"`
 }
 
 // ************************************************************************************************
 // main is the entry point of the nmap2csv tool.
-// It parses command-line flags and processes Nmap XML output in three modes:
+// It parses command-line flags, loads every input scan (from -file and positional arguments)
+// and processes the aggregated hosts in several modes:
 //   - Hostname mode: Lists hosts with specific open ports
 //   - Port mode: Shows unique ports with occurrence counts
 //   - Vendor mode: Lists MAC address vendors with counts
+//   - Long mode: Lists every open port of every host on its own row
+//   - Service modes: Count hosts per service version, or list the versions found on every port
+//   - OS mode: Counts hosts per detected operating system
+//   - Script mode: Dumps the NSE script results
+//   - Summary mode: Prints an overview of the scans
+//   - Subnet mode: Groups hosts by network prefix
+//   - Matrix mode: Crosses hosts and ports in a grid of port states
+//   - Diff mode: Compares the inputs with an older scan
+//   - Trend mode: Tracks hosts and ports across dated scans
+//   - Trace mode: Lists the traceroute hops to every host
+//   - Policy mode: Lists the open ports forbidden by a policy file
+//   - Baseline mode: Compares the open ports with approved host:port pairs
+//   - Delta mode: Reports the changes since the previous run kept in a state directory
 //
-// The output can be formatted as a table or CSV depending on the -csv flag.
+// The output can be formatted as a table, CSV, JSON, JSON Lines or Markdown, or rendered through a
+// user template; additional exports (Excel, SQLite, filtered Nmap XML) can be written in the same
+// pass. With -watch, a directory is monitored instead and the outputs are regenerated each time its
+// content changes; with -prometheus, the latest input is served as metrics, and with -serve, all the
+// modes are served as a REST API. With -check, the scan is checked as a Nagios plugin would, and
+// with -validate, the inputs are only checked for parseability and anomalies.
 func main() {
-	xmlFile := flag.String("file", "scan.xml", "Nmap XML file")
-	wherePorts := flag.String("whereport", "", "Comma-separated list of ports")
-	showHostnames := flag.Bool("hostname", false, "Show hostnames in table")
-	showPorts := flag.Bool("port", false, "List unique ports with counts")
-	showVendors := flag.Bool("vendor", false, "List vendors with counts")
-	outputCSV := flag.Bool("csv", false, "Output in CSV format")
-	flag.Parse()
-
-	data, err := ioutil.ReadFile(*xmlFile)
-	if err != nil {
-		log.Fatalf("Erreur lecture fichier: %v", err)
-	}
+	os.Exit(runMain(os.Args[1:]))
+}
 
-	var nmap NmapRun
-	if err := xml.Unmarshal(data, &nmap); err != nil {
-		log.Fatalf("Erreur parsing XML for %s: %v", *xmlFile, err)
+// ************************************************************************************************
+// runMain runs the command line args and returns the exit code of the process. It returns rather
+// than exits so that the log file and the profiles are always closed by its deferred calls.
+func runMain(args []string) int {
+	opts := &Options{}
+	fs, patterns := opts.parseCommandLine(args)
+	if err := opts.applyConfig(fs); err != nil {
+		fmt.Fprintf(os.Stderr, "nmap2csv: invalid configuration: %v\n", err)
+		return 2
 	}
 
-	// Mode 1 : -hostname -whereport
-	if *showHostnames {
-		ports := strings.Split(*wherePorts, ",")
-		showAllPort := len(*wherePorts) == 0
-		portSet := make(map[string]bool)
-		for _, p := range ports {
-			portSet[strings.TrimSpace(p)] = true
-		}
-
-		var results []HostInfo
+	logCloser, err := setupLogger(opts.LogLevel, opts.LogFile, opts.StructuredLog)
+	if err != nil {
+		return failure("Invalid logging options", "err", err)
+	}
+	defer logCloser.Close()
 
-		for _, h := range nmap.Hosts {
-			var hostname, ipv4, mac, vendor string
-			if len(h.Hostnames) > 0 {
-				hostname = h.Hostnames[0].Name
-			}
-			for _, a := range h.Addresses {
-				if a.AddrType == "ipv4" {
-					ipv4 = a.Addr
-				}
-				if a.AddrType == "mac" {
-					mac = a.Addr
-					vendor = a.Vendor
-				}
-			}
-			countOpen := 0
-			match := false
-			openPort := []string{}
-			for _, p := range h.Ports {
-				if p.State.State == "open" {
-					countOpen++
-					if showAllPort || portSet[strconv.Itoa(p.PortID)] {
-						match = true
-						openPort = append(openPort, strconv.Itoa(p.PortID))
-					}
-				}
-			}
-			if match {
-				results = append(results, HostInfo{
-					Hostname:  hostname,
-					IPv4:      ipv4,
-					MAC:       mac,
-					Vendor:    vendor,
-					CountOpen: countOpen,
-					Ports:     strings.Join(openPort, ","),
-				})
-			}
-		}
+	if !opts.hasOutput() {
+		fmt.Fprint(os.Stderr, "nmap2csv: no mode selected\n\n")
+		printCommands(os.Stderr)
+		return 2
+	}
+	if err := opts.prepare(); err != nil {
+		return failure("Invalid options", "err", err)
+	}
+	stopProfiles, err := opts.startProfiles()
+	if err != nil {
+		return failure("Cannot start profiling", "file", opts.CPUProfile, "err", err)
+	}
+	defer stopProfiles()
 
-		sort.Slice(results, func(i, j int) bool {
-			return results[i].CountOpen > results[j].CountOpen
+	if opts.Watch != "" {
+		err := watchDirectory(opts.Watch, opts.WatchInterval, func(files []string) error {
+			return opts.run(files, true)
 		})
-
-		if *outputCSV {
-			w := csv.NewWriter(os.Stdout)
-			defer w.Flush()
-			w.Write([]string{"Hostname", "IPv4", "MAC", "Vendor", "CountOpenPort", "Ports"})
-			for _, r := range results {
-				w.Write([]string{r.Hostname, r.IPv4, r.MAC, r.Vendor, fmt.Sprint(r.CountOpen), r.Ports})
-			}
-		} else {
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "Hostname\tIPv4\tMAC\tVendor\tCountOpenPort\tPorts")
-			fmt.Fprintln(w, "--------\t----\t---\t------\t-------------\t-----")
-			for _, r := range results {
-				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", r.Hostname, r.IPv4, r.MAC, r.Vendor, r.CountOpen, r.Ports)
-			}
-			w.Flush()
+		if err != nil {
+			return failure("Watch failed", "dir", opts.Watch, "err", err)
 		}
-		return
+		return 0
 	}
 
-	// Mode 2 : -port
-	if *showPorts {
-		portMap := make(map[string]*PortInfo)
-
-		for _, h := range nmap.Hosts {
-			for _, p := range h.Ports {
-				if p.State.State == "open" {
-					key := fmt.Sprintf("%d/%s", p.PortID, p.Protocol)
-					if _, ok := portMap[key]; !ok {
-						portMap[key] = &PortInfo{Key: key, Service: p.Service.Name, Count: 0}
-					}
-					portMap[key].Count++
-				}
-			}
+	// Positional arguments are additional inputs; without any input, a piped stdin is read
+	// and the -file default only applies as a last resort.
+	positional := len(patterns) > 0
+	switch {
+	case isFlagSet(fs, "file"):
+		patterns = append(strings.Split(opts.File, ","), patterns...)
+	case len(patterns) == 0 && stdinIsPiped():
+		patterns = []string{stdinPath}
+	case len(patterns) == 0:
+		patterns = strings.Split(opts.File, ",")
+	}
+	if opts.Check != "" {
+		return opts.runCheck(patterns)
+	}
+	if opts.Validate {
+		return opts.runValidate(patterns)
+	}
+	if opts.TUI {
+		files, err := expandInputs(patterns)
+		if err != nil {
+			return failure("Invalid input files", "err", err)
 		}
-
-		var ports []PortInfo
-		for _, v := range portMap {
-			ports = append(ports, *v)
+		if err := opts.runTUI(files); err != nil {
+			return failure("Interactive browser failed", "err", err)
 		}
-		sort.Slice(ports, func(i, j int) bool {
-			return ports[i].Count > ports[j].Count
-		})
-
-		if *outputCSV {
-			w := csv.NewWriter(os.Stdout)
-			defer w.Flush()
-			w.Write([]string{"Count", "Port/Proto", "ServiceName"})
-			for _, v := range ports {
-				w.Write([]string{fmt.Sprint(v.Count), v.Key, v.Service})
-			}
-		} else {
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "Count\tPort/Proto\tServiceName")
-			fmt.Fprintln(w, "-----\t----------\t-----------")
-			for _, v := range ports {
-				fmt.Fprintf(w, "%d\t%s\t%s\n", v.Count, v.Key, v.Service)
-			}
-			w.Flush()
+		return 0
+	}
+	if opts.Prometheus != "" {
+		if slices.Contains(patterns, stdinPath) {
+			return failure("-prometheus needs scan files, not the standard input")
 		}
-		return
+		if err := opts.servePrometheus(patterns); err != nil {
+			return failure("Prometheus exporter failed", "addr", opts.Prometheus, "err", err)
+		}
+		return 0
 	}
-
-	// Mode 3 : -vendor
-	if *showVendors {
-		vendorMap := make(map[string]int)
-		for _, h := range nmap.Hosts {
-			for _, a := range h.Addresses {
-				if a.AddrType == "mac" {
-					vendorMap[a.Vendor]++
-				}
+	if opts.Serve != "" {
+		// With -serve-uploads, the API can start empty and receive its scans by upload.
+		var files []string
+		if positional || isFlagSet(fs, "file") || stdinIsPiped() {
+			if files, err = expandInputs(patterns); err != nil {
+				return failure("Invalid input files", "err", err)
 			}
 		}
-
-		var vendors []VendorInfo
-		for k, v := range vendorMap {
-			vendors = append(vendors, VendorInfo{Name: k, Count: v})
+		if err := opts.serveAPI(files); err != nil {
+			return failure("API server failed", "addr", opts.Serve, "err", err)
 		}
-		sort.Slice(vendors, func(i, j int) bool {
-			return vendors[i].Count > vendors[j].Count
-		})
+		return 0
+	}
+	files, err := expandInputs(patterns)
+	if err != nil {
+		return failure("Invalid input files", "err", err)
+	}
 
-		if *outputCSV {
-			w := csv.NewWriter(os.Stdout)
-			defer w.Flush()
-			w.Write([]string{"Count", "VendorName"})
-			for _, v := range vendors {
-				w.Write([]string{fmt.Sprint(v.Count), v.Name})
-			}
-		} else {
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "Count\tVendorName")
-			fmt.Fprintln(w, "-----\t----------")
-			for _, v := range vendors {
-				fmt.Fprintf(w, "%d\t%s\n", v.Count, v.Name)
-			}
-			w.Flush()
-		}
-		return
+	if err := opts.run(files, false); errors.Is(err, errPolicyViolation) {
+		return failure("Policy check failed", "err", err)
+	} else if err != nil {
+		return failure("Failed to write results", "err", err)
 	}
+	return 0
 }
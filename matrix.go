@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ************************************************************************************************
+// matrixAggregator implements the port matrix mode (-matrix): one row per host and one column per
+// port, each cell holding the state of the port on the host ("open", "closed", "filtered"...) or
+// nothing when it was not reported. The columns are the ports of -whereport, or every port found
+// open (in one of the -state states) on at least one host. Hosts without any reported port among the columns are left out.
+type matrixAggregator struct {
+	filter *PortFilter
+	hosts  []matrixHost
+	open   map[matrixPort]bool
+}
+
+// matrixPort identifies a column of the matrix.
+type matrixPort struct {
+	id    int
+	proto string
+}
+
+// matrixHost is a row of the matrix: the host identity and the state of each of its ports.
+type matrixHost struct {
+	hostname, ip string
+	states       map[matrixPort]string
+}
+
+// newMatrixAggregator creates a port matrix aggregator selecting its columns with filter.
+func newMatrixAggregator(filter *PortFilter) *matrixAggregator {
+	return &matrixAggregator{filter: filter, open: make(map[matrixPort]bool)}
+}
+
+// Add implements Aggregator.
+func (a *matrixAggregator) Add(h *Host) {
+	if !h.IsUp() {
+		return
+	}
+	row := matrixHost{ip: h.IP(), states: make(map[matrixPort]string)}
+	if len(h.Hostnames) > 0 {
+		row.hostname = h.Hostnames[0].Name
+	}
+	for _, p := range h.Ports {
+		if !a.filter.Match(&p) {
+			continue
+		}
+		key := matrixPort{p.PortID, p.Protocol}
+		row.states[key] = p.State.State
+		if a.filter.Selected(&p) || !a.filter.All() {
+			a.open[key] = true
+		}
+	}
+	if len(row.states) > 0 {
+		a.hosts = append(a.hosts, row)
+	}
+}
+
+// Report implements Aggregator.
+// The Records of the matrix are its rows as maps, with "hostname", "ip" and one "port/proto" key
+// per column, as the columns depend on the scans.
+func (a *matrixAggregator) Report() *Report {
+	columns := make([]matrixPort, 0, len(a.open))
+	for key := range a.open {
+		columns = append(columns, key)
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		if columns[i].proto != columns[j].proto {
+			return columns[i].proto < columns[j].proto
+		}
+		return columns[i].id < columns[j].id
+	})
+
+	report := &Report{Headers: []string{"Hostname", "IP"}}
+	for _, c := range columns {
+		report.Headers = append(report.Headers, fmt.Sprintf("%d/%s", c.id, c.proto))
+	}
+	records := []map[string]string{}
+	for _, h := range a.hosts {
+		row := []string{h.hostname, h.ip}
+		reported := false
+		for _, c := range columns {
+			state := h.states[c]
+			reported = reported || state != ""
+			row = append(row, state)
+		}
+		if !reported {
+			continue
+		}
+		record := map[string]string{"hostname": h.hostname, "ip": h.ip}
+		for i := range columns {
+			record[report.Headers[i+2]] = row[i+2]
+		}
+		records = append(records, record)
+		report.Rows = append(report.Rows, row)
+	}
+	report.Records = records
+	return report
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package main
+
+import "runtime"
+
+// peakMemory returns the memory obtained from the system by the Go runtime, in bytes: the peak
+// resident set size is not available on this system, and the runtime seldom returns memory.
+func peakMemory() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys
+}
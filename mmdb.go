@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// ************************************************************************************************
+// mmdbReader reads MaxMind DB files (GeoLite2/GeoIP2 City, Country and ASN databases, and the
+// compatible DB-IP and IPinfo files), following the MaxMind DB format specification 2.0. The whole
+// file is loaded in memory; lookups walk the binary search tree, then decode the data record.
+type mmdbReader struct {
+	buf        []byte
+	nodeCount  int
+	recordSize int
+	ipVersion  int
+	treeSize   int
+
+	// ipv4Start is the node reached after the 96 leading zero bits of IPv4-mapped addresses in an
+	// IPv6 tree, and ipv4Depth its depth.
+	ipv4Start, ipv4Depth int
+}
+
+// mmdbMetadataMarker precedes the metadata map at the end of the file.
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// ************************************************************************************************
+// openMMDB loads a MaxMind DB file.
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%s is not a MaxMind DB file", path)
+	}
+	metaStart := i + len(mmdbMetadataMarker)
+	d := mmdbDecoder{buf: buf[metaStart:]}
+	v, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: metadata: %w", path, err)
+	}
+	meta, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: metadata is not a map", path)
+	}
+	r := &mmdbReader{
+		buf:        buf,
+		nodeCount:  int(mmdbUint(meta["node_count"])),
+		recordSize: int(mmdbUint(meta["record_size"])),
+		ipVersion:  int(mmdbUint(meta["ip_version"])),
+	}
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("%s: unsupported record size %d", path, r.recordSize)
+	}
+	r.treeSize = r.nodeCount * r.recordSize / 4
+	if r.treeSize+16 > metaStart {
+		return nil, fmt.Errorf("%s: truncated search tree", path)
+	}
+	if r.ipVersion == 6 {
+		for r.ipv4Depth < 96 && r.ipv4Start < r.nodeCount {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+			r.ipv4Depth++
+		}
+	}
+	return r, nil
+}
+
+// mmdbUint converts a decoded unsigned metadata value to uint64, 0 when it is not a number.
+func mmdbUint(v any) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int64:
+		return uint64(n)
+	}
+	return 0
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a search tree node.
+func (r *mmdbReader) record(node, bit int) int {
+	b := r.buf[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	case 28:
+		if bit == 0 {
+			return int(b[3]&0xf0)<<20 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+		}
+		return int(b[3]&0x0f)<<24 | int(b[4])<<16 | int(b[5])<<8 | int(b[6])
+	}
+	return int(binary.BigEndian.Uint32(b[bit*4:]))
+}
+
+// ************************************************************************************************
+// lookup returns the data record of the network containing ip, nil when the address is not in
+// the database, and the prefix length of that network.
+func (r *mmdbReader) lookup(ip netip.Addr) (any, int, error) {
+	ip = ip.Unmap()
+	node, depth := 0, 0
+	var addr []byte
+	switch {
+	case ip.Is4() && r.ipVersion == 6:
+		a := ip.As4()
+		addr, node, depth = a[:], r.ipv4Start, r.ipv4Depth
+	case ip.Is4():
+		a := ip.As4()
+		addr = a[:]
+	case r.ipVersion == 4:
+		return nil, 0, nil
+	default:
+		a := ip.As16()
+		addr = a[:]
+	}
+	bits := len(addr) * 8
+	i := 0
+	for ; i < bits && node < r.nodeCount; i++ {
+		node = r.record(node, int(addr[i/8]>>(7-i%8)&1))
+	}
+	prefix := i + depth
+	if ip.Is4() && r.ipVersion == 6 {
+		prefix -= 96
+	}
+	if node <= r.nodeCount {
+		return nil, prefix, nil
+	}
+	offset := node - r.nodeCount - 16
+	d := mmdbDecoder{buf: r.buf[r.treeSize+16:]}
+	v, _, err := d.decode(offset)
+	return v, prefix, err
+}
+
+// ************************************************************************************************
+// mmdbDecoder decodes the values of a data section; pointers are offsets into buf.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+// MaxMind DB data types.
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// errMMDBTruncated is returned when a value runs past the end of the data section.
+var errMMDBTruncated = errors.New("truncated data section")
+
+// decode decodes the value at offset into string, float64, []byte, uint64, int64, bool,
+// map[string]any or []any values, and returns the offset following it.
+func (d *mmdbDecoder) decode(offset int) (any, int, error) {
+	if offset < 0 || offset >= len(d.buf) {
+		return nil, 0, errMMDBTruncated
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ := int(ctrl >> 5)
+	if typ == mmdbPointer {
+		ptr, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(ptr)
+		return v, next, err
+	}
+	if typ == mmdbExtended {
+		if offset >= len(d.buf) {
+			return nil, 0, errMMDBTruncated
+		}
+		typ = int(d.buf[offset]) + 7
+		offset++
+	}
+	size := int(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > len(d.buf) {
+			return nil, 0, errMMDBTruncated
+		}
+		v := 0
+		for _, b := range d.buf[offset : offset+n] {
+			v = v<<8 | int(b)
+		}
+		size = [...]int{29, 285, 65821}[n-1] + v
+		offset += n
+	}
+	if typ == mmdbMap {
+		m := make(map[string]any, size)
+		for range size {
+			k, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			v, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key], offset = v, next
+		}
+		return m, offset, nil
+	}
+	if typ == mmdbArray {
+		a := make([]any, 0, size)
+		for range size {
+			v, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a, offset = append(a, v), next
+		}
+		return a, offset, nil
+	}
+	if typ == mmdbBool {
+		return size != 0, offset, nil
+	}
+	if offset+size > len(d.buf) {
+		return nil, 0, errMMDBTruncated
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+	switch typ {
+	case mmdbString:
+		return string(b), next, nil
+	case mmdbBytes:
+		return b, next, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbUint128:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, next, nil
+	case mmdbInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), next, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+}
+
+// pointer decodes the target of a pointer whose control byte is ctrl, and returns the offset
+// following the pointer.
+func (d *mmdbDecoder) pointer(ctrl byte, offset int) (int, int, error) {
+	n := int(ctrl>>3&3) + 1
+	if offset+n > len(d.buf) {
+		return 0, 0, errMMDBTruncated
+	}
+	v := 0
+	if n < 4 {
+		v = int(ctrl & 7)
+	}
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | int(b)
+	}
+	return v + [...]int{0, 2048, 526336, 0}[n-1], offset + n, nil
+}
+
+// ************************************************************************************************
+// mmdbPath walks nested maps of a decoded record along the keys, returning nil when one is
+// missing.
+func mmdbPath(v any, keys ...string) any {
+	for _, k := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
@@ -0,0 +1,38 @@
+package main
+
+import "github.com/1mm0rt41PC/nmap2csv/pkg/nmapparse"
+
+// The scan model, the parsers and the core summaries live in the nmapparse package, to be usable
+// as a library; the command refers to them under their own names.
+type (
+	NmapRun      = nmapparse.NmapRun
+	ScanMeta     = nmapparse.ScanMeta
+	RunStats     = nmapparse.RunStats
+	Host         = nmapparse.Host
+	GeoLocation  = nmapparse.GeoLocation
+	Status       = nmapparse.Status
+	OS           = nmapparse.OS
+	OSMatch      = nmapparse.OSMatch
+	OSClass      = nmapparse.OSClass
+	Trace        = nmapparse.Trace
+	Hop          = nmapparse.Hop
+	Address      = nmapparse.Address
+	Hostname     = nmapparse.Hostname
+	Port         = nmapparse.Port
+	Script       = nmapparse.Script
+	State        = nmapparse.State
+	Service      = nmapparse.Service
+	ASNInfo      = nmapparse.ASNInfo
+	ExposureInfo = nmapparse.ExposureInfo
+	OwnerInfo    = nmapparse.OwnerInfo
+	RiskScore    = nmapparse.RiskScore
+	HostHandler  = nmapparse.HostHandler
+	MetaHandler  = nmapparse.MetaHandler
+	HostInfo     = nmapparse.HostInfo
+	PortInfo     = nmapparse.PortInfo
+	VendorInfo   = nmapparse.VendorInfo
+	PortFilter   = nmapparse.PortFilter
+	PortStates   = nmapparse.PortStates
+	PortSpec     = nmapparse.PortSpec
+	PortList     = nmapparse.PortList
+)
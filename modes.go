@@ -0,0 +1,728 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/1mm0rt41PC/nmap2csv/pkg/nmapparse"
+)
+
+// ************************************************************************************************
+// HostConsumer receives the scanned hosts one at a time while the inputs are streamed.
+type HostConsumer interface {
+	// Add accounts for one scanned host.
+	Add(h *Host)
+}
+
+// ************************************************************************************************
+// ScanStarter is optionally implemented by consumers that need to know which input file the
+// following hosts come from (e.g. to assign them a scan identifier).
+type ScanStarter interface {
+	// StartScan is called before the first host of each input file.
+	StartScan(source string)
+}
+
+// ************************************************************************************************
+// MetaConsumer is optionally implemented by consumers using the scan-level information of the
+// inputs (scanner version, arguments, run statistics).
+type MetaConsumer interface {
+	// AddMeta is called after the last host of every document carrying scan information.
+	AddMeta(m *ScanMeta)
+}
+
+// ************************************************************************************************
+// Aggregator is implemented by every analysis mode.
+// Hosts are fed one at a time while the scans are streamed, so a mode only keeps the state it
+// needs for its report (counters, matching rows) instead of the whole scan.
+type Aggregator interface {
+	HostConsumer
+
+	// Report returns the final, sorted result once every host has been added.
+	Report() *Report
+}
+
+// ************************************************************************************************
+// hostnameAggregator implements the hostname mode (-hostname).
+// Only hosts with at least one open port listed in -whereport are kept (any open port when the
+// filter is empty); -state selects other port states instead. Ports of -excludeport are neither
+// listed nor counted. CountOpenPort always counts open ports, and rows are sorted by it, after the
+// -risk score when computed; hosts whose count is outside the -min-open/-max-open range are left
+// out. Hosts found down are skipped, unless -include-down lists them along with the hosts of host
+// discovery scans (-sn), which have no port results. With -spill, the rows are kept in a spool
+// rather than in results.
+type hostnameAggregator struct {
+	filter      *PortFilter
+	list        PortList
+	columns     []hostColumn
+	open        countRange
+	includeDown bool
+	hosts       *hostFilter
+	results     []HostInfo
+	spool       *rowSpool
+}
+
+// newHostnameAggregator creates a hostname mode aggregator for the port filter, rendering the Ports
+// column with list, appending the optional columns and keeping the hosts whose open port count is
+// in the open range. includeDown also lists the down hosts and the hosts without port results.
+func newHostnameAggregator(filter *PortFilter, list PortList, columns []hostColumn, open countRange, includeDown bool) *hostnameAggregator {
+	return &hostnameAggregator{filter: filter, list: list, columns: columns, open: open, includeDown: includeDown}
+}
+
+// ************************************************************************************************
+// newHostnameAggregator creates the hostname mode aggregator of the options. The host filters are
+// only kept to describe an empty report: the hosts they drop never reach the aggregator.
+func (o *Options) newHostnameAggregator() *hostnameAggregator {
+	a := newHostnameAggregator(o.portFilter(), o.portList(), o.columns, o.openRange(), o.IncludeDown)
+	a.hosts = &o.hosts
+	return a
+}
+
+// ************************************************************************************************
+// countRange is an inclusive range of counts. A negative Max leaves the range unbounded.
+type countRange struct {
+	Min, Max int
+}
+
+// contains reports whether n is in the range.
+func (r countRange) contains(n int) bool {
+	return n >= r.Min && (r.Max < 0 || n <= r.Max)
+}
+
+// String describes the bounds of the range as -min-open and -max-open, empty when it is unbounded.
+func (r countRange) String() string {
+	var parts []string
+	if r.Min > 0 {
+		parts = append(parts, "min-open="+strconv.Itoa(r.Min))
+	}
+	if r.Max >= 0 {
+		parts = append(parts, "max-open="+strconv.Itoa(r.Max))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Add implements Aggregator.
+func (a *hostnameAggregator) Add(h *Host) {
+	info, ok := a.hostInfo(h)
+	switch {
+	case !ok:
+	case a.spool != nil:
+		a.spool.Add([]int{info.Risk, info.CountOpen}, a.row(info), info)
+	default:
+		a.results = append(a.results, info)
+	}
+}
+
+// hostInfo returns the row of a host, false when it has no selected port or its open port count is
+// out of range, or when it is down without -include-down.
+func (a *hostnameAggregator) hostInfo(h *Host) (HostInfo, bool) {
+	if !h.IsUp() && !a.includeDown {
+		return HostInfo{}, false
+	}
+	info, ok := nmapparse.Summarize(h, a.filter, a.list)
+	if !ok && a.includeDown {
+		// Down hosts and host discovery results have no port to select.
+		ok = !h.IsUp() || (len(h.Ports) == 0 && len(h.ExtraPorts) == 0)
+	}
+	if !ok || !a.open.contains(info.CountOpen) {
+		return HostInfo{}, false
+	}
+	if h.Risk != nil {
+		info.Risk = h.Risk.Score
+	}
+	if len(a.columns) > 0 {
+		info.Columns = make(map[string]string, len(a.columns))
+		for _, c := range a.columns {
+			info.Columns[c.Name] = c.value(h)
+		}
+	}
+	return info, true
+}
+
+// Report implements Aggregator.
+func (a *hostnameAggregator) Report() *Report {
+	if len(a.results) == 0 && (a.spool == nil || a.spool.Len() == 0) {
+		filters := []string{a.filter.String(), a.open.String()}
+		if a.hosts != nil {
+			filters = append(filters, a.hosts.String())
+		}
+		filters = slices.DeleteFunc(filters, func(s string) bool { return s == "" })
+		slog.Warn("No hosts matched filter", "filter", strings.Join(filters, " "))
+	}
+	if a.spool != nil {
+		return &Report{Headers: a.headers(), spool: a.spool}
+	}
+
+	// Ties keep the scan order, as the rows of a spool do.
+	sort.SliceStable(a.results, func(i, j int) bool {
+		if a.results[i].Risk != a.results[j].Risk {
+			return a.results[i].Risk > a.results[j].Risk
+		}
+		return a.results[i].CountOpen > a.results[j].CountOpen
+	})
+
+	report := &Report{Headers: a.headers(), Records: a.results}
+	for _, r := range a.results {
+		report.Rows = append(report.Rows, a.row(r))
+	}
+	return report
+}
+
+// headers returns the column names of the hostname mode, the optional columns included.
+func (a *hostnameAggregator) headers() []string {
+	headers := []string{"Hostname", "IPv4", "MAC", "Vendor", "CountOpenPort", "Ports"}
+	for _, c := range a.columns {
+		headers = append(headers, c.Header)
+	}
+	return headers
+}
+
+// row returns the cells of a host row, in the order of headers.
+func (a *hostnameAggregator) row(r HostInfo) []string {
+	row := []string{r.Hostname, r.IPv4, r.MAC, r.Vendor, fmt.Sprint(r.CountOpen), r.Ports}
+	for _, c := range a.columns {
+		row = append(row, r.Columns[c.Name])
+	}
+	return row
+}
+
+// ************************************************************************************************
+// portAggregator implements the port mode (-port).
+// Each open port/protocol pair is counted once per host and rows are sorted by descending count.
+// With -state selecting other states, pairs are counted per state and a State column is added.
+type portAggregator struct {
+	states  PortStates
+	counter *nmapparse.PortCounter
+}
+
+// newPortAggregator creates an empty port mode aggregator for the selected port states.
+func newPortAggregator(states PortStates) *portAggregator {
+	return &portAggregator{states: states, counter: nmapparse.NewPortCounter(states)}
+}
+
+// Add implements Aggregator.
+func (a *portAggregator) Add(h *Host) {
+	a.counter.Add(h)
+}
+
+// Report implements Aggregator.
+func (a *portAggregator) Report() *Report {
+	ports := a.counter.Ports()
+	report := &Report{Headers: []string{"Count", "Port/Proto", "ServiceName"}, Records: ports}
+	if !a.states.OpenOnly() {
+		report.Headers = append(report.Headers, "State")
+	}
+	for _, v := range ports {
+		row := []string{fmt.Sprint(v.Count), v.Key, v.Service}
+		if !a.states.OpenOnly() {
+			row = append(row, v.State)
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	return report
+}
+
+// ************************************************************************************************
+// vendorAggregator implements the vendor mode (-vendor).
+// Every MAC address counts once for its vendor and rows are sorted by descending count.
+type vendorAggregator struct {
+	counter *nmapparse.VendorCounter
+}
+
+// newVendorAggregator creates an empty vendor mode aggregator.
+func newVendorAggregator() *vendorAggregator {
+	return &vendorAggregator{counter: nmapparse.NewVendorCounter()}
+}
+
+// Add implements Aggregator.
+func (a *vendorAggregator) Add(h *Host) {
+	a.counter.Add(h)
+}
+
+// Report implements Aggregator.
+func (a *vendorAggregator) Report() *Report {
+	vendors := a.counter.Vendors()
+	report := &Report{Headers: []string{"Count", "VendorName"}, Records: vendors}
+	for _, v := range vendors {
+		report.Rows = append(report.Rows, []string{fmt.Sprint(v.Count), v.Name})
+	}
+	return report
+}
+
+// ************************************************************************************************
+// hostPortAggregator implements the long format mode (-long).
+// Every open port listed in -whereport (any open port when the filter is empty) becomes a row,
+// in scan order; -state selects other port states instead. With -spill, the rows are kept in a
+// spool rather than in results.
+type hostPortAggregator struct {
+	filter  *PortFilter
+	columns []portColumn
+	results []HostPortInfo
+	spool   *rowSpool
+}
+
+// newHostPortAggregator creates a long format mode aggregator for the port filter, appending the
+// optional columns.
+func newHostPortAggregator(filter *PortFilter, columns []portColumn) *hostPortAggregator {
+	return &hostPortAggregator{filter: filter, columns: columns}
+}
+
+// Add implements Aggregator.
+func (a *hostPortAggregator) Add(h *Host) {
+	hostname := ""
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	ip := h.IP()
+	for _, p := range h.Ports {
+		if !a.filter.Selected(&p) {
+			continue
+		}
+		info := HostPortInfo{
+			Hostname: hostname,
+			IP:       ip,
+			Port:     p.PortID,
+			Protocol: p.Protocol,
+			State:    p.State.State,
+			Service:  p.Service.Name,
+		}
+		if len(a.columns) > 0 {
+			info.Columns = make(map[string]string, len(a.columns))
+			for _, c := range a.columns {
+				info.Columns[c.Name] = c.value(&p)
+			}
+		}
+		if a.spool != nil {
+			a.spool.Add(nil, a.row(info), info)
+		} else {
+			a.results = append(a.results, info)
+		}
+	}
+}
+
+// Report implements Aggregator.
+func (a *hostPortAggregator) Report() *Report {
+	headers := []string{"Hostname", "IP", "Port", "Proto", "State", "Service"}
+	for _, c := range a.columns {
+		headers = append(headers, c.Header)
+	}
+	if a.spool != nil {
+		return &Report{Headers: headers, spool: a.spool}
+	}
+	report := &Report{Headers: headers, Records: a.results}
+	for _, r := range a.results {
+		report.Rows = append(report.Rows, a.row(r))
+	}
+	return report
+}
+
+// row returns the cells of a port row, the optional columns included.
+func (a *hostPortAggregator) row(r HostPortInfo) []string {
+	row := []string{r.Hostname, r.IP, strconv.Itoa(r.Port), r.Protocol, r.State, r.Service}
+	for _, c := range a.columns {
+		row = append(row, r.Columns[c.Name])
+	}
+	return row
+}
+
+// ************************************************************************************************
+// serviceAggregator implements the service mode (-service).
+// Each service/product/version combination found on an open port (or a port in one of the -state
+// states) is counted once per host, and rows are sorted by descending count.
+type serviceAggregator struct {
+	states   PortStates
+	services map[ServiceInfo]int
+}
+
+// newServiceAggregator creates an empty service mode aggregator for the selected port states.
+func newServiceAggregator(states PortStates) *serviceAggregator {
+	return &serviceAggregator{states: states, services: make(map[ServiceInfo]int)}
+}
+
+// Add implements Aggregator.
+func (a *serviceAggregator) Add(h *Host) {
+	seen := make(map[ServiceInfo]bool)
+	for _, p := range h.Ports {
+		if !a.states.Has(&p) {
+			continue
+		}
+		key := ServiceInfo{Service: p.Service.Name, Product: p.Service.Product, Version: p.Service.Version}
+		if !seen[key] {
+			seen[key] = true
+			a.services[key]++
+		}
+	}
+}
+
+// Report implements Aggregator.
+func (a *serviceAggregator) Report() *Report {
+	var services []ServiceInfo
+	for k, v := range a.services {
+		k.Count = v
+		services = append(services, k)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Count != services[j].Count {
+			return services[i].Count > services[j].Count
+		}
+		return services[i].Service+"\x00"+services[i].Product+"\x00"+services[i].Version <
+			services[j].Service+"\x00"+services[j].Product+"\x00"+services[j].Version
+	})
+
+	report := &Report{Headers: []string{"Count", "Service", "Product", "Version"}, Records: services}
+	for _, v := range services {
+		report.Rows = append(report.Rows, []string{fmt.Sprint(v.Count), v.Service, v.Product, v.Version})
+	}
+	return report
+}
+
+// ************************************************************************************************
+// serviceDetailAggregator implements the per-host service detail mode (-service-detail).
+// Every port selected by the filter (open ports, or ports in one of the -state states) becomes a row
+// with its version detection results, in scan order; a State column is added when other states than
+// open are selected.
+type serviceDetailAggregator struct {
+	filter  *PortFilter
+	states  PortStates
+	results []ServiceDetail
+}
+
+// newServiceDetailAggregator creates an empty service detail mode aggregator for the port filter
+// and its port states.
+func newServiceDetailAggregator(filter *PortFilter, states PortStates) *serviceDetailAggregator {
+	return &serviceDetailAggregator{filter: filter, states: states}
+}
+
+// Add implements Aggregator.
+func (a *serviceDetailAggregator) Add(h *Host) {
+	hostname := ""
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	ip := h.IP()
+	for _, p := range h.Ports {
+		if !a.filter.Selected(&p) {
+			continue
+		}
+		state := ""
+		if !a.states.OpenOnly() {
+			state = p.State.State
+		}
+		a.results = append(a.results, ServiceDetail{
+			Hostname:  hostname,
+			IP:        ip,
+			Port:      p.PortID,
+			Protocol:  p.Protocol,
+			State:     state,
+			Service:   p.Service.Name,
+			Product:   p.Service.Product,
+			Version:   p.Service.Version,
+			ExtraInfo: p.Service.ExtraInfo,
+			OSType:    p.Service.OSType,
+		})
+	}
+}
+
+// Report implements Aggregator.
+func (a *serviceDetailAggregator) Report() *Report {
+	report := &Report{Headers: []string{"Hostname", "IP", "Port/Proto", "Service", "Product", "Version", "ExtraInfo", "OSType"}, Records: a.results}
+	if !a.states.OpenOnly() {
+		report.Headers = slices.Insert(report.Headers, 3, "State")
+	}
+	for _, r := range a.results {
+		row := []string{r.Hostname, r.IP, fmt.Sprintf("%d/%s", r.Port, r.Protocol), r.Service, r.Product, r.Version, r.ExtraInfo, r.OSType}
+		if !a.states.OpenOnly() {
+			row = slices.Insert(row, 3, r.State)
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	return report
+}
+
+// ************************************************************************************************
+// bannerAggregator implements the banner mode (-banners).
+// Every port selected by the filter (open ports, or ports in one of the -state states) with a
+// service fingerprint or a banner script result becomes a row, in scan order, so that the services
+// version detection could not recognise can be reviewed by hand.
+type bannerAggregator struct {
+	filter  *PortFilter
+	results []BannerInfo
+}
+
+// newBannerAggregator creates an empty banner mode aggregator for the port filter.
+func newBannerAggregator(filter *PortFilter) *bannerAggregator {
+	return &bannerAggregator{filter: filter}
+}
+
+// Add implements Aggregator.
+func (a *bannerAggregator) Add(h *Host) {
+	hostname := ""
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	ip := h.IP()
+	for _, p := range h.Ports {
+		if !a.filter.Selected(&p) {
+			continue
+		}
+		banner := p.ScriptOutput("banner")
+		if banner == "" && p.Service.Fingerprint == "" {
+			continue
+		}
+		a.results = append(a.results, BannerInfo{
+			Hostname:    hostname,
+			IP:          ip,
+			Port:        p.PortID,
+			Protocol:    p.Protocol,
+			Service:     p.Service.Name,
+			Banner:      banner,
+			Fingerprint: flattenFingerprint(p.Service.Fingerprint),
+		})
+	}
+}
+
+// Report implements Aggregator.
+func (a *bannerAggregator) Report() *Report {
+	report := &Report{Headers: []string{"Hostname", "IP", "Port/Proto", "Service", "Banner", "ServiceFP"}, Records: a.results}
+	for _, r := range a.results {
+		report.Rows = append(report.Rows, []string{r.Hostname, r.IP, fmt.Sprintf("%d/%s", r.Port, r.Protocol), r.Service, r.Banner, r.Fingerprint})
+	}
+	return report
+}
+
+// ************************************************************************************************
+// flattenFingerprint joins the lines of a service fingerprint, which Nmap wraps with "SF:"
+// continuation prefixes, back into a single line fitting in a cell.
+func flattenFingerprint(fp string) string {
+	lines := strings.Split(strings.TrimSpace(fp), "\n")
+	for i := 1; i < len(lines); i++ {
+		lines[i] = strings.TrimPrefix(lines[i], "SF:")
+	}
+	return strings.Join(lines, "")
+}
+
+// ************************************************************************************************
+// webAggregator implements the web mode (-web).
+// Every port selected by the filter (open ports, or ports in one of the -state states) serving HTTP
+// becomes a row, in scan order, with its URL and the page title of the http-title script, to triage
+// many web services at once.
+type webAggregator struct {
+	filter  *PortFilter
+	results []WebInfo
+}
+
+// newWebAggregator creates an empty web mode aggregator for the port filter.
+func newWebAggregator(filter *PortFilter) *webAggregator {
+	return &webAggregator{filter: filter}
+}
+
+// Add implements Aggregator.
+func (a *webAggregator) Add(h *Host) {
+	hostname := ""
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	ip := h.IP()
+	target := hostname
+	if target == "" {
+		target = ip
+	}
+	for _, p := range h.Ports {
+		if !a.filter.Selected(&p) || !p.IsWeb() {
+			continue
+		}
+		a.results = append(a.results, WebInfo{
+			Hostname: hostname,
+			IP:       ip,
+			Port:     p.PortID,
+			Protocol: p.Protocol,
+			Service:  p.Service.Name,
+			Product:  strings.TrimSpace(p.Service.Product + " " + p.Service.Version),
+			URL:      webURL(target, &p),
+			Title:    p.HTTPTitle(),
+		})
+	}
+}
+
+// Report implements Aggregator.
+func (a *webAggregator) Report() *Report {
+	report := &Report{Headers: []string{"Hostname", "IP", "Port/Proto", "Service", "Product", "URL", "Title"}, Records: a.results}
+	for _, r := range a.results {
+		report.Rows = append(report.Rows, []string{r.Hostname, r.IP, fmt.Sprintf("%d/%s", r.Port, r.Protocol), r.Service, r.Product, r.URL, r.Title})
+	}
+	return report
+}
+
+// ************************************************************************************************
+// webURL returns the URL of the web service of port p on host, leaving out the default port of
+// the scheme.
+func webURL(host string, p *Port) string {
+	scheme, defaultPort := "http", 80
+	if p.TLS() {
+		scheme, defaultPort = "https", 443
+	}
+	if p.PortID == defaultPort {
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		return scheme + "://" + host + "/"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(p.PortID)) + "/"
+}
+
+// ************************************************************************************************
+// osAggregator implements the OS mode (-os).
+// Every host is counted once for its best OS detection match; hosts without OS detection results
+// are ignored. Rows are sorted by descending count.
+type osAggregator struct {
+	osMap map[string]*OSInfo
+}
+
+// newOSAggregator creates an empty OS mode aggregator.
+func newOSAggregator() *osAggregator {
+	return &osAggregator{osMap: make(map[string]*OSInfo)}
+}
+
+// Add implements Aggregator.
+func (a *osAggregator) Add(h *Host) {
+	m := h.BestOSMatch()
+	if m == nil {
+		return
+	}
+	info, ok := a.osMap[m.Name]
+	if !ok {
+		info = &OSInfo{Name: m.Name}
+		a.osMap[m.Name] = info
+	}
+	info.Count++
+	info.Accuracy = max(info.Accuracy, m.Accuracy)
+}
+
+// Report implements Aggregator.
+func (a *osAggregator) Report() *Report {
+	var systems []OSInfo
+	for _, v := range a.osMap {
+		systems = append(systems, *v)
+	}
+	sort.Slice(systems, func(i, j int) bool {
+		if systems[i].Count != systems[j].Count {
+			return systems[i].Count > systems[j].Count
+		}
+		return systems[i].Name < systems[j].Name
+	})
+
+	report := &Report{Headers: []string{"Count", "OS", "Accuracy"}, Records: systems}
+	for _, v := range systems {
+		report.Rows = append(report.Rows, []string{fmt.Sprint(v.Count), v.Name, fmt.Sprint(v.Accuracy)})
+	}
+	return report
+}
+
+// ************************************************************************************************
+// scriptAggregator implements the script mode (-script).
+// Every NSE result of a host script or of a script run against an open port (or a port in one of
+// the -state states) becomes a row, in scan order. An optional comma-separated list of script ids or glob patterns (smb-*) restricts
+// the results.
+type scriptAggregator struct {
+	patterns []string
+	states   PortStates
+	results  []ScriptInfo
+}
+
+// newScriptAggregator creates a script mode aggregator for the comma-separated script filter,
+// keeping every script when it is empty, and for the selected port states.
+func newScriptAggregator(ids string, states PortStates) *scriptAggregator {
+	a := &scriptAggregator{states: states}
+	for _, id := range strings.Split(ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			a.patterns = append(a.patterns, id)
+		}
+	}
+	return a
+}
+
+// match reports whether the script is selected by the filter.
+func (a *scriptAggregator) match(id string) bool {
+	if len(a.patterns) == 0 {
+		return true
+	}
+	for _, p := range a.patterns {
+		if ok, _ := path.Match(p, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Add implements Aggregator.
+func (a *scriptAggregator) Add(h *Host) {
+	hostname := ""
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	ip := h.IP()
+	add := func(port string, scripts []Script) {
+		for _, s := range scripts {
+			if a.match(s.ID) {
+				a.results = append(a.results, ScriptInfo{Hostname: hostname, IP: ip, Port: port, ID: s.ID, Output: strings.TrimSpace(s.Output)})
+			}
+		}
+	}
+	add("", h.Scripts)
+	for _, p := range h.Ports {
+		if a.states.Has(&p) {
+			add(fmt.Sprintf("%d/%s", p.PortID, p.Protocol), p.Scripts)
+		}
+	}
+}
+
+// Report implements Aggregator.
+func (a *scriptAggregator) Report() *Report {
+	report := &Report{Headers: []string{"Hostname", "IP", "Port/Proto", "ScriptID", "Output"}, Records: a.results}
+	for _, r := range a.results {
+		report.Rows = append(report.Rows, []string{r.Hostname, r.IP, r.Port, r.ID, r.Output})
+	}
+	return report
+}
+
+// ************************************************************************************************
+// traceAggregator implements the trace mode (-trace).
+// Every hop of the traceroute of every host (--traceroute scans) becomes a row, giving the hop
+// paths needed to map the network topology.
+type traceAggregator struct {
+	results []HopInfo
+}
+
+// newTraceAggregator creates an empty trace mode aggregator.
+func newTraceAggregator() *traceAggregator {
+	return &traceAggregator{}
+}
+
+// Add implements Aggregator.
+func (a *traceAggregator) Add(h *Host) {
+	if h.Trace == nil {
+		return
+	}
+	hostname := ""
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	ip := h.IP()
+	for _, hop := range h.Trace.Hops {
+		a.results = append(a.results, HopInfo{IP: ip, Hostname: hostname, TTL: hop.TTL, HopIP: hop.IPAddr, HopHost: hop.Host, RTT: hop.RTT})
+	}
+}
+
+// Report implements Aggregator.
+func (a *traceAggregator) Report() *Report {
+	report := &Report{Headers: []string{"IP", "Hostname", "TTL", "HopIP", "HopHost", "RTT"}, Records: a.results}
+	for _, r := range a.results {
+		report.Rows = append(report.Rows, []string{r.IP, r.Hostname, strconv.Itoa(r.TTL), r.HopIP, r.HopHost, r.RTT})
+	}
+	return report
+}
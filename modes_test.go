@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/1mm0rt41PC/nmap2csv/pkg/nmapparse"
+)
+
+// testXML is the scan the tests of the modes and the API run over: a router with probed, guessed
+// and SSL/TLS services, and a Windows host with a closed port.
+const testXML = `<?xml version="1.0"?>
+<nmaprun scanner="nmap" args="nmap -sV 10.0.0.0/24" start="1700000000" version="7.94">
+<host><status state="up"/><address addr="10.0.0.1" addrtype="ipv4"/><address addr="00:11:22:33:44:55" addrtype="mac" vendor="Cisco"/>
+<hostnames><hostname name="gw.lan"/></hostnames>
+<ports>
+<port protocol="tcp" portid="22"><state state="open"/><service name="ssh" product="OpenSSH" version="8.9p1" method="probed" conf="10"/></port>
+<port protocol="tcp" portid="443"><state state="open"/><service name="http" product="nginx" tunnel="ssl" method="probed" conf="10"/><script id="http-title" output="Router login"/></port>
+<port protocol="tcp" portid="8080"><state state="open"/><service name="http-proxy" method="table" conf="3"/></port>
+<port protocol="tcp" portid="8000"><state state="open"/><service name="http-alt" method="table" conf="3" servicefp="SF:Abyss"/></port>
+</ports></host>
+<host><status state="up"/><address addr="10.0.0.2" addrtype="ipv4"/>
+<ports>
+<port protocol="tcp" portid="445"><state state="closed"/><service name="microsoft-ds" method="table" conf="3"/></port>
+<port protocol="tcp" portid="3389"><state state="open"/><service name="ms-wbt-server" method="probed" conf="10"/></port>
+</ports></host>
+<runstats><finished time="1700000060" elapsed="60"/><hosts up="2" down="0" total="2"/></runstats>
+</nmaprun>
+`
+
+// ************************************************************************************************
+// testOptions returns the options of the command line args, prepared as main does.
+func testOptions(t *testing.T, args ...string) *Options {
+	t.Helper()
+	o := &Options{}
+	fs := flag.NewFlagSet("nmap2csv", flag.ContinueOnError)
+	o.register(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+// testHosts returns the hosts of testXML.
+func testHosts(t *testing.T) []*Host {
+	t.Helper()
+	var hosts []*Host
+	_, err := nmapparse.Stream(strings.NewReader(testXML), func(h *Host) error {
+		hosts = append(hosts, h)
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hosts
+}
+
+// ************************************************************************************************
+// TestAggregators checks the rows of the modes over testXML, with the port filters applied.
+func TestAggregators(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		args []string
+		want [][]string
+	}{
+		{"hostname", "hostname", nil, [][]string{
+			{"gw.lan", "10.0.0.1", "00:11:22:33:44:55", "Cisco", "4", "22,443,8080,8000"},
+			{"", "10.0.0.2", "", "", "1", "3389"},
+		}},
+		{"hostname whereport", "hostname", []string{"-whereport", "3389"}, [][]string{
+			{"", "10.0.0.2", "", "", "1", "3389"},
+		}},
+		{"hostname min-conf", "hostname", []string{"-min-conf", "8"}, [][]string{
+			{"gw.lan", "10.0.0.1", "00:11:22:33:44:55", "Cisco", "2", "22,443"},
+			{"", "10.0.0.2", "", "", "1", "3389"},
+		}},
+		{"hostname min-open", "hostname", []string{"-min-open", "2"}, [][]string{
+			{"gw.lan", "10.0.0.1", "00:11:22:33:44:55", "Cisco", "4", "22,443,8080,8000"},
+		}},
+		{"port closed", "port", []string{"-state", "closed"}, [][]string{
+			{"1", "445/tcp", "microsoft-ds", "closed"},
+		}},
+		{"vendor", "vendor", nil, [][]string{
+			{"1", "Cisco"},
+		}},
+		{"long ssl-only", "long", []string{"-ssl-only"}, [][]string{
+			{"gw.lan", "10.0.0.1", "443", "tcp", "open", "http"},
+		}},
+		{"web", "web", nil, [][]string{
+			{"gw.lan", "10.0.0.1", "443/tcp", "http", "nginx", "https://gw.lan/", "Router login"},
+			{"gw.lan", "10.0.0.1", "8080/tcp", "http-proxy", "", "http://gw.lan:8080/", ""},
+			{"gw.lan", "10.0.0.1", "8000/tcp", "http-alt", "", "http://gw.lan:8000/", ""},
+		}},
+		{"web ssl-only", "web", []string{"-ssl-only"}, [][]string{
+			{"gw.lan", "10.0.0.1", "443/tcp", "http", "nginx", "https://gw.lan/", "Router login"},
+		}},
+		{"banners", "banners", nil, [][]string{
+			{"gw.lan", "10.0.0.1", "8000/tcp", "http-alt", "", "SF:Abyss"},
+		}},
+		{"banners min-conf", "banners", []string{"-min-conf", "8"}, nil},
+		{"service-detail whereport", "service-detail", []string{"-whereport", "22"}, [][]string{
+			{"gw.lan", "10.0.0.1", "22/tcp", "ssh", "OpenSSH", "8.9p1", "", ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := testOptions(t, tt.args...)
+			i := slices.IndexFunc(modes, func(m mode) bool { return m.Name == tt.mode })
+			if i < 0 {
+				t.Fatalf("unknown mode %q", tt.mode)
+			}
+			agg := modes[i].newAggregator(o)
+			for _, h := range testHosts(t) {
+				agg.Add(h)
+			}
+			report := agg.Report()
+			defer report.Close()
+			if !slices.EqualFunc(report.Rows, tt.want, slices.Equal) {
+				t.Errorf("got rows %q, want %q", report.Rows, tt.want)
+			}
+		})
+	}
+}
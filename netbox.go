@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ************************************************************************************************
+// netboxConfig holds the -netbox-* options of the NetBox synchronization.
+type netboxConfig struct {
+	// URL is the base URL of NetBox (https://netbox.example.com) and Token an API token with write
+	// permission on IP addresses (and devices and interfaces when Site is set).
+	URL   string
+	Token string
+
+	// Site, Role and DeviceType are the slugs of the site, device role and device type given to the
+	// created devices. Devices are only synchronized when Site is set; Interface is the interface
+	// of the device the address is assigned to.
+	Site       string
+	Role       string
+	DeviceType string
+	Interface  string
+
+	// DryRun prints the planned changes to Out instead of applying them.
+	DryRun bool
+	Out    io.Writer
+}
+
+// netboxOptions returns the configuration of the -netbox-url synchronization. The token comes from
+// -netbox-token or, to keep it out of shell histories and process lists, NETBOX_TOKEN.
+func (o *Options) netboxOptions() netboxConfig {
+	token := o.NetBoxToken
+	if token == "" {
+		token = os.Getenv("NETBOX_TOKEN")
+	}
+	return netboxConfig{
+		URL:        o.NetBoxURL,
+		Token:      token,
+		Site:       o.NetBoxSite,
+		Role:       o.NetBoxRole,
+		DeviceType: o.NetBoxDeviceType,
+		Interface:  o.NetBoxInterface,
+		DryRun:     o.NetBoxDryRun,
+		Out:        o.out(),
+	}
+}
+
+// ************************************************************************************************
+// netboxSink implements -netbox-url: the up hosts are synchronized with NetBox once every input is
+// read. Each address becomes an IP address object carrying the hostname as DNS name and the MAC
+// address and vendor in its description. With -netbox-site, each host with a hostname also becomes
+// a device, with an interface the address is assigned to and set as primary IP. Existing objects
+// are updated when their fields differ; nothing is ever deleted.
+type netboxSink struct {
+	cfg     netboxConfig
+	api     string
+	client  *http.Client
+	hosts   map[string]*netboxHost
+	changes int
+}
+
+// netboxHost is the data of a host synchronized with NetBox.
+type netboxHost struct {
+	addr, hostname, mac, vendor string
+}
+
+// netboxIP, netboxDevice and netboxInterface are the fields read from the NetBox objects.
+type netboxIP struct {
+	ID                 int    `json:"id"`
+	Address            string `json:"address"`
+	DNSName            string `json:"dns_name"`
+	Description        string `json:"description"`
+	AssignedObjectType string `json:"assigned_object_type"`
+	AssignedObjectID   int    `json:"assigned_object_id"`
+}
+
+type netboxDevice struct {
+	ID         int `json:"id"`
+	PrimaryIP4 *struct {
+		ID int `json:"id"`
+	} `json:"primary_ip4"`
+	PrimaryIP6 *struct {
+		ID int `json:"id"`
+	} `json:"primary_ip6"`
+}
+
+type netboxInterface struct {
+	ID int `json:"id"`
+}
+
+// ************************************************************************************************
+// newNetBoxSink checks the configuration of the synchronization.
+func newNetBoxSink(cfg netboxConfig) (*netboxSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q, expected https://netbox.example.com", cfg.URL)
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("no API token, give -netbox-token or set NETBOX_TOKEN")
+	}
+	if cfg.Site != "" && (cfg.Role == "" || cfg.DeviceType == "") {
+		return nil, errors.New("-netbox-site needs -netbox-role and -netbox-device-type to create devices")
+	}
+	return &netboxSink{
+		cfg:    cfg,
+		api:    strings.TrimSuffix(u.String(), "/") + "/api",
+		client: &http.Client{Timeout: 30 * time.Second},
+		hosts:  make(map[string]*netboxHost),
+	}, nil
+}
+
+// Add implements HostConsumer. Hosts found in several inputs are merged.
+func (s *netboxSink) Add(h *Host) {
+	addr := h.IP()
+	if !h.IsUp() || addr == "" {
+		return
+	}
+	nh, ok := s.hosts[addr]
+	if !ok {
+		nh = &netboxHost{addr: addr}
+		s.hosts[addr] = nh
+	}
+	if len(h.Hostnames) > 0 && nh.hostname == "" {
+		nh.hostname = h.Hostnames[0].Name
+	}
+	if mac := hostAddr(h, "mac"); mac.Addr != "" && nh.mac == "" {
+		nh.mac, nh.vendor = mac.Addr, mac.Vendor
+	}
+}
+
+// Close implements hostSink: the hosts are synchronized, in address order.
+func (s *netboxSink) Close() error {
+	addrs := make([]string, 0, len(s.hosts))
+	for addr := range s.hosts {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return compareAddrs(addrs[i], addrs[j]) })
+	for _, addr := range addrs {
+		if err := s.sync(s.hosts[addr]); err != nil {
+			return fmt.Errorf("%s: %w", addr, err)
+		}
+	}
+	if s.cfg.DryRun {
+		fmt.Fprintf(s.cfg.Out, "Would apply %d NetBox changes for %d hosts\n", s.changes, len(addrs))
+		return nil
+	}
+	slog.Info("NetBox synchronized", "url", s.cfg.URL, "hosts", len(addrs), "changes", s.changes)
+	return nil
+}
+
+// sync creates or updates the objects of a host.
+func (s *netboxSink) sync(h *netboxHost) error {
+	ip, err := s.syncIP(h)
+	if err != nil || s.cfg.Site == "" || h.hostname == "" {
+		return err
+	}
+	return s.syncDevice(h, ip)
+}
+
+// syncIP creates or updates the IP address object of the host. In dry-run mode, a new address has
+// ID 0.
+func (s *netboxSink) syncIP(h *netboxHost) (*netboxIP, error) {
+	var found []netboxIP
+	if err := s.list("/ipam/ip-addresses/", url.Values{"address": {h.addr}}, &found); err != nil {
+		return nil, err
+	}
+	description := ""
+	if h.mac != "" {
+		description = strings.TrimSpace("MAC " + h.mac + " " + h.vendor)
+	}
+	if len(found) == 0 {
+		bits := 32
+		if a, err := netip.ParseAddr(h.addr); err == nil && a.Is6() {
+			bits = 128
+		}
+		fields := map[string]any{"address": fmt.Sprintf("%s/%d", h.addr, bits), "status": "active"}
+		if h.hostname != "" {
+			fields["dns_name"] = h.hostname
+		}
+		if description != "" {
+			fields["description"] = description
+		}
+		ip := &netboxIP{}
+		return ip, s.apply("create ip-address", fields["address"].(string), http.MethodPost, "/ipam/ip-addresses/", fields, ip)
+	}
+	ip := &found[0]
+	fields := map[string]any{}
+	if h.hostname != "" && ip.DNSName != h.hostname {
+		fields["dns_name"] = h.hostname
+	}
+	if description != "" && ip.Description != description {
+		fields["description"] = description
+	}
+	if len(fields) == 0 {
+		return ip, nil
+	}
+	return ip, s.apply("update ip-address", ip.Address, http.MethodPatch, "/ipam/ip-addresses/"+strconv.Itoa(ip.ID)+"/", fields, ip)
+}
+
+// syncDevice creates the device of the host when missing, with its interface, and assigns the
+// address to it as primary IP.
+func (s *netboxSink) syncDevice(h *netboxHost, ip *netboxIP) error {
+	var devices []netboxDevice
+	if err := s.list("/dcim/devices/", url.Values{"name": {h.hostname}, "site": {s.cfg.Site}}, &devices); err != nil {
+		return err
+	}
+	device := &netboxDevice{}
+	if len(devices) > 0 {
+		device = &devices[0]
+	} else {
+		fields := map[string]any{
+			"name":        h.hostname,
+			"site":        map[string]string{"slug": s.cfg.Site},
+			"role":        map[string]string{"slug": s.cfg.Role},
+			"device_type": map[string]string{"slug": s.cfg.DeviceType},
+			"status":      "active",
+		}
+		if err := s.apply("create device", h.hostname, http.MethodPost, "/dcim/devices/", fields, device); err != nil {
+			return err
+		}
+	}
+
+	iface := &netboxInterface{}
+	if device.ID != 0 {
+		var ifaces []netboxInterface
+		if err := s.list("/dcim/interfaces/", url.Values{"device_id": {strconv.Itoa(device.ID)}, "name": {s.cfg.Interface}}, &ifaces); err != nil {
+			return err
+		}
+		if len(ifaces) > 0 {
+			iface = &ifaces[0]
+		}
+	}
+	if iface.ID == 0 {
+		fields := map[string]any{"device": device.ID, "name": s.cfg.Interface, "type": "other"}
+		if h.mac != "" {
+			fields["mac_address"] = h.mac
+		}
+		if err := s.apply("create interface", h.hostname+" "+s.cfg.Interface, http.MethodPost, "/dcim/interfaces/", fields, iface); err != nil {
+			return err
+		}
+	}
+
+	if ip.AssignedObjectType != "dcim.interface" || ip.AssignedObjectID != iface.ID || iface.ID == 0 {
+		fields := map[string]any{"assigned_object_type": "dcim.interface", "assigned_object_id": iface.ID}
+		if err := s.apply("assign ip-address", h.addr+" to "+h.hostname+" "+s.cfg.Interface, http.MethodPatch, "/ipam/ip-addresses/"+strconv.Itoa(ip.ID)+"/", fields, ip); err != nil {
+			return err
+		}
+	}
+	primary, field := device.PrimaryIP4, "primary_ip4"
+	if strings.Contains(h.addr, ":") {
+		primary, field = device.PrimaryIP6, "primary_ip6"
+	}
+	if primary == nil || primary.ID != ip.ID || ip.ID == 0 {
+		return s.apply("set primary ip of device", h.hostname+" to "+h.addr, http.MethodPatch, "/dcim/devices/"+strconv.Itoa(device.ID)+"/", map[string]any{field: ip.ID}, device)
+	}
+	return nil
+}
+
+// ************************************************************************************************
+// apply performs a change, described by action and object, decoding the resulting object into out.
+// In dry-run mode the change is only printed.
+func (s *netboxSink) apply(action, object, method, path string, fields map[string]any, out any) error {
+	s.changes++
+	if s.cfg.DryRun {
+		fmt.Fprintf(s.cfg.Out, "Would %s %s%s\n", action, object, netboxFields(fields))
+		return nil
+	}
+	slog.Debug("NetBox change", "action", action, "object", object)
+	return s.do(method, path, fields, out)
+}
+
+// list returns the results of a filtered GET of a NetBox list endpoint.
+func (s *netboxSink) list(path string, query url.Values, results any) error {
+	var page struct {
+		Results json.RawMessage `json:"results"`
+	}
+	if err := s.do(http.MethodGet, path+"?"+query.Encode(), nil, &page); err != nil {
+		return err
+	}
+	return json.Unmarshal(page.Results, results)
+}
+
+// do sends a request to the NetBox API and decodes the JSON response into out.
+func (s *netboxSink) do(method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.api+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+s.cfg.Token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// netboxFields renders the fields of a change as sorted key=value pairs in parentheses, after a
+// space. References to objects not created yet (dry-run mode) have ID 0 and are left out.
+func netboxFields(fields map[string]any) string {
+	var pairs []string
+	for k, v := range fields {
+		if m, ok := v.(map[string]string); ok {
+			v = m["slug"]
+		}
+		if v == 0 {
+			continue
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	sort.Strings(pairs)
+	return " (" + strings.Join(pairs, ", ") + ")"
+}
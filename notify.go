@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// ************************************************************************************************
+// notifier implements -notify-url: the open ports of the inputs are compared to a baseline file and,
+// when new hosts or newly opened ports show up, a JSON payload listing them is POSTed to a webhook.
+// The findings are then added to the baseline, so they are only notified once. When the webhook
+// fails, the baseline is left untouched and the findings are sent again by the next run.
+type notifier struct {
+	endpoint string
+	redacted string
+	baseline string
+	client   *http.Client
+	cur      scanSnapshot
+}
+
+// notifyPayload is the JSON document POSTed to the webhook.
+type notifyPayload struct {
+	// Summary is a one-line description of the findings, for chat integrations.
+	Summary  string     `json:"summary"`
+	Time     string     `json:"time"`
+	NewHosts int        `json:"new_hosts"`
+	NewPorts int        `json:"new_ports"`
+	Findings []DiffInfo `json:"findings"`
+}
+
+// ************************************************************************************************
+// baselineFile is the JSON layout of the -notify-baseline file.
+type baselineFile struct {
+	Updated string                  `json:"updated"`
+	Hosts   map[string]baselineHost `json:"hosts"`
+}
+
+// baselineHost is a host of a baselineFile, with its open "port/proto" and their service name.
+type baselineHost struct {
+	Hostname string            `json:"hostname,omitempty"`
+	Open     map[string]string `json:"open"`
+}
+
+// ************************************************************************************************
+// newNotifier creates the notifier POSTing to rawURL the findings missing from the baseline file.
+func newNotifier(rawURL, baseline string) (*notifier, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q, expected https://host/path", rawURL)
+	}
+	return &notifier{
+		endpoint: u.String(),
+		redacted: u.Redacted(),
+		baseline: baseline,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		cur:      make(scanSnapshot),
+	}, nil
+}
+
+// Add implements HostConsumer.
+func (n *notifier) Add(h *Host) {
+	n.cur.add(h)
+}
+
+// Close implements hostSink: the findings are computed, sent and recorded in the baseline. A
+// missing baseline is created from the inputs without notification, as everything would be new.
+func (n *notifier) Close() error {
+	old, err := loadBaseline(n.baseline)
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Info("Baseline created, nothing notified", "file", n.baseline, "hosts", len(n.cur))
+		return saveBaseline(n.baseline, n.cur)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", n.baseline, err)
+	}
+
+	diff := newDiffAggregator(old)
+	diff.cur = n.cur
+	var findings []DiffInfo
+	newHosts, ports := make(map[string]bool), 0
+	for _, c := range diff.Report().Records.([]DiffInfo) {
+		switch c.Change {
+		case changeNewHost:
+			newHosts[c.IP] = true
+		case changePortOpened:
+			ports++
+		default:
+			continue
+		}
+		findings = append(findings, c)
+	}
+	if len(findings) == 0 {
+		slog.Info("No new host or port, nothing notified", "baseline", n.baseline)
+		return nil
+	}
+
+	hosts := len(newHosts)
+	payload := notifyPayload{
+		Summary:  fmt.Sprintf("nmap2csv: %d new host(s) and %d newly opened port(s) since the baseline", hosts, ports),
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		NewHosts: hosts,
+		NewPorts: ports,
+		Findings: findings,
+	}
+	if err := n.post(&payload); err != nil {
+		return err
+	}
+	slog.Info("New findings notified", "url", n.redacted, "hosts", hosts, "ports", ports)
+
+	for addr, hs := range n.cur {
+		oh, ok := old[addr]
+		if !ok {
+			old[addr] = hs
+			continue
+		}
+		if oh.hostname == "" {
+			oh.hostname = hs.hostname
+		}
+		for port, service := range hs.open {
+			oh.open[port] = service
+		}
+	}
+	return saveBaseline(n.baseline, old)
+}
+
+// post sends the payload to the webhook, which must answer with a 2xx status.
+func (n *notifier) post(payload *notifyPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// ************************************************************************************************
+// loadBaseline reads a -notify-baseline file into a snapshot.
+func loadBaseline(path string) (scanSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f baselineFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	snap := make(scanSnapshot, len(f.Hosts))
+	for addr, h := range f.Hosts {
+		if h.Open == nil {
+			h.Open = make(map[string]string)
+		}
+		snap[addr] = &hostSnapshot{hostname: h.Hostname, open: h.Open}
+	}
+	return snap, nil
+}
+
+// saveBaseline replaces the -notify-baseline file with the snapshot.
+func saveBaseline(path string, snap scanSnapshot) error {
+	f := baselineFile{Updated: time.Now().UTC().Format(time.RFC3339), Hosts: make(map[string]baselineHost, len(snap))}
+	for addr, hs := range snap {
+		f.Hosts[addr] = baselineHost{Hostname: hs.hostname, Open: hs.open}
+	}
+	err := writeOutput(path, true, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(f)
+	})
+	if err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
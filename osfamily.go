@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// OS families reported by osFamily besides the -O family names (FreeBSD, Mac OS X...).
+const (
+	familyWindows = "Windows"
+	familyLinux   = "Linux"
+	familyNetwork = "Network device"
+)
+
+// ************************************************************************************************
+// osFamily guesses the operating system family of a host, from the most to the least reliable
+// evidence: the best OS detection match, the OS reported by service banners (-sV), the open port
+// profile and the TTL of the responses. It returns "" when nothing hints at a family.
+func osFamily(h *Host) string {
+	if m := h.BestOSMatch(); m != nil && len(m.Classes) > 0 {
+		c := m.Classes[0]
+		switch {
+		case networkDeviceTypes[strings.ToLower(c.Type)]:
+			return familyNetwork
+		case c.Family != "":
+			return c.Family
+		}
+	}
+	for _, p := range h.Ports {
+		if f := bannerFamily(p.Service.OSType); f != "" {
+			return f
+		}
+	}
+	if f := portsFamily(h); f != "" {
+		return f
+	}
+	return ttlFamily(h)
+}
+
+// networkDeviceTypes are the OS detection device types of network equipment.
+var networkDeviceTypes = map[string]bool{
+	"switch": true, "router": true, "firewall": true, "bridge": true, "wap": true,
+	"broadband router": true, "load balancer": true, "proxy server": true,
+}
+
+// bannerFamily maps the OS named by a service banner to its family.
+func bannerFamily(osType string) string {
+	t := strings.ToLower(osType)
+	switch {
+	case t == "":
+		return ""
+	case strings.Contains(t, "windows"):
+		return familyWindows
+	case strings.Contains(t, "linux"), t == "unix":
+		return familyLinux
+	case t == "ios", t == "nx-os", t == "junos", t == "routeros", t == "fortios", t == "pan-os":
+		return familyNetwork
+	}
+	return ""
+}
+
+// windowsPorts are the TCP ports of Windows-only services (RPC endpoint mapper, RDP, WinRM).
+var windowsPorts = []int{135, 3389, 5985, 5986}
+
+// networkPorts are the ports network equipment typically exposes alone: telnet, SNMP, BGP, LDP,
+// NETCONF.
+var networkPorts = []int{23, 161, 162, 179, 646, 830}
+
+// portsFamily guesses the family from the open ports: Windows services, SSH or RPC bind
+// (Linux/Unix), or nothing but management protocols (network device).
+func portsFamily(h *Host) string {
+	open := make(map[int]bool)
+	for _, p := range h.Ports {
+		if p.State.State == "open" {
+			open[p.PortID] = true
+		}
+	}
+	if len(open) == 0 {
+		return ""
+	}
+	for _, id := range windowsPorts {
+		if open[id] {
+			return familyWindows
+		}
+	}
+	if open[22] || open[111] {
+		return familyLinux
+	}
+	if open[445] {
+		return familyWindows
+	}
+	for id := range open {
+		if !slices.Contains(networkPorts, id) {
+			return ""
+		}
+	}
+	return familyNetwork
+}
+
+// ttlFamily guesses the family from the highest response TTL: the initial TTL is 64 for Linux and
+// Unix, 128 for Windows and 255 for most network devices, minus one per router on the path.
+func ttlFamily(h *Host) string {
+	ttl := 0
+	if h.Status != nil {
+		ttl = h.Status.ReasonTTL
+	}
+	for _, p := range h.Ports {
+		ttl = max(ttl, p.State.ReasonTTL)
+	}
+	switch {
+	case ttl == 0:
+		return ""
+	case ttl <= 64:
+		return familyLinux
+	case ttl <= 128:
+		return familyWindows
+	}
+	return familyNetwork
+}
+
+// ************************************************************************************************
+// groupKey is a host attribute usable with -group-by.
+type groupKey struct {
+	// Header is the title of the group column.
+	Header string
+
+	// value extracts the group of a host, "" when unknown.
+	value func(h *Host) string
+}
+
+// groupKeys lists the -group-by attributes.
+var groupKeys = map[string]groupKey{
+	"osfamily":   {Header: "OSFamily", value: osFamily},
+	"devicetype": {Header: "DeviceType", value: func(h *Host) string { return h.DeviceType }},
+	"distance":   {Header: "Distance", value: hostDistance},
+}
+
+// ************************************************************************************************
+// groupAggregator implements the group mode (-group-by): the up hosts are counted per value of
+// an attribute, with their open ports. Hosts without a value are counted in an "Unknown" group.
+// Rows are sorted by descending host count.
+type groupAggregator struct {
+	key    groupKey
+	groups map[string]*GroupInfo
+}
+
+// newGroupAggregator creates an empty group mode aggregator.
+func newGroupAggregator(key groupKey) *groupAggregator {
+	return &groupAggregator{key: key, groups: make(map[string]*GroupInfo)}
+}
+
+// Add implements Aggregator.
+func (a *groupAggregator) Add(h *Host) {
+	if !h.IsUp() {
+		return
+	}
+	name := a.key.value(h)
+	if name == "" {
+		name = "Unknown"
+	}
+	g, ok := a.groups[name]
+	if !ok {
+		g = &GroupInfo{Group: name}
+		a.groups[name] = g
+	}
+	g.Hosts++
+	for _, p := range h.Ports {
+		if p.State.State == "open" {
+			g.OpenPorts++
+		}
+	}
+}
+
+// Report implements Aggregator.
+func (a *groupAggregator) Report() *Report {
+	var groups []GroupInfo
+	for _, g := range a.groups {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Hosts != groups[j].Hosts {
+			return groups[i].Hosts > groups[j].Hosts
+		}
+		return groups[i].Group < groups[j].Group
+	})
+
+	report := &Report{Headers: []string{"Count", a.key.Header, "OpenPorts"}, Records: groups}
+	for _, g := range groups {
+		report.Rows = append(report.Rows, []string{fmt.Sprint(g.Hosts), g.Group, fmt.Sprint(g.OpenPorts)})
+	}
+	return report
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ************************************************************************************************
+// hostEnricher is implemented by the -oui, -geoip... lookups completing the hosts before they are
+// filtered and delivered to the modes and exports.
+type hostEnricher interface {
+	// Enrich fills in the missing host information it knows about.
+	Enrich(h *Host)
+}
+
+// ************************************************************************************************
+// ouiTable maps MAC address prefixes, as upper-case hex digits (6 for MA-L, 7 for MA-M, 9 for MA-S
+// assignments), to the vendor they are assigned to.
+type ouiTable map[string]string
+
+// ************************************************************************************************
+// loadOUI reads a MAC prefix database. The IEEE registry files (oui.txt, oui.csv, mam.csv,
+// oui36.csv), Nmap's nmap-mac-prefixes and Wireshark's manuf file are accepted.
+func loadOUI(path string) (ouiTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	t := make(ouiTable)
+	if head, _ := br.Peek(9); string(head) == "Registry," {
+		err = t.readCSV(br)
+	} else {
+		err = t.readText(br)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(t) == 0 {
+		return nil, fmt.Errorf("%s: no MAC prefix found", path)
+	}
+	return t, nil
+}
+
+// readCSV reads the IEEE CSV registry format: Registry,Assignment,Organization Name,Address.
+func (t ouiTable) readCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return err
+	}
+	for _, rec := range records[1:] {
+		if len(rec) >= 3 {
+			t.add(rec[1], rec[2])
+		}
+	}
+	return nil
+}
+
+// readText reads the line-based formats: "00-00-0C   (hex)\t\tCisco Systems, Inc" (IEEE oui.txt),
+// "00000C Cisco Systems" (nmap-mac-prefixes) and "00:00:0C\tCisco\tCisco Systems, Inc" or
+// "00:1B:C5:00:00:00/36\t..." (Wireshark manuf, whose last column is the full vendor name).
+func (t ouiTable) readText(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' || strings.Contains(line, "(base 16)") {
+			continue
+		}
+		prefix, vendor, ok := strings.Cut(strings.ReplaceAll(line, "\t", " "), " ")
+		if !ok {
+			continue
+		}
+		vendor = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(vendor), "(hex)"))
+		if fields := strings.Split(line, "\t"); len(fields) > 2 {
+			vendor = strings.TrimSpace(fields[len(fields)-1])
+		}
+		t.add(prefix, vendor)
+	}
+	return sc.Err()
+}
+
+// add records a prefix, given with or without separators and with an optional "/bits" length.
+// Malformed prefixes are ignored.
+func (t ouiTable) add(prefix, vendor string) {
+	prefix, bits, masked := strings.Cut(prefix, "/")
+	hex := normalizeMAC(prefix)
+	if masked {
+		n, err := strconv.Atoi(bits)
+		if err != nil || n%4 != 0 || n/4 > len(hex) {
+			return
+		}
+		hex = hex[:n/4]
+	}
+	if len(hex) < 6 || vendor == "" {
+		return
+	}
+	for _, c := range hex {
+		if !strings.ContainsRune("0123456789ABCDEF", c) {
+			return
+		}
+	}
+	t[hex] = vendor
+}
+
+// normalizeMAC returns the upper-case hex digits of a MAC address or prefix.
+func normalizeMAC(s string) string {
+	return strings.ToUpper(strings.NewReplacer(":", "", "-", "", ".", "").Replace(strings.TrimSpace(s)))
+}
+
+// lookup returns the vendor of the MAC address, preferring the longest assigned prefix, or "".
+func (t ouiTable) lookup(mac string) string {
+	hex := normalizeMAC(mac)
+	for _, n := range []int{9, 7, 6} {
+		if len(hex) >= n {
+			if v, ok := t[hex[:n]]; ok {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// Enrich implements hostEnricher: the vendor of every MAC address the scanner left without one
+// is resolved from its prefix.
+func (t ouiTable) Enrich(h *Host) {
+	for i := range h.Addresses {
+		a := &h.Addresses[i]
+		if a.AddrType == "mac" && a.Vendor == "" {
+			a.Vendor = t.lookup(a.Addr)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// formatExtensions maps every output format to the file extension added by -o and -outdir.
+var formatExtensions = map[string]string{
+	formatTable: ".txt",
+	formatCSV:   ".csv",
+	formatJSON:  ".json",
+	formatJSONL: ".jsonl",
+	formatMD:    ".md",
+	formatLLD:   ".json",
+}
+
+// ************************************************************************************************
+// outputPath returns the file the output of mode m goes to, or "" for stdout.
+// With -o the given path is used, completed with the extension of the format when it has none,
+// or the path paired with the mode name when -o lists mode=path pairs (stdout for the others);
+// with -outdir every mode gets "<dir>/<mode file><ext>". Template outputs take the extension found
+// before ".tmpl" in the template name (report.html.tmpl → .html), .txt otherwise.
+func (o *Options) outputPath(m mode) string {
+	ext := o.outputExt()
+	switch {
+	case o.outputs != nil:
+		path := o.outputs[m.Name]
+		if path != "" && filepath.Ext(path) == "" {
+			return path + ext
+		}
+		return path
+	case o.Output != "":
+		if filepath.Ext(o.Output) == "" {
+			return o.Output + ext
+		}
+		return o.Output
+	case o.OutDir != "":
+		return filepath.Join(o.OutDir, m.File+ext)
+	}
+	return ""
+}
+
+// parseOutputs parses the mode=path pairs of -o, "-" designating stdout. Every mode must be
+// selected.
+func (o *Options) parseOutputs(list string) (map[string]string, error) {
+	outputs := make(map[string]string)
+	for _, pair := range strings.Split(list, ",") {
+		name, path, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		name, path = strings.TrimSpace(name), strings.TrimSpace(path)
+		if !ok || name == "" || path == "" {
+			return nil, fmt.Errorf("invalid pair %q, expected mode=path", pair)
+		}
+		if !slices.ContainsFunc(o.selectedModes(), func(m mode) bool { return m.Name == name }) {
+			return nil, fmt.Errorf("mode %q is not selected", name)
+		}
+		if path == stdinPath {
+			path = ""
+		}
+		outputs[name] = path
+	}
+	return outputs, nil
+}
+
+// outputExt returns the file extension of the outputs: the one of the format, or of the template.
+func (o *Options) outputExt() string {
+	if o.Template != "" {
+		if ext := filepath.Ext(strings.TrimSuffix(filepath.Base(o.Template), ".tmpl")); ext != "" {
+			return ext
+		}
+		return ".txt"
+	}
+	ext := formatExtensions[o.format()]
+	if ext == ".csv" && o.render.Delimiter == '\t' {
+		ext = ".tsv"
+	}
+	return ext
+}
+
+// ************************************************************************************************
+// atomicFile is an output file written to a temporary file next to its destination and renamed
+// over it on Close, so readers never see a half-written file and a failed run leaves any previous
+// version untouched.
+type atomicFile struct {
+	*os.File
+	path string
+}
+
+// ************************************************************************************************
+// createOutput opens the destination of an output: stdout when path is empty, an atomicFile
+// otherwise. Existing files are only replaced when force is set; missing parent directories are
+// created.
+func createOutput(path string, force bool) (io.WriteCloser, error) {
+	if path == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	if !force {
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("%s already exists, use -force to overwrite it", path)
+		}
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: tmp, path: path}, nil
+}
+
+// Abort discards the temporary file, leaving the destination untouched.
+func (f *atomicFile) Abort() {
+	f.File.Close()
+	os.Remove(f.Name())
+}
+
+// Close flushes the temporary file and moves it to its destination.
+func (f *atomicFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// ************************************************************************************************
+// out returns the writer of the outputs without a file, os.Stdout unless replaced.
+func (o *Options) out() io.Writer {
+	if o.stdout != nil {
+		return o.stdout
+	}
+	return os.Stdout
+}
+
+// writeOutput writes an output to path with writeOutput, or to the stdout of the options when path
+// is empty.
+func (o *Options) writeOutput(path string, write func(w io.Writer) error) error {
+	if path == "" {
+		return write(o.out())
+	}
+	return writeOutput(path, o.Force, write)
+}
+
+// ************************************************************************************************
+// writeOutput opens the destination path with createOutput and lets write fill it. When write
+// fails, a file destination is discarded instead of being committed.
+func writeOutput(path string, force bool, write func(w io.Writer) error) error {
+	out, err := createOutput(path, force)
+	if err != nil {
+		return err
+	}
+	if err := write(out); err != nil {
+		if f, ok := out.(*atomicFile); ok {
+			f.Abort()
+		}
+		return err
+	}
+	return out.Close()
+}
+
+// ************************************************************************************************
+// appendOutput adds the output produced by write at the end of the file at path, creating it (and
+// its parent directories) when missing. write is told whether the file already had content, so it
+// can skip the header. The output is rendered in memory first and appended with a single write, so
+// a failed rendering leaves the file untouched.
+func appendOutput(path string, write func(w io.Writer, existing bool) error) error {
+	existing := false
+	if fi, err := os.Stat(path); err == nil && fi.Size() > 0 {
+		existing = true
+	}
+	var buf bytes.Buffer
+	if err := write(&buf, existing); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ************************************************************************************************
+// destination returns a display name for an output path in log and dry-run messages.
+func destination(path string) string {
+	if path == "" {
+		return "stdout"
+	}
+	return path
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// PDF page geometry, in points: A4 landscape, which fits the wide host tables.
+const (
+	pdfPageWidth  = 842.0
+	pdfPageHeight = 595.0
+	pdfMargin     = 36.0
+	pdfFontSize   = 8.0
+	pdfRowHeight  = 12.0
+	pdfCellPad    = 3.0
+)
+
+// pdfSection is a titled table of the PDF report.
+type pdfSection struct {
+	Title  string
+	Report *Report
+}
+
+// ************************************************************************************************
+// writePDF writes a PDF report to path: a title page with the scan metadata (the summary mode
+// report), then one section per table, each starting on a new page and repeating its header on
+// every page it spans. The document is generated with the standard library only, using the
+// Helvetica fonts every PDF reader provides, so the text is limited to the Windows-1252 characters.
+func writePDF(path string, meta *Report, sections []pdfSection) error {
+	d := &pdfDocument{}
+	d.titlePage(meta)
+	for _, s := range sections {
+		d.section(s.Title, s.Report)
+	}
+	return writeOutput(path, true, d.write)
+}
+
+// pdfDocument accumulates the content streams of the pages of a PDF report.
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+// newPage starts a page, with the cursor below the top margin.
+func (d *pdfDocument) newPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// text draws s with its baseline at x, y.
+func (d *pdfDocument) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfString(s))
+}
+
+// fill draws a rectangle filled with the gray level g (0 black, 1 white).
+func (d *pdfDocument) fill(x, y, w, h, g float64) {
+	fmt.Fprintf(d.page, "%.2f g %.2f %.2f %.2f %.2f re f 0 g\n", g, x, y, w, h)
+}
+
+// titlePage writes the first page: the report title and the scan metadata.
+func (d *pdfDocument) titlePage(meta *Report) {
+	d.newPage()
+	d.y -= 60
+	d.text(pdfMargin, d.y, 28, true, "Nmap Scan Report")
+	d.y -= 24
+	d.text(pdfMargin, d.y, 11, false, "Generated by nmap2csv on "+time.Now().Format("2006-01-02 15:04 MST"))
+	d.y -= 48
+	if meta == nil {
+		return
+	}
+	labelWidth := 0.0
+	for _, row := range meta.Rows {
+		labelWidth = max(labelWidth, pdfTextWidth(row[0], 11, true))
+	}
+	for _, row := range meta.Rows {
+		if d.y < pdfMargin+20 {
+			break
+		}
+		d.text(pdfMargin, d.y, 11, true, row[0])
+		value := pdfTruncate(row[1], pdfPageWidth-2*pdfMargin-labelWidth-20, 11, false)
+		d.text(pdfMargin+labelWidth+20, d.y, 11, false, value)
+		d.y -= 18
+	}
+}
+
+// section writes a titled table, starting on a new page. Column widths follow their content, the
+// widest columns being narrowed (and their cells truncated) when the table is wider than the page.
+func (d *pdfDocument) section(title string, r *Report) {
+	d.newPage()
+	d.text(pdfMargin, d.y-14, 16, true, title)
+	d.y -= 34
+	if r == nil || len(r.Rows) == 0 {
+		d.text(pdfMargin, d.y, 10, false, "No data.")
+		return
+	}
+
+	natural := make([]float64, len(r.Headers))
+	for i, h := range r.Headers {
+		natural[i] = pdfTextWidth(h, pdfFontSize, true)
+	}
+	for _, row := range r.Rows {
+		for i, c := range row {
+			if i < len(natural) {
+				natural[i] = max(natural[i], pdfTextWidth(c, pdfFontSize, false))
+			}
+		}
+	}
+	widths := pdfColumnWidths(natural, pdfPageWidth-2*pdfMargin)
+	numeric := numericColumns(r)
+
+	drawRow := func(cells []string, header bool, shade float64) {
+		total := 0.0
+		for _, w := range widths {
+			total += w
+		}
+		if shade < 1 {
+			d.fill(pdfMargin, d.y-3, total, pdfRowHeight, shade)
+		}
+		x := pdfMargin
+		for i, c := range cells {
+			if i >= len(widths) {
+				break
+			}
+			if c == "" {
+				x += widths[i]
+				continue
+			}
+			c = pdfTruncate(c, widths[i]-2*pdfCellPad, pdfFontSize, header)
+			tx := x + pdfCellPad
+			if !header && i < len(numeric) && numeric[i] {
+				tx = x + widths[i] - pdfCellPad - pdfTextWidth(c, pdfFontSize, false)
+			}
+			d.text(tx, d.y, pdfFontSize, header, c)
+			x += widths[i]
+		}
+		d.y -= pdfRowHeight
+	}
+
+	drawRow(r.Headers, true, 0.85)
+	for i, row := range r.Rows {
+		if d.y < pdfMargin+pdfRowHeight {
+			d.newPage()
+			drawRow(r.Headers, true, 0.85)
+		}
+		shade := 1.0
+		if i%2 == 1 {
+			shade = 0.95
+		}
+		drawRow(row, false, shade)
+	}
+}
+
+// write renders the document: catalog, page tree, the two fonts, then a page object and a
+// compressed content stream per page, followed by the cross-reference table.
+func (d *pdfDocument) write(w io.Writer) error {
+	var b bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 to 4 are fixed; the pages follow, two objects each.
+	const firstPage = 5
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range d.pages {
+		footer := fmt.Sprintf("Page %d of %d", i+1, len(d.pages))
+		fmt.Fprintf(content, "0.4 g BT /F1 8 Tf %.2f %.2f Td (%s) Tj ET 0 g\n",
+			pdfPageWidth-pdfMargin-pdfTextWidth(footer, 8, false), pdfMargin/2, footer)
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(content.Bytes())
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, firstPage+2*i+1))
+		obj(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", z.Len(), z.Bytes()))
+	}
+	info := fmt.Sprintf("<< /Title (Nmap Scan Report) /Producer (nmap2csv) /CreationDate (D:%s) >>", time.Now().UTC().Format("20060102150405Z"))
+	obj(info)
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, len(offsets), xref)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// ************************************************************************************************
+// pdfColumnWidths distributes the available width between columns of the given natural widths
+// (content plus padding): columns narrower than an even share keep their width and the remaining
+// space is shared evenly by the wider ones.
+func pdfColumnWidths(natural []float64, available float64) []float64 {
+	widths := make([]float64, len(natural))
+	fixed := make([]bool, len(natural))
+	remaining, open := available, len(natural)
+	for open > 0 {
+		share := remaining / float64(open)
+		changed := false
+		for i, n := range natural {
+			if !fixed[i] && n+2*pdfCellPad <= share {
+				widths[i], fixed[i] = n+2*pdfCellPad, true
+				remaining -= widths[i]
+				open--
+				changed = true
+			}
+		}
+		if !changed {
+			for i := range natural {
+				if !fixed[i] {
+					widths[i] = share
+				}
+			}
+			break
+		}
+	}
+	return widths
+}
+
+// pdfTruncate shortens s with an ellipsis so that it fits in width.
+func pdfTruncate(s string, width, size float64, bold bool) string {
+	width += 0.01 // rounding of the column width computations
+	if pdfTextWidth(s, size, bold) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && pdfTextWidth(string(runes)+"...", size, bold) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// pdfString encodes s as the content of a PDF literal string in the WinAnsi encoding of the fonts.
+// Characters outside of it are replaced with '?'.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		c := pdfWinAnsi(r)
+		if c == '\\' || c == '(' || c == ')' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// pdfWinAnsi returns the WinAnsi code of r: ASCII and Latin-1 characters map to themselves, others
+// (and control characters) to '?'.
+func pdfWinAnsi(r rune) byte {
+	switch {
+	case r == '\t':
+		return ' '
+	case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+		return byte(r)
+	}
+	return '?'
+}
+
+// pdfTextWidth returns the width in points of s in Helvetica (or Helvetica-Bold) at size.
+func pdfTextWidth(s string, size float64, bold bool) float64 {
+	widths := &helveticaWidths
+	if bold {
+		widths = &helveticaBoldWidths
+	}
+	units := 0
+	for _, r := range s {
+		if c := pdfWinAnsi(r); c < 0x7f {
+			units += int(widths[c-0x20])
+		} else {
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+// helveticaWidths and helveticaBoldWidths are the advance widths, in thousandths of the font size,
+// of the printable ASCII characters (0x20 to 0x7e), from the Adobe font metrics.
+var (
+	helveticaWidths = [95]uint16{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]uint16{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
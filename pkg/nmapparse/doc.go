@@ -0,0 +1,32 @@
+// Package nmapparse reads scan results and summarizes them, the core of the nmap2csv command.
+//
+// Nmap XML (plain, gzip-compressed or zipped), Nmap greppable and normal output, Nessus v2 exports,
+// masscan and naabu JSON and RustScan greppable output are understood, the format being detected
+// from the content. Stream passes the hosts one at a time, so that large scans are processed with a
+// roughly constant footprint; Parse reads a whole document:
+//
+//	f, err := os.Open("scan.xml")
+//	if err != nil {
+//		return err
+//	}
+//	defer f.Close()
+//	run, err := nmapparse.Parse(f)
+//	if err != nil {
+//		return err
+//	}
+//	filter := nmapparse.NewPortFilter("445,3389", "", "", nil)
+//	for _, h := range nmapparse.HostSummaries(run, filter) {
+//		fmt.Println(h.IPv4, h.Hostname, h.Ports)
+//	}
+//	for _, p := range nmapparse.PortStats(run) {
+//		fmt.Println(p.Count, p.Key, p.Service)
+//	}
+//
+// PortCounter and VendorCounter compute the same statistics as PortStats and VendorStats one host
+// at a time, for use with Stream. MergeRuns merges the hosts of several scans by address.
+//
+// Inputs may come from untrusted parties: XML entity declarations are rejected, no piece of a
+// document larger than MaxElementSize is read into memory and zip archives read from a stream are
+// only buffered up to MaxArchiveSize. The hosts of interrupted scans, whose XML ends before the
+// closing </nmaprun>, are read up to the last complete one and the error wraps ErrTruncated.
+package nmapparse
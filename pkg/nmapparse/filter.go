@@ -0,0 +1,218 @@
+package nmapparse
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ************************************************************************************************
+// PortFilter selects ports by number, range or service name (every port when no list is given),
+// minus the excluded ports, restricted to a set of port states: the -whereport, -whereservice,
+// -excludeport and -state options of nmap2csv.
+type PortFilter struct {
+	spec     string
+	all      bool
+	include  *PortSpec
+	services []string
+	exclude  PortSpec
+	states   PortStates
+	minConf  int
+	sslOnly  bool
+}
+
+// NewPortFilter creates the filter of the comma-separated port (in the ParsePortSpec syntax),
+// service and excluded port lists, selecting the ports in one of states (open ports when nil).
+func NewPortFilter(wherePorts, whereServices, excludePorts string, states PortStates) *PortFilter {
+	f := &PortFilter{exclude: ParsePortSpec(excludePorts), states: states}
+	var spec []string
+	if wherePorts != "" {
+		include := ParsePortSpec(wherePorts)
+		f.include = &include
+		spec = append(spec, "whereport="+wherePorts)
+	}
+	for _, name := range strings.Split(whereServices, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if aliases, ok := ServiceAliases[name]; ok {
+			f.services = append(f.services, aliases...)
+		}
+		f.services = append(f.services, name)
+	}
+	if len(f.services) > 0 {
+		spec = append(spec, "whereservice="+whereServices)
+	}
+	f.spec = strings.Join(spec, " ")
+	f.all = f.include == nil && len(f.services) == 0
+	return f
+}
+
+// String returns the port and service lists of the filter, empty when every port is selected.
+func (f *PortFilter) String() string {
+	return f.spec
+}
+
+// All reports whether the filter has no port or service list, selecting every port but the
+// excluded ones.
+func (f *PortFilter) All() bool {
+	return f.all
+}
+
+// WithMinConf restricts the filter to the ports whose service was identified with a confidence of
+// at least conf (the -min-conf option of nmap2csv), dropping the table guesses of the services
+// below it. A conf of 0 keeps every port. It returns f.
+func (f *PortFilter) WithMinConf(conf int) *PortFilter {
+	f.minConf = conf
+	if conf > 0 {
+		f.spec = strings.TrimSpace(f.spec + " min-conf=" + strconv.Itoa(conf))
+	}
+	return f
+}
+
+// WithSSLOnly restricts the filter to the ports whose service is wrapped in SSL/TLS (see Port.TLS),
+// whatever their number, when sslOnly is set: the -ssl-only option of nmap2csv. It returns f.
+func (f *PortFilter) WithSSLOnly(sslOnly bool) *PortFilter {
+	f.sslOnly = sslOnly
+	if sslOnly {
+		f.spec = strings.TrimSpace(f.spec + " ssl-only")
+	}
+	return f
+}
+
+// ServiceAliases maps the common names accepted in the service list of a PortFilter to the Nmap service names.
+var ServiceAliases = map[string][]string{
+	"smb":   {"microsoft-ds", "netbios-ssn"},
+	"rdp":   {"ms-wbt-server"},
+	"mssql": {"ms-sql-s"},
+	"vnc":   {"vnc-http"},
+	"winrm": {"wsman", "wsmans"},
+}
+
+// Match reports whether the port is selected by the filter. The port state is not considered.
+func (f *PortFilter) Match(p *Port) bool {
+	if f.Excluded(p) || (f.sslOnly && !p.TLS()) {
+		return false
+	}
+	if f.include != nil && !f.include.Match(p) {
+		return false
+	}
+	return len(f.services) == 0 || f.matchService(p.Service.Name)
+}
+
+// matchService reports whether a detected service name is selected by the filter: exactly, or as
+// a variant of a selected name (ms-sql matches ms-sql-s and ms-sql-m).
+func (f *PortFilter) matchService(name string) bool {
+	name = strings.ToLower(name)
+	if name == "" {
+		return false
+	}
+	for _, s := range f.services {
+		if name == s || strings.HasPrefix(name, s+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// Selected reports whether the port is in one of the selected states and matches the filter.
+func (f *PortFilter) Selected(p *Port) bool {
+	return f.states.Has(p) && f.Match(p)
+}
+
+// Excluded reports whether the port is in the excluded list or its service was identified with a
+// confidence below the WithMinConf one: such ports are not counted as open either.
+func (f *PortFilter) Excluded(p *Port) bool {
+	return f.exclude.Match(p) || p.Service.Conf < f.minConf
+}
+
+// ************************************************************************************************
+// PortStates is a set of selected port states.
+type PortStates map[string]bool
+
+// KnownStates lists the port states reported by Nmap.
+var KnownStates = []string{"open", "closed", "filtered", "unfiltered", "open|filtered", "closed|filtered"}
+
+// ParsePortStates parses a comma-separated list of port states. Only open ports are selected when
+// it is empty. States are matched exactly: "open" does not select "open|filtered" UDP results,
+// which must be listed explicitly.
+func ParsePortStates(list string) (PortStates, error) {
+	s := make(PortStates)
+	for _, state := range strings.Split(list, ",") {
+		state = strings.ToLower(strings.TrimSpace(state))
+		if state == "" {
+			continue
+		}
+		if !slices.Contains(KnownStates, state) {
+			return nil, fmt.Errorf("unknown port state %q, expected one of %s", state, strings.Join(KnownStates, ","))
+		}
+		s[state] = true
+	}
+	if len(s) == 0 {
+		s["open"] = true
+	}
+	return s, nil
+}
+
+// Has reports whether the state of the port is selected. A nil set selects open ports only.
+func (s PortStates) Has(p *Port) bool {
+	if s == nil {
+		return p.State.State == "open"
+	}
+	return s[p.State.State]
+}
+
+// OpenOnly reports whether only open ports are selected, in which case the outputs do not need to
+// show the port state.
+func (s PortStates) OpenOnly() bool {
+	return len(s) == 0 || (len(s) == 1 && s["open"])
+}
+
+// ************************************************************************************************
+// PortSpec is a list of port numbers, port ranges and service names.
+type PortSpec struct {
+	Ports  map[int]bool
+	Ranges [][2]int
+	Names  map[string]bool
+}
+
+// ParsePortSpec parses a comma-separated list of ports ("445"), inclusive ranges ("8000-8100") and
+// service names ("http"), the latter matched case-insensitively against the detected service.
+func ParsePortSpec(list string) PortSpec {
+	s := PortSpec{Ports: make(map[int]bool), Names: make(map[string]bool)}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(entry); err == nil {
+			s.Ports[n] = true
+			continue
+		}
+		if lo, hi, ok := strings.Cut(entry, "-"); ok {
+			l, errL := strconv.Atoi(strings.TrimSpace(lo))
+			h, errH := strconv.Atoi(strings.TrimSpace(hi))
+			if errL == nil && errH == nil {
+				s.Ranges = append(s.Ranges, [2]int{min(l, h), max(l, h)})
+				continue
+			}
+		}
+		s.Names[strings.ToLower(entry)] = true
+	}
+	return s
+}
+
+// Match reports whether the port is listed.
+func (s PortSpec) Match(p *Port) bool {
+	if s.Ports[p.PortID] {
+		return true
+	}
+	for _, r := range s.Ranges {
+		if p.PortID >= r[0] && p.PortID <= r[1] {
+			return true
+		}
+	}
+	return p.Service.Name != "" && s.Names[strings.ToLower(p.Service.Name)]
+}
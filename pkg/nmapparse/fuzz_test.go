@@ -0,0 +1,191 @@
+package nmapparse
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fuzzMaxElementSize is the MaxElementSize the parsers are fuzzed with, small enough for the fuzzer
+// to reach it.
+const fuzzMaxElementSize = 4096
+
+// readAhead is the number of bytes a decoder may have buffered beyond the element being decoded
+// when its size guard is reset: one block of the bufio.Reader of encoding/xml.
+const readAhead = 4096
+
+// fuzzXML is a complete Nmap XML document exercising most of the model.
+const fuzzXML = `<?xml version="1.0" encoding="UTF-8"?>
+<nmaprun scanner="nmap" args="nmap -sV -O 10.0.0.0/24" start="1700000000" version="7.94">
+<host starttime="1700000001" endtime="1700000050"><status state="up" reason="arp-response" reason_ttl="0"/>
+<address addr="10.0.0.1" addrtype="ipv4"/><address addr="00:11:22:33:44:55" addrtype="mac" vendor="Cisco"/>
+<hostnames><hostname name="gw.lan" type="PTR"/></hostnames>
+<ports><extraports state="filtered" count="997"/>
+<port protocol="tcp" portid="22"><state state="open" reason="syn-ack" reason_ttl="64"/><service name="ssh" product="OpenSSH" version="8.9p1" method="probed" conf="10"><cpe>cpe:/a:openbsd:openssh:8.9p1</cpe></service></port>
+<port protocol="tcp" portid="443"><state state="open" reason="syn-ack" reason_ttl="64"/><service name="http" product="nginx" tunnel="ssl" method="probed" conf="10"/><script id="http-title" output="Router login"><elem key="title">Router login</elem></script></port>
+</ports>
+<os><osmatch name="Linux 5.0 - 5.14" accuracy="95"><osclass type="general purpose" vendor="Linux" osfamily="Linux" osgen="5.X" accuracy="95"><cpe>cpe:/o:linux:linux_kernel:5</cpe></osclass></osmatch></os>
+<distance value="1"/><times srtt="1200" rttvar="300" to="100000"/>
+</host>
+<runstats><finished time="1700000060" elapsed="60"/><hosts up="1" down="0" total="1"/></runstats>
+</nmaprun>
+`
+
+// fuzzSeeds are the initial inputs of FuzzStream: one per format, and the hostile documents the
+// limits are meant to stop.
+var fuzzSeeds = map[string]string{
+	"xml":       fuzzXML,
+	"entity":    `<?xml version="1.0"?><!DOCTYPE nmaprun [<!ENTITY a "aaaaaaaaaa"><!ENTITY b "&a;&a;&a;&a;&a;&a;&a;&a;&a;&a;">]><nmaprun><host><hostnames><hostname name="&b;"/></hostnames></host></nmaprun>`,
+	"nesting":   "<nmaprun>" + strings.Repeat("<a>", maxXMLDepth+1) + strings.Repeat("</a>", maxXMLDepth+1) + "</nmaprun>",
+	"truncated": fuzzXML[:strings.Index(fuzzXML, "<os>")],
+	"attribute": `<nmaprun><host><address addr="` + strings.Repeat("A", 2*fuzzMaxElementSize) + `" addrtype="ipv4"/></host></nmaprun>`,
+	"gnmap": "# Nmap 7.94 scan initiated as: nmap -oG - 10.0.0.1\n" +
+		"Host: 10.0.0.1 (gw.lan)\tStatus: Up\n" +
+		"Host: 10.0.0.1 (gw.lan)\tPorts: 22/open/tcp//ssh//OpenSSH 8.9p1/, 443/open/tcp//ssl|http//nginx/\tIgnored State: filtered (998)\n",
+	"gnmap-line": "Host: 10.0.0.1 ()\tPorts: " + strings.Repeat("22/open/tcp//ssh///, ", fuzzMaxElementSize/10) + "\n",
+	"normal": "Nmap scan report for gw.lan (10.0.0.1)\nHost is up (0.0012s latency).\nNot shown: 998 filtered tcp ports (no-response)\n" +
+		"PORT    STATE SERVICE  VERSION\n22/tcp  open  ssh      OpenSSH 8.9p1\n443/tcp open  ssl/http nginx\n",
+	"masscan":  `[{"ip": "10.0.0.1", "timestamp": "1700000000", "ports": [{"port": 80, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64}]},{"finished": 1}]`,
+	"naabu":    "{\"host\":\"gw.lan\",\"ip\":\"10.0.0.1\",\"port\":443,\"protocol\":\"tcp\"}\n{\"host\":\"gw.lan\",\"ip\":\"10.0.0.1\",\"port\":22,\"protocol\":\"tcp\"}\n",
+	"rustscan": "Open 10.0.0.1:22\n10.0.0.1 -> [22,80,443]\n10.0.0.2 -> [3389]\n",
+}
+
+// ************************************************************************************************
+// setMaxElementSize lowers MaxElementSize for the duration of the test.
+func setMaxElementSize(tb testing.TB, size int64) {
+	prev := MaxElementSize
+	MaxElementSize = size
+	tb.Cleanup(func() { MaxElementSize = prev })
+}
+
+// ************************************************************************************************
+// longestString returns the length of the longest string held by v, walking structs, pointers
+// and slices.
+func longestString(v reflect.Value) int {
+	longest := 0
+	switch v.Kind() {
+	case reflect.String:
+		longest = v.Len()
+	case reflect.Pointer:
+		if !v.IsNil() {
+			longest = longestString(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			longest = max(longest, longestString(v.Field(i)))
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			longest = max(longest, longestString(v.Index(i)))
+		}
+	}
+	return longest
+}
+
+// ************************************************************************************************
+// FuzzStream feeds arbitrary inputs to Stream, through the detection of every format (XML, gnmap,
+// normal, port JSON, RustScan). Parsing must neither panic nor hand out a value larger than
+// MaxElementSize, whatever the input.
+func FuzzStream(f *testing.F) {
+	setMaxElementSize(f, fuzzMaxElementSize)
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Stream(bytes.NewReader(data), func(h *Host) error {
+			if n := longestString(reflect.ValueOf(h)); n > fuzzMaxElementSize+readAhead {
+				t.Fatalf("host holds a value of %d bytes, beyond MaxElementSize (%d)", n, fuzzMaxElementSize)
+			}
+			return nil
+		}, nil)
+	})
+}
+
+// ************************************************************************************************
+// TestStreamLimits checks the outcome of the seeds of FuzzStream.
+func TestStreamLimits(t *testing.T) {
+	setMaxElementSize(t, fuzzMaxElementSize)
+	tests := []struct {
+		seed  string
+		hosts int
+		err   error
+	}{
+		{"xml", 1, nil},
+		{"entity", 0, ErrEntityDeclaration},
+		{"nesting", 0, errors.New("nested")},
+		{"truncated", 0, ErrTruncated},
+		{"attribute", 0, ErrElementTooLarge},
+		{"gnmap", 1, nil},
+		{"gnmap-line", 0, ErrElementTooLarge},
+		{"normal", 1, nil},
+		{"masscan", 1, nil},
+		{"naabu", 1, nil},
+		{"rustscan", 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.seed, func(t *testing.T) {
+			hosts := 0
+			_, err := Stream(strings.NewReader(fuzzSeeds[tt.seed]), func(h *Host) error {
+				hosts++
+				return nil
+			}, nil)
+			switch {
+			case tt.err == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != nil && err == nil:
+				t.Fatalf("expected an error matching %q", tt.err)
+			case tt.err != nil && !errors.Is(err, tt.err) && !strings.Contains(err.Error(), tt.err.Error()):
+				t.Fatalf("error %q does not match %q", err, tt.err)
+			}
+			if hosts != tt.hosts {
+				t.Errorf("got %d hosts, want %d", hosts, tt.hosts)
+			}
+		})
+	}
+}
+
+// ************************************************************************************************
+// TestStreamZipLimit checks that zip archives read from a stream are only buffered up to
+// MaxArchiveSize.
+func TestStreamZipLimit(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	w, err := zw.Create("scan.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, fuzzXML)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	prev := MaxArchiveSize
+	t.Cleanup(func() { MaxArchiveSize = prev })
+
+	tests := []struct {
+		limit int64
+		hosts int
+		err   error
+	}{
+		{int64(archive.Len()), 1, nil},
+		{int64(archive.Len()) - 1, 0, ErrArchiveTooLarge},
+	}
+	for _, tt := range tests {
+		MaxArchiveSize = tt.limit
+		hosts := 0
+		// io.MultiReader hides the io.ReaderAt of the buffer, as stdin would.
+		_, err := Stream(io.MultiReader(bytes.NewReader(archive.Bytes())), func(h *Host) error {
+			hosts++
+			return nil
+		}, nil)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("limit %d: got error %v, want %v", tt.limit, err, tt.err)
+		}
+		if hosts != tt.hosts {
+			t.Errorf("limit %d: got %d hosts, want %d", tt.limit, hosts, tt.hosts)
+		}
+	}
+}
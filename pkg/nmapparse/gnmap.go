@@ -0,0 +1,117 @@
+package nmapparse
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ************************************************************************************************
+// streamGnmap parses Nmap grepable output (-oG) from r and passes each host to fn.
+// Grepable output spreads a host over several consecutive "Host:" lines (one with the status, one
+// with the ports); they are merged into a single Host before fn is called. Ports are converted to
+// the same model as the XML parser so that every mode behaves identically for both formats.
+func streamGnmap(r io.Reader, fn HostHandler) (int, error) {
+	sc := newLineScanner(r)
+
+	count := 0
+	var cur *Host
+	var curIP string
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		count++
+		h := cur
+		cur = nil
+		return fn(h)
+	}
+
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "Host: ") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		ip, name := parseGnmapHostField(strings.TrimPrefix(fields[0], "Host: "))
+		if cur == nil || ip != curIP {
+			if err := flush(); err != nil {
+				return count, err
+			}
+			cur = &Host{Addresses: []Address{{Addr: ip, AddrType: addrTypeOf(ip)}}}
+			curIP = ip
+		}
+		if name != "" && len(cur.Hostnames) == 0 {
+			cur.Hostnames = []Hostname{{Name: name}}
+		}
+		for _, field := range fields[1:] {
+			if status, ok := strings.CutPrefix(field, "Status: "); ok {
+				cur.Status = &Status{State: strings.ToLower(strings.TrimSpace(status))}
+			}
+			// "Ignored State: filtered (997)"
+			if ignored, ok := strings.CutPrefix(field, "Ignored State: "); ok {
+				state, count, _ := strings.Cut(strings.TrimSuffix(strings.TrimSpace(ignored), ")"), " (")
+				if n, err := strconv.Atoi(count); err == nil {
+					cur.ExtraPorts = append(cur.ExtraPorts, ExtraPorts{State: state, Count: n})
+				}
+			}
+			if ports, ok := strings.CutPrefix(field, "Ports: "); ok {
+				for _, entry := range strings.Split(ports, ", ") {
+					if p, ok := parseGnmapPort(entry); ok {
+						cur.Ports = append(cur.Ports, p)
+					}
+				}
+			}
+		}
+	}
+	if err := lineError(sc); err != nil {
+		return count, err
+	}
+	return count, flush()
+}
+
+// ************************************************************************************************
+// parseGnmapHostField splits the "10.0.0.1 (host.example)" value of a Host: field into the
+// address and the hostname, the latter being empty when nmap did not resolve one.
+func parseGnmapHostField(s string) (ip, name string) {
+	ip, rest, _ := strings.Cut(strings.TrimSpace(s), " ")
+	name = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(rest), "("), ")")
+	return ip, name
+}
+
+// ************************************************************************************************
+// parseGnmapPort converts one "port/state/protocol/owner/service/rpcinfo/version/" entry of the
+// Ports: field into a Port. It reports false for malformed entries.
+func parseGnmapPort(entry string) (Port, bool) {
+	parts := strings.Split(strings.TrimSpace(entry), "/")
+	if len(parts) < 5 {
+		return Port{}, false
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Port{}, false
+	}
+	p := Port{
+		Protocol: parts[2],
+		PortID:   id,
+		State:    State{State: parts[1]},
+		Service:  Service{Name: parts[4]},
+	}
+	// Grepable output writes the services wrapped in SSL/TLS as ssl|http.
+	if name, ok := strings.CutPrefix(p.Service.Name, "ssl|"); ok {
+		p.Service.Name, p.Service.Tunnel = name, "ssl"
+	}
+	if len(parts) > 6 {
+		p.Service.Product = parts[6]
+	}
+	return p, true
+}
+
+// ************************************************************************************************
+// addrTypeOf returns the Nmap addrtype ("ipv4" or "ipv6") matching a textual IP address.
+func addrTypeOf(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "ipv6"
+	}
+	return "ipv4"
+}
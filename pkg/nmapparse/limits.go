@@ -0,0 +1,91 @@
+package nmapparse
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MaxElementSize is the largest size, in bytes, of a single piece of a scan read at once: an XML
+// element decoded as a whole (a <host>, the <runstats>), a start tag with its attributes, the text
+// between two elements, a JSON record, or a line of the text formats. It keeps a hostile or
+// corrupted input from exhausting the memory with an enormous value; such inputs fail with
+// ErrElementTooLarge. It may be raised before parsing scans with very long script outputs.
+var MaxElementSize int64 = 64 << 20
+
+// MaxArchiveSize is the largest size, in bytes, of a zip archive read from a stream without random
+// access (stdin, a network connection), which must be buffered in memory before its entries can be
+// read. Larger archives fail with ErrArchiveTooLarge; archives stored in files are not limited.
+var MaxArchiveSize int64 = 512 << 20
+
+// Errors returned for the inputs rejected by the parsers.
+var (
+	// ErrElementTooLarge is returned when a piece of a scan exceeds MaxElementSize.
+	ErrElementTooLarge = errors.New("element exceeds the maximum size")
+
+	// ErrArchiveTooLarge is returned when a zip archive read from a stream exceeds MaxArchiveSize.
+	ErrArchiveTooLarge = errors.New("archive exceeds the maximum size")
+
+	// ErrEntityDeclaration is returned for XML documents declaring entities in their DOCTYPE, which
+	// scanners never write and which are the vector of entity expansion ("billion laughs") attacks.
+	ErrEntityDeclaration = errors.New("XML entity declarations are not supported")
+
+	// ErrTruncated is returned for XML documents ending before their root element is closed, such as
+	// the output of an interrupted scan. The hosts completely read before the end have been passed to
+	// the HostHandler nonetheless.
+	ErrTruncated = errors.New("document truncated")
+)
+
+// ************************************************************************************************
+// sizeGuard limits the number of bytes read from r between two calls to reset to MaxElementSize,
+// failing the reads with ErrElementTooLarge beyond. The decoders read ahead in small blocks, so the
+// limit applies to the element being decoded give or take one block.
+type sizeGuard struct {
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+// newSizeGuard wraps r with the current MaxElementSize.
+func newSizeGuard(r io.Reader) *sizeGuard {
+	return &sizeGuard{r: r, limit: MaxElementSize}
+}
+
+// Read implements io.Reader.
+func (g *sizeGuard) Read(p []byte) (int, error) {
+	if g.n >= g.limit {
+		return 0, fmt.Errorf("%w of %d bytes", ErrElementTooLarge, g.limit)
+	}
+	if int64(len(p)) > g.limit-g.n {
+		p = p[:g.limit-g.n]
+	}
+	n, err := g.r.Read(p)
+	g.n += int64(n)
+	return n, err
+}
+
+// reset starts counting the bytes of the next element.
+func (g *sizeGuard) reset() {
+	g.n = 0
+}
+
+// ************************************************************************************************
+// newLineScanner returns a scanner over the lines of r, each limited to MaxElementSize.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	limit := int(min(MaxElementSize, math.MaxInt))
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, min(64*1024, limit)), limit)
+	return sc
+}
+
+// lineError returns the error of a line scanner, reporting lines over the limit as
+// ErrElementTooLarge.
+func lineError(sc *bufio.Scanner) error {
+	err := sc.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("%w of %d bytes", ErrElementTooLarge, MaxElementSize)
+	}
+	return err
+}
@@ -0,0 +1,29 @@
+package nmapparse
+
+import "slices"
+
+// ************************************************************************************************
+// MergeRuns merges several scans into a single one, such as the TCP and UDP scans of the same
+// network: hosts sharing the same primary address are merged by MergeHost, as the -merge-by ip
+// option of the command does across its inputs. Hosts keep their first-seen order, the scan
+// information is the first one found, and the runs are left unmodified.
+func MergeRuns(runs ...*NmapRun) *NmapRun {
+	merged := &NmapRun{}
+	merger := NewCoalescer(nil)
+	for _, run := range runs {
+		if merged.Meta == nil {
+			merged.Meta = run.Meta
+		}
+		for _, h := range run.Hosts {
+			h.Addresses = slices.Clone(h.Addresses)
+			h.Ports = slices.Clone(h.Ports)
+			h.Scripts = slices.Clone(h.Scripts)
+			merger.Add(&h)
+		}
+	}
+	merger.Flush(func(h *Host) error {
+		merged.Hosts = append(merged.Hosts, *h)
+		return nil
+	})
+	return merged
+}
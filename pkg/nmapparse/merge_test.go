@@ -0,0 +1,40 @@
+package nmapparse
+
+import (
+	"fmt"
+	"testing"
+)
+
+// ************************************************************************************************
+// benchRun returns a scan of n hosts numbered from first, each with two open TCP ports and a UDP
+// port in the given state, so that merging two scans of the same hosts updates them.
+func benchRun(first, n int, udpState string) *NmapRun {
+	run := &NmapRun{Hosts: make([]Host, n)}
+	for i := range run.Hosts {
+		id := first + i
+		run.Hosts[i] = Host{
+			Status:    &Status{State: "up"},
+			Addresses: []Address{{Addr: fmt.Sprintf("10.%d.%d.%d", id>>16&0xff, id>>8&0xff, id&0xff), AddrType: "ipv4"}},
+			Hostnames: []Hostname{{Name: fmt.Sprintf("host%d.lan", id)}},
+			Ports: []Port{
+				{Protocol: "tcp", PortID: 22, State: State{State: "open"}, Service: Service{Name: "ssh"}},
+				{Protocol: "tcp", PortID: 443, State: State{State: "open"}, Service: Service{Name: "https"}},
+				{Protocol: "udp", PortID: 161, State: State{State: udpState}, Service: Service{Name: "snmp"}},
+			},
+		}
+	}
+	return run
+}
+
+// ************************************************************************************************
+// BenchmarkMergeRuns_5000 merges two scans of 5000 hosts sharing half of them (7500 distinct
+// hosts), reporting the time and allocations of MergeRuns.
+func BenchmarkMergeRuns_5000(b *testing.B) {
+	a, c := benchRun(0, 5000, "open|filtered"), benchRun(2500, 5000, "open")
+	b.ReportAllocs()
+	for b.Loop() {
+		if merged := MergeRuns(a, c); len(merged.Hosts) != 7500 {
+			b.Fatalf("got %d merged hosts, want 7500", len(merged.Hosts))
+		}
+	}
+}
@@ -0,0 +1,536 @@
+package nmapparse
+
+import (
+	"slices"
+	"strings"
+)
+
+// ************************************************************************************************
+// NmapRun represents the root structure of an Nmap XML scan output.
+// It contains a collection of all scanned hosts with their associated information.
+type NmapRun struct {
+	Hosts []Host `xml:"host"`
+
+	// Meta is the scan-level information of the document, nil for formats that carry none.
+	Meta *ScanMeta `xml:"-"`
+}
+
+// ************************************************************************************************
+// ScanMeta holds the scan-level information of an Nmap XML document: the attributes of the
+// <nmaprun> root element and the <runstats> element.
+type ScanMeta struct {
+	// Scanner, Version and Args identify the tool and command line that produced the scan.
+	Scanner string
+	Version string
+	Args    string
+
+	// Start is the Unix time at which the scan started, 0 when unknown.
+	Start int64
+
+	// RunStats holds the final statistics written by the scanner.
+	RunStats RunStats
+}
+
+// ************************************************************************************************
+// RunStats represents the <runstats> element closing an Nmap XML scan.
+type RunStats struct {
+	// Finished describes the end of the scan.
+	Finished struct {
+		// Time is the Unix time at which the scan ended.
+		Time int64 `xml:"time,attr"`
+
+		// Elapsed is the scan duration, in seconds.
+		Elapsed float64 `xml:"elapsed,attr"`
+	} `xml:"finished"`
+
+	// Hosts holds the number of hosts found up and down, including the down hosts Nmap does not
+	// list in the document.
+	Hosts struct {
+		Up    int `xml:"up,attr"`
+		Down  int `xml:"down,attr"`
+		Total int `xml:"total,attr"`
+	} `xml:"hosts"`
+}
+
+// ************************************************************************************************
+// Host represents a single scanned host in the Nmap output.
+// It contains network addresses, hostnames, and open ports discovered during the scan.
+type Host struct {
+	Status     *Status      `xml:"status"`
+	Addresses  []Address    `xml:"address"`
+	Hostnames  []Hostname   `xml:"hostnames>hostname"`
+	ExtraPorts []ExtraPorts `xml:"ports>extraports"`
+	Ports      []Port       `xml:"ports>port"`
+	OS         *OS          `xml:"os"`
+	Distance   *Distance    `xml:"distance"`
+	Times      *Times       `xml:"times"`
+	Trace      *Trace       `xml:"trace"`
+
+	// Scripts holds the results of the NSE host scripts (e.g. smb-security-mode).
+	Scripts []Script `xml:"hostscript>script"`
+
+	// StartTime and EndTime are the Unix times at which the scan of the host started and ended, 0
+	// when unknown.
+	StartTime int64 `xml:"starttime,attr,omitempty"`
+	EndTime   int64 `xml:"endtime,attr,omitempty"`
+
+	// ScanStart is the Unix time at which the scan the host comes from started (the start attribute
+	// of <nmaprun>), 0 when unknown. It is set by the XML parser and not written back.
+	ScanStart int64 `xml:"-"`
+
+	// The fields below are filled by the enrichments of the nmap2csv command; the parsers leave
+	// them empty.
+
+	// Geo is the location found by -geoip, nil when unknown. It is not part of the scan.
+	Geo *GeoLocation `xml:"-"`
+
+	// ASN is the autonomous system found by -asn, nil when unknown. It is not part of the scan.
+	ASN *ASNInfo `xml:"-"`
+
+	// Exposure is what -exposure found about the host on the internet, nil when unknown. It is not
+	// part of the scan.
+	Exposure *ExposureInfo `xml:"-"`
+
+	// Owner is the network registration found by -rdap, nil when unknown. It is not part of the
+	// scan.
+	Owner *OwnerInfo `xml:"-"`
+
+	// DeviceType is the kind of device (printer, camera, switch...) guessed by the device rules,
+	// empty when no rule matched. It is not part of the scan.
+	DeviceType string `xml:"-"`
+
+	// Risk is the score computed by -risk, nil without it. It is not part of the scan.
+	Risk *RiskScore `xml:"-"`
+}
+
+// ************************************************************************************************
+// GeoLocation is the location of a public host address, found by -geoip.
+type GeoLocation struct {
+	// Country and CountryCode are the English country name and its ISO 3166-1 code.
+	Country     string
+	CountryCode string
+
+	// City is the English city name, empty with Country databases.
+	City string
+
+	// Coordinates is the approximate "latitude,longitude" of the address.
+	Coordinates string
+}
+
+// ************************************************************************************************
+// PrimaryAddr returns the address used to identify the host in log messages.
+// The first IP address is preferred, falling back to any address (e.g. MAC) when none exists.
+func (h *Host) PrimaryAddr() string {
+	for _, a := range h.Addresses {
+		if a.AddrType == "ipv4" || a.AddrType == "ipv6" {
+			return a.Addr
+		}
+	}
+	if len(h.Addresses) > 0 {
+		return h.Addresses[0].Addr
+	}
+	return ""
+}
+
+// ************************************************************************************************
+// IP returns the IPv4 address of the host, or its IPv6 address when it has none.
+func (h *Host) IP() string {
+	ip := ""
+	for _, addr := range h.Addresses {
+		if addr.AddrType == "ipv4" {
+			return addr.Addr
+		}
+		if addr.AddrType == "ipv6" && ip == "" {
+			ip = addr.Addr
+		}
+	}
+	return ip
+}
+
+// ************************************************************************************************
+// IsUp reports whether the host was found up. Hosts without status (formats that only list
+// responding hosts) are considered up.
+func (h *Host) IsUp() bool {
+	return h.Status == nil || h.Status.State != "down"
+}
+
+// ************************************************************************************************
+// PortCounts returns the number of ports of the host in every state, the listed ports and those
+// Nmap only counted (ExtraPorts) together, e.g. {"open": 3, "filtered": 997}.
+func (h *Host) PortCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, e := range h.ExtraPorts {
+		counts[e.State] += e.Count
+	}
+	for i := range h.Ports {
+		counts[h.Ports[i].State.State]++
+	}
+	return counts
+}
+
+// ************************************************************************************************
+// ExtraPorts represents the ports of one state that Nmap counted without listing them, such as the
+// 997 filtered ports of a host with three open ones.
+type ExtraPorts struct {
+	// State is the port state shared by the ports (e.g. "filtered", "closed").
+	State string `xml:"state,attr"`
+
+	// Count is the number of ports.
+	Count int `xml:"count,attr"`
+}
+
+// ************************************************************************************************
+// Status represents the host discovery result of a host.
+type Status struct {
+	// State is "up", "down" or "unknown".
+	State string `xml:"state,attr"`
+
+	// Reason is the response that determined the state: "arp-response", "echo-reply", "syn-ack",
+	// "no-response", "user-set" (-Pn)...
+	Reason string `xml:"reason,attr,omitempty"`
+
+	// ReasonTTL is the IP time-to-live of the response that proved the host up, 0 when unknown.
+	ReasonTTL int `xml:"reason_ttl,attr,omitempty"`
+}
+
+// ************************************************************************************************
+// BestOSMatch returns the OS detection match with the highest accuracy, or nil when OS detection
+// did not run or found nothing.
+func (h *Host) BestOSMatch() *OSMatch {
+	if h.OS == nil {
+		return nil
+	}
+	var best *OSMatch
+	for i := range h.OS.Matches {
+		if best == nil || h.OS.Matches[i].Accuracy > best.Accuracy {
+			best = &h.OS.Matches[i]
+		}
+	}
+	return best
+}
+
+// ************************************************************************************************
+// OS holds the results of Nmap OS detection (-O) for a host.
+type OS struct {
+	// Matches lists the candidate operating systems, most likely first.
+	Matches []OSMatch `xml:"osmatch"`
+}
+
+// ************************************************************************************************
+// OSMatch is one candidate operating system of OS detection.
+type OSMatch struct {
+	// Name is the operating system name (e.g. "Linux 5.0 - 5.14").
+	Name string `xml:"name,attr"`
+
+	// Accuracy is the confidence of the match, in percent.
+	Accuracy int `xml:"accuracy,attr"`
+
+	// Classes lists the OS classifications of the match.
+	Classes []OSClass `xml:"osclass"`
+}
+
+// ************************************************************************************************
+// CPEs returns the platform identifiers of the classes of the match, without duplicates, in order.
+func (m *OSMatch) CPEs() []string {
+	var cpes []string
+	for _, c := range m.Classes {
+		for _, cpe := range c.CPEs {
+			if !slices.Contains(cpes, cpe) {
+				cpes = append(cpes, cpe)
+			}
+		}
+	}
+	return cpes
+}
+
+// ************************************************************************************************
+// OSClass is an OS classification of an OS detection match (e.g. vendor "Microsoft", family
+// "Windows", generation "10", device type "general purpose").
+type OSClass struct {
+	Type     string `xml:"type,attr,omitempty"`
+	Vendor   string `xml:"vendor,attr,omitempty"`
+	Family   string `xml:"osfamily,attr,omitempty"`
+	Gen      string `xml:"osgen,attr,omitempty"`
+	Accuracy int    `xml:"accuracy,attr,omitempty"`
+
+	// CPEs lists the platform identifiers of the class (cpe:/o:microsoft:windows_10).
+	CPEs []string `xml:"cpe"`
+}
+
+// ************************************************************************************************
+// Distance holds the network distance of a host found by OS detection or traceroute.
+type Distance struct {
+	// Value is the number of hops to the host, 1 on the local segment.
+	Value int `xml:"value,attr"`
+}
+
+// ************************************************************************************************
+// Hops returns the network distance of the host in hops: the <distance> Nmap computed, or else the
+// TTL of the last traceroute hop. It returns 0 when unknown.
+func (h *Host) Hops() int {
+	if h.Distance != nil {
+		return h.Distance.Value
+	}
+	if h.Trace != nil && len(h.Trace.Hops) > 0 {
+		return h.Trace.Hops[len(h.Trace.Hops)-1].TTL
+	}
+	return 0
+}
+
+// ************************************************************************************************
+// Times holds the round-trip time estimates Nmap computed for a host, in microseconds.
+type Times struct {
+	// SRTT is the smoothed round-trip time and RTTVar its variance.
+	SRTT   int `xml:"srtt,attr"`
+	RTTVar int `xml:"rttvar,attr"`
+
+	// Timeout is the probe timeout derived from them.
+	Timeout int `xml:"to,attr"`
+}
+
+// ************************************************************************************************
+// Trace holds the route to a host discovered by --traceroute.
+type Trace struct {
+	// Hops lists the routers on the path, by increasing TTL; the last hop is the host itself.
+	Hops []Hop `xml:"hop"`
+}
+
+// ************************************************************************************************
+// Hop is one step of a traceroute.
+type Hop struct {
+	// TTL is the time-to-live at which the hop answered.
+	TTL int `xml:"ttl,attr"`
+
+	// IPAddr is the address of the hop, and Host its reverse DNS name when resolved.
+	IPAddr string `xml:"ipaddr,attr"`
+	Host   string `xml:"host,attr,omitempty"`
+
+	// RTT is the round-trip time to the hop, in milliseconds.
+	RTT string `xml:"rtt,attr,omitempty"`
+}
+
+// ************************************************************************************************
+// Address represents a network address associated with a host.
+// This can be an IPv4, IPv6, or MAC address with optional vendor information.
+type Address struct {
+	// Addr is the actual address value (IP or MAC).
+	Addr string `xml:"addr,attr"`
+
+	// AddrType indicates the type of address (ipv4, ipv6, mac).
+	AddrType string `xml:"addrtype,attr"`
+
+	// Vendor is the manufacturer name for MAC addresses (empty for IP addresses).
+	Vendor string `xml:"vendor,attr,omitempty"`
+}
+
+// ************************************************************************************************
+// Hostname represents a DNS hostname associated with a host.
+type Hostname struct {
+	// Name is the resolved hostname.
+	Name string `xml:"name,attr"`
+}
+
+// ************************************************************************************************
+// Port represents a single port on a scanned host.
+// It includes the port number, protocol, state, and service information.
+type Port struct {
+	// Protocol is the transport protocol (tcp, udp, sctp).
+	Protocol string `xml:"protocol,attr"`
+
+	// PortID is the port number (0-65535).
+	PortID int `xml:"portid,attr"`
+
+	// State contains the current state of the port (open, closed, filtered).
+	State State `xml:"state"`
+
+	// Service contains information about the service running on this port.
+	Service Service `xml:"service"`
+
+	// Scripts holds the results of the NSE port scripts (e.g. http-title, ssl-cert).
+	Scripts []Script `xml:"script"`
+}
+
+// ************************************************************************************************
+// TLS reports whether the service of the port is wrapped in SSL/TLS: version detection found a
+// tunnel, the service name is a TLS one (https, imaps, ssl/...) or an ssl-cert script read its
+// certificate.
+func (p *Port) TLS() bool {
+	if p.Service.Tunnel == "ssl" || tlsServices[strings.ToLower(p.Service.Name)] {
+		return true
+	}
+	for _, s := range p.Scripts {
+		if s.ID == "ssl-cert" {
+			return true
+		}
+	}
+	return false
+}
+
+// ScriptOutput returns the output of the named NSE script run against the port, or "" when it did
+// not run.
+func (p *Port) ScriptOutput(id string) string {
+	for _, s := range p.Scripts {
+		if s.ID == id {
+			return s.Output
+		}
+	}
+	return ""
+}
+
+// HTTPTitle returns the page title found by the http-title NSE script, or "" when it did not run or
+// the page has none. Script results without structured output (older Nmap versions) give their first
+// output line instead.
+func (p *Port) HTTPTitle() string {
+	for _, s := range p.Scripts {
+		if s.ID != "http-title" {
+			continue
+		}
+		if len(s.Elems) == 0 {
+			line, _, _ := strings.Cut(strings.TrimSpace(s.Output), "\n")
+			return line
+		}
+		for _, e := range s.Elems {
+			if e.Key == "title" {
+				return strings.TrimSpace(e.Value)
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// IsWeb reports whether the port serves HTTP: its service name is an HTTP one ("http", "https",
+// "http-proxy", "http-alt"...) or the http-title script ran against it.
+func (p *Port) IsWeb() bool {
+	if strings.Contains(strings.ToLower(p.Service.Name), "http") {
+		return true
+	}
+	for _, s := range p.Scripts {
+		if s.ID == "http-title" {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsServices lists the Nmap service names of protocols always spoken over SSL/TLS.
+var tlsServices = map[string]bool{
+	"ssl": true, "https": true, "https-alt": true, "imaps": true, "pop3s": true, "smtps": true,
+	"submissions": true, "ldaps": true, "ftps": true, "ftps-data": true, "ircs-u": true,
+	"nntps": true, "telnets": true, "sips": true, "xmpps": true,
+}
+
+// ************************************************************************************************
+// Script is the result of one NSE script run against a host or a port.
+type Script struct {
+	// ID is the script name (e.g. "http-title").
+	ID string `xml:"id,attr"`
+
+	// Output is the human-readable output of the script.
+	Output string `xml:"output,attr"`
+
+	// Elems lists the top-level key/value pairs of the structured output of the script.
+	Elems []ScriptElem `xml:"elem"`
+}
+
+// ************************************************************************************************
+// ScriptElem is one key/value pair of the structured output of an NSE script (e.g. key "title").
+type ScriptElem struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// ************************************************************************************************
+// State represents the current state of a port.
+type State struct {
+	// State indicates whether the port is open, closed, or filtered.
+	State string `xml:"state,attr"`
+
+	// Reason is the kind of response, or lack thereof, that determined the state: "syn-ack",
+	// "reset", "no-response", "port-unreach"...
+	Reason string `xml:"reason,attr,omitempty"`
+
+	// ReasonTTL is the IP time-to-live of the response that determined the state, 0 when unknown.
+	ReasonTTL int `xml:"reason_ttl,attr,omitempty"`
+}
+
+// ************************************************************************************************
+// Service represents a network service detected on a port.
+type Service struct {
+	// Name is the service name (http, ssh, ftp, etc.).
+	Name string `xml:"name,attr"`
+
+	// Product, Version and ExtraInfo describe the software identified by version detection (-sV),
+	// e.g. "OpenSSH", "8.9p1" and "Ubuntu Linux; protocol 2.0". Text formats only carry one version
+	// string, stored in Product.
+	Product   string `xml:"product,attr,omitempty"`
+	Version   string `xml:"version,attr,omitempty"`
+	ExtraInfo string `xml:"extrainfo,attr,omitempty"`
+
+	// OSType is the operating system reported by the service banner (e.g. "Linux", "Windows").
+	OSType string `xml:"ostype,attr,omitempty"`
+
+	// Tunnel is "ssl" when the service is wrapped in SSL/TLS (e.g. HTTP served over TLS as https).
+	Tunnel string `xml:"tunnel,attr,omitempty"`
+
+	// Method is how the service was identified: "probed" when version detection recognised it,
+	// "table" when it is only the usual service of the port number.
+	Method string `xml:"method,attr,omitempty"`
+
+	// Conf is the confidence of the identification, from 0 to 10: 10 for probed services, 3 for
+	// table guesses, 0 when unknown.
+	Conf int `xml:"conf,attr,omitempty"`
+
+	// Fingerprint is the service fingerprint Nmap prints for the services version detection could
+	// not recognise, holding the responses to its probes.
+	Fingerprint string `xml:"servicefp,attr,omitempty"`
+
+	// CPEs lists the platform identifiers found by version detection
+	// (cpe:/a:openbsd:openssh:8.9p1).
+	CPEs []string `xml:"cpe"`
+}
+
+// ************************************************************************************************
+// ASNInfo is the autonomous system announcing a public host address, found by -asn.
+type ASNInfo struct {
+	// Number and Name identify the AS (15169, "GOOGLE").
+	Number int
+	Name   string
+
+	// Prefix is the announced network containing the address, e.g. "8.8.8.0/24".
+	Prefix string
+}
+
+// ************************************************************************************************
+// ExposureInfo is what an internet-wide scanning service (Shodan, Censys) knows about a public host
+// address, found by -exposure.
+type ExposureInfo struct {
+	// Ports lists the ports the service found open, in increasing order.
+	Ports []int `json:"ports"`
+
+	// Tags are the labels of the service (e.g. "cloud", "vpn", "self-signed").
+	Tags []string `json:"tags"`
+
+	// LastSeen is the date (YYYY-MM-DD) of the last observation of the address.
+	LastSeen string `json:"last_seen"`
+}
+
+// ************************************************************************************************
+// OwnerInfo is the registration of the network containing a public host address, found by -rdap.
+type OwnerInfo struct {
+	// Org is the registered owner of the network (e.g. "Google LLC").
+	Org string
+
+	// NetName is the name (or handle) of the network, e.g. "GOGL".
+	NetName string
+
+	// Range is the registered address range, e.g. "8.8.8.0 - 8.8.8.255".
+	Range string
+}
+
+// ************************************************************************************************
+// RiskScore is the -risk score of a host and the names of the rules that contributed to it.
+type RiskScore struct {
+	Score   int
+	Factors []string
+}
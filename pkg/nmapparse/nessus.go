@@ -0,0 +1,70 @@
+package nmapparse
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ************************************************************************************************
+// nessusReportHost is a <ReportHost> element of a Nessus v2 export (.nessus).
+// Host details live in <HostProperties> tags, and every plugin finding is a <ReportItem> bound to
+// a port; port 0 items are host-level findings.
+type nessusReportHost struct {
+	Name       string `xml:"name,attr"`
+	Properties []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"HostProperties>tag"`
+	Items []struct {
+		Port     int    `xml:"port,attr"`
+		Protocol string `xml:"protocol,attr"`
+		Service  string `xml:"svc_name,attr"`
+	} `xml:"ReportItem"`
+}
+
+// ************************************************************************************************
+// toHost maps a Nessus report host to the Host model.
+// Every distinct port/protocol referenced by a finding becomes an open port; Nessus marks
+// uncertain service names with a trailing "?", which is dropped.
+func (n *nessusReportHost) toHost() *Host {
+	props := make(map[string]string)
+	for _, p := range n.Properties {
+		props[p.Name] = strings.TrimSpace(p.Value)
+	}
+
+	h := &Host{}
+	ip := props["host-ip"]
+	if ip == "" {
+		ip = n.Name
+	}
+	h.Addresses = append(h.Addresses, Address{Addr: ip, AddrType: addrTypeOf(ip)})
+	if mac := props["mac-address"]; mac != "" {
+		// Multi-homed hosts list one MAC per line; the first one is kept.
+		mac, _, _ = strings.Cut(mac, "\n")
+		h.Addresses = append(h.Addresses, Address{Addr: strings.ToUpper(strings.TrimSpace(mac)), AddrType: "mac"})
+	}
+	if fqdn := props["host-fqdn"]; fqdn != "" {
+		h.Hostnames = append(h.Hostnames, Hostname{Name: fqdn})
+	} else if n.Name != ip {
+		h.Hostnames = append(h.Hostnames, Hostname{Name: n.Name})
+	}
+
+	seen := make(map[string]bool)
+	for _, item := range n.Items {
+		if item.Port == 0 {
+			continue
+		}
+		key := strings.ToLower(item.Protocol) + "/" + strconv.Itoa(item.Port)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		h.Ports = append(h.Ports, Port{
+			Protocol: strings.ToLower(item.Protocol),
+			PortID:   item.Port,
+			State:    State{State: "open"},
+			Service:  Service{Name: strings.TrimSuffix(item.Service, "?")},
+		})
+	}
+	return h
+}
@@ -0,0 +1,125 @@
+package nmapparse
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ************************************************************************************************
+// streamNormal parses Nmap normal output (-oN) from r and passes each host to fn.
+// This is a best-effort parser for human-readable reports: it extracts the address and hostname
+// from "Nmap scan report for" lines, the port table rows ("22/tcp open ssh ...") and the
+// "MAC Address:" line when present. Everything else is ignored.
+func streamNormal(r io.Reader, fn HostHandler) (int, error) {
+	sc := newLineScanner(r)
+
+	count := 0
+	var cur *Host
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		count++
+		h := cur
+		cur = nil
+		return fn(h)
+	}
+
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if target, ok := strings.CutPrefix(line, "Nmap scan report for "); ok {
+			if err := flush(); err != nil {
+				return count, err
+			}
+			cur = newNormalHost(target)
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if mac, ok := strings.CutPrefix(line, "MAC Address: "); ok {
+			addr, vendor, _ := strings.Cut(mac, " ")
+			vendor = strings.TrimSuffix(strings.TrimPrefix(vendor, "("), ")")
+			if vendor == "Unknown" {
+				vendor = ""
+			}
+			cur.Addresses = append(cur.Addresses, Address{Addr: addr, AddrType: "mac", Vendor: vendor})
+			continue
+		}
+		if notShown, ok := strings.CutPrefix(line, "Not shown: "); ok {
+			cur.ExtraPorts = append(cur.ExtraPorts, parseNotShown(notShown)...)
+			continue
+		}
+		if p, ok := parseNormalPort(line); ok {
+			cur.Ports = append(cur.Ports, p)
+		}
+	}
+	if err := lineError(sc); err != nil {
+		return count, err
+	}
+	return count, flush()
+}
+
+// ************************************************************************************************
+// newNormalHost creates a host from the target of a "Nmap scan report for" line, which is
+// either a bare address or "hostname (address)".
+func newNormalHost(target string) *Host {
+	target = strings.TrimSpace(target)
+	h := &Host{}
+	if name, rest, ok := strings.Cut(target, " ("); ok {
+		ip := strings.TrimSuffix(rest, ")")
+		h.Addresses = []Address{{Addr: ip, AddrType: addrTypeOf(ip)}}
+		h.Hostnames = []Hostname{{Name: name}}
+		return h
+	}
+	h.Addresses = []Address{{Addr: target, AddrType: addrTypeOf(target)}}
+	return h
+}
+
+// ************************************************************************************************
+// parseNormalPort converts a port table row such as "22/tcp  open  ssh  OpenSSH 8.9" into a Port.
+// It reports false for any other line.
+func parseNormalPort(line string) (Port, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return Port{}, false
+	}
+	num, proto, ok := strings.Cut(fields[0], "/")
+	if !ok {
+		return Port{}, false
+	}
+	id, err := strconv.Atoi(num)
+	if err != nil {
+		return Port{}, false
+	}
+	p := Port{Protocol: proto, PortID: id, State: State{State: fields[1]}}
+	if len(fields) > 2 {
+		p.Service.Name = fields[2]
+		// Normal output writes the services wrapped in SSL/TLS as ssl/http.
+		if name, ok := strings.CutPrefix(p.Service.Name, "ssl/"); ok {
+			p.Service.Name, p.Service.Tunnel = name, "ssl"
+		}
+	}
+	if len(fields) > 3 {
+		p.Service.Product = strings.Join(fields[3:], " ")
+	}
+	return p, true
+}
+
+// ************************************************************************************************
+// parseNotShown converts the counts of a "Not shown:" line, such as "995 closed tcp ports (reset),
+// 2 filtered tcp ports (no-response)" or "997 filtered ports", into ExtraPorts.
+func parseNotShown(s string) []ExtraPorts {
+	var extra []ExtraPorts
+	for _, part := range strings.Split(s, ", ") {
+		fields := strings.Fields(part)
+		if len(fields) < 2 {
+			continue
+		}
+		if n, err := strconv.Atoi(fields[0]); err == nil {
+			extra = append(extra, ExtraPorts{State: fields[1], Count: n})
+		}
+	}
+	return extra
+}
@@ -0,0 +1,342 @@
+package nmapparse
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// ************************************************************************************************
+// HostHandler is called for every <host> element decoded from a scan, in document order.
+// Returning an error stops the parsing and the error is returned to the caller.
+type HostHandler func(h *Host) error
+
+// ************************************************************************************************
+// MetaHandler is called with the scan-level information of every document that carries some (the
+// Nmap XML root element and run statistics), once the document has been read. It may be nil.
+type MetaHandler func(m *ScanMeta)
+
+// ************************************************************************************************
+// streamXML decodes an Nmap XML document from r and passes each <host> element to fn as soon as it
+// has been read. Only one host is held in memory at a time, so multi-gigabyte scans can be
+// processed with a roughly constant footprint. It returns the number of hosts decoded.
+//
+// Nessus v2 exports (.nessus) are XML too: their <ReportHost> elements are converted to hosts.
+// Masscan writes near-nmap XML (scanner="masscan") with one <host> element per open port; such
+// documents are detected from the root element and their hosts are coalesced by address.
+// The attributes of the root element and the <runstats> element are passed to meta.
+//
+// The input may come from untrusted parties: the decoder only knows the predefined XML entities and
+// documents declaring their own are rejected, every element is limited to MaxElementSize and the
+// elements walked through to find the hosts to maxXMLDepth levels.
+//
+// A document ending before its root element is closed, as interrupted scans leave them, still has
+// its complete hosts passed to fn (a host cut in the middle is dropped) and its scan information to
+// meta; the error returned then wraps ErrTruncated.
+func streamXML(r io.Reader, fn HostHandler, meta MetaHandler) (int, error) {
+	guard := newSizeGuard(r)
+	dec := xml.NewDecoder(guard)
+	count, depth := 0, 0
+	var merger *Coalescer
+	var info *ScanMeta
+	var truncated error
+	for truncated == nil {
+		guard.reset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if isTruncation(err) {
+			truncated = fmt.Errorf("parse XML: %w after %d hosts", ErrTruncated, count)
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("parse XML: %w", err)
+		}
+		if dir, ok := tok.(xml.Directive); ok && bytes.Contains(dir, []byte("ENTITY")) {
+			return count, fmt.Errorf("parse XML: %w", ErrEntityDeclaration)
+		}
+		if _, ok := tok.(xml.EndElement); ok {
+			depth--
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		// The elements decoded at once below are closed on return.
+		if depth++; depth > maxXMLDepth {
+			return count, fmt.Errorf("parse XML: elements nested deeper than %d levels", maxXMLDepth)
+		}
+		if start.Name.Local == "nmaprun" {
+			info = newScanMeta(start)
+			if info.Scanner == "masscan" {
+				merger = NewCoalescer(nil)
+			}
+			continue
+		}
+		var h Host
+		switch start.Name.Local {
+		case "runstats":
+			if info != nil {
+				err := dec.DecodeElement(&info.RunStats, &start)
+				if isTruncation(err) {
+					truncated = fmt.Errorf("parse XML runstats: %w", ErrTruncated)
+					continue
+				}
+				if err != nil {
+					return count, fmt.Errorf("parse XML runstats: %w", err)
+				}
+				depth--
+			}
+			continue
+		case "host":
+			err := dec.DecodeElement(&h, &start)
+			if isTruncation(err) {
+				truncated = fmt.Errorf("parse XML host #%d: %w", count+1, ErrTruncated)
+				continue
+			}
+			if err != nil {
+				return count, fmt.Errorf("parse XML host #%d: %w", count+1, err)
+			}
+		case "ReportHost":
+			var rh nessusReportHost
+			err := dec.DecodeElement(&rh, &start)
+			if isTruncation(err) {
+				truncated = fmt.Errorf("parse Nessus host #%d: %w", count+1, ErrTruncated)
+				continue
+			}
+			if err != nil {
+				return count, fmt.Errorf("parse Nessus host #%d: %w", count+1, err)
+			}
+			h = *rh.toHost()
+		default:
+			continue
+		}
+		depth--
+		count++
+		if info != nil {
+			h.ScanStart = info.Start
+		}
+		if merger != nil {
+			merger.Add(&h)
+			continue
+		}
+		if err := fn(&h); err != nil {
+			return count, err
+		}
+	}
+	if info != nil && meta != nil {
+		meta(info)
+	}
+	if merger != nil {
+		n, err := merger.Flush(fn)
+		if err == nil {
+			err = truncated
+		}
+		return n, err
+	}
+	return count, truncated
+}
+
+// ************************************************************************************************
+// isTruncation reports whether err is the decoder reaching the end of the input in the middle of
+// the document, rather than a malformed one.
+func isTruncation(err error) bool {
+	var syntax *xml.SyntaxError
+	if errors.As(err, &syntax) {
+		return syntax.Msg == "unexpected EOF"
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// maxXMLDepth is the deepest nesting of the elements around the hosts: a few levels in Nmap and
+// Nessus documents.
+const maxXMLDepth = 256
+
+// ************************************************************************************************
+// newScanMeta reads the scan information from the attributes of the <nmaprun> element.
+func newScanMeta(root xml.StartElement) *ScanMeta {
+	m := &ScanMeta{Scanner: xmlAttr(root, "scanner"), Version: xmlAttr(root, "version"), Args: xmlAttr(root, "args")}
+	m.Start, _ = strconv.ParseInt(xmlAttr(root, "start"), 10, 64)
+	return m
+}
+
+// ************************************************************************************************
+// xmlAttr returns the value of the named attribute of an XML start element, or "" when absent.
+func xmlAttr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// ************************************************************************************************
+// Stream reads a scan from r and passes each host to fn as soon as it has been read, returning the
+// number of hosts. The format is detected from the first bytes: Nmap XML (the default), grepable
+// (-oG) and normal (-oN) output, Nessus v2 and masscan XML, masscan and naabu JSON, and RustScan
+// greppable output. Compressed inputs are decompressed on the fly: gzip streams (scan.xml.gz) are
+// read transparently and every file entry of a zip archive is parsed in turn. Scan-level
+// information is passed to meta, which may be nil.
+func Stream(r io.Reader, fn HostHandler, meta MetaHandler) (int, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, fmt.Errorf("gzip: %w", err)
+		}
+		defer zr.Close()
+		return streamAny(bufio.NewReader(zr), fn, meta)
+	case bytes.HasPrefix(magic, zipMagic):
+		return streamZip(r, br, fn, meta)
+	}
+	return streamAny(br, fn, meta)
+}
+
+// ************************************************************************************************
+// Parse reads a whole scan from r, in any of the formats of Stream, and returns its hosts. Stream
+// should be preferred for large scans, as it only holds one host in memory at a time. The complete
+// hosts of a truncated document are returned along with an error wrapping ErrTruncated.
+func Parse(r io.Reader) (*NmapRun, error) {
+	run := &NmapRun{}
+	_, err := Stream(r, func(h *Host) error {
+		run.Hosts = append(run.Hosts, *h)
+		return nil
+	}, func(m *ScanMeta) {
+		if run.Meta == nil {
+			run.Meta = m
+		}
+	})
+	if errors.Is(err, ErrTruncated) {
+		return run, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// ************************************************************************************************
+// streamAny detects the format of an uncompressed scan from its first bytes and dispatches it
+// to the matching parser. Nmap XML is the default when nothing more specific is recognised.
+func streamAny(br *bufio.Reader, fn HostHandler, meta MetaHandler) (int, error) {
+	head, _ := br.Peek(4096)
+	switch detectFormat(head) {
+	case formatGnmap:
+		return streamGnmap(br, fn)
+	case formatNormal:
+		return streamNormal(br, fn)
+	case formatPortJSON:
+		return streamPortJSON(br, fn)
+	case formatRustScan:
+		return streamRustScan(br, fn)
+	}
+	return streamXML(br, fn, meta)
+}
+
+// inputFormat identifies one of the supported scan output formats.
+type inputFormat int
+
+const (
+	formatXML inputFormat = iota
+	formatGnmap
+	formatNormal
+	formatPortJSON
+	formatRustScan
+)
+
+// ************************************************************************************************
+// detectFormat guesses the scan format from the beginning of the document.
+// XML documents start with a tag, grepable output (-oG) is made of "Host:" lines and normal
+// output (-oN) contains "Nmap scan report for" headers, both optionally preceded by "# Nmap"
+// comments. JSON documents (an array or a stream of objects) come from masscan or naabu, and
+// "ip -> [ports]" lines are RustScan greppable output.
+func detectFormat(head []byte) inputFormat {
+	trimmed := bytes.TrimLeft(head, "\ufeff \t\r\n")
+	if bytes.HasPrefix(trimmed, []byte("<")) {
+		return formatXML
+	}
+	if bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		return formatPortJSON
+	}
+	for _, line := range bytes.Split(trimmed, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("Host: ")) {
+			return formatGnmap
+		}
+		if bytes.HasPrefix(line, []byte("Nmap scan report for ")) {
+			return formatNormal
+		}
+		if bytes.Contains(line, []byte(" -> [")) {
+			return formatRustScan
+		}
+	}
+	return formatXML
+}
+
+// gzipMagic and zipMagic are the leading bytes identifying compressed inputs.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// ************************************************************************************************
+// streamZip streams every regular file stored in a zip archive through fn.
+// Zip needs random access: regular files and in-memory readers are read in place, while other
+// inputs (stdin, network streams) are buffered in memory first, up to MaxArchiveSize. br is r with
+// its first bytes already buffered.
+func streamZip(r io.Reader, br *bufio.Reader, fn HostHandler, meta MetaHandler) (int, error) {
+	var ra io.ReaderAt
+	var size int64
+	if f, ok := r.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			ra, size = f, fi.Size()
+		}
+	} else if sr, ok := r.(interface {
+		io.ReaderAt
+		Size() int64
+	}); ok {
+		ra, size = sr, sr.Size()
+	}
+	if ra == nil {
+		data, err := io.ReadAll(io.LimitReader(br, MaxArchiveSize+1))
+		if err != nil {
+			return 0, err
+		}
+		if int64(len(data)) > MaxArchiveSize {
+			return 0, fmt.Errorf("zip: %w of %d bytes", ErrArchiveTooLarge, MaxArchiveSize)
+		}
+		ra, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return 0, fmt.Errorf("zip: %w", err)
+	}
+	total := 0
+	for _, entry := range zr.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return total, fmt.Errorf("zip entry %s: %w", entry.Name, err)
+		}
+		count, err := streamAny(bufio.NewReader(rc), fn, meta)
+		rc.Close()
+		total += count
+		if err != nil {
+			return total, fmt.Errorf("zip entry %s: %w", entry.Name, err)
+		}
+	}
+	return total, nil
+}
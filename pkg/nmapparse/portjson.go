@@ -0,0 +1,258 @@
+package nmapparse
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ************************************************************************************************
+// portRecord is one entry of the JSON output of fast port scanners: an address with the ports
+// found open on it. Two layouts are understood:
+//   - masscan (-oJ / -oD): {"ip": ..., "ports": [{"port": 80, "proto": "tcp", "status": "open"}]}
+//   - naabu (-json):       {"host": ..., "ip": ..., "port": 80, "protocol": "tcp"}
+//
+// Both tools usually emit one record per open port.
+type portRecord struct {
+	IP    string `json:"ip"`
+	Ports []struct {
+		Port    int    `json:"port"`
+		Proto   string `json:"proto"`
+		Status  string `json:"status"`
+		TTL     int    `json:"ttl"`
+		Service struct {
+			Name string `json:"name"`
+		} `json:"service"`
+	} `json:"ports"`
+
+	// Host, Port and Protocol are the naabu fields. Old naabu releases wrote the port as an
+	// object ({"Port": 80, ...}), hence the raw message.
+	Host     string          `json:"host"`
+	Port     json.RawMessage `json:"port"`
+	Protocol string          `json:"protocol"`
+}
+
+// ************************************************************************************************
+// toHost converts the record to a Host holding its open ports. It returns nil when the record
+// carries no address (e.g. masscan's trailing {"finished": 1} object).
+func (rec *portRecord) toHost() *Host {
+	ip := rec.IP
+	if ip == "" {
+		ip = rec.Host
+	}
+	if ip == "" {
+		return nil
+	}
+	h := &Host{Addresses: []Address{{Addr: ip, AddrType: addrTypeOf(ip)}}}
+	if rec.Host != "" && rec.Host != ip {
+		h.Hostnames = []Hostname{{Name: rec.Host}}
+	}
+	for _, p := range rec.Ports {
+		h.Ports = append(h.Ports, Port{
+			Protocol: p.Proto,
+			PortID:   p.Port,
+			State:    State{State: p.Status, ReasonTTL: p.TTL},
+			Service:  Service{Name: p.Service.Name},
+		})
+	}
+	if len(rec.Port) > 0 {
+		var id int
+		if err := json.Unmarshal(rec.Port, &id); err != nil {
+			var legacy struct {
+				Port int `json:"Port"`
+			}
+			if json.Unmarshal(rec.Port, &legacy) == nil {
+				id = legacy.Port
+			}
+		}
+		proto := strings.ToLower(rec.Protocol)
+		if proto == "" {
+			proto = "tcp"
+		}
+		if id > 0 {
+			h.Ports = append(h.Ports, Port{Protocol: proto, PortID: id, State: State{State: "open"}})
+		}
+	}
+	return h
+}
+
+// ************************************************************************************************
+// streamPortJSON parses masscan or naabu JSON output from br and passes each host to fn.
+// Both a JSON array (masscan -oJ) and a one-object-per-line stream (masscan -oD, naabu -json)
+// are accepted. Records are coalesced by IP address so that every host is reported once with all
+// of its ports, which requires keeping the coalesced hosts in memory until the end of the input.
+// Every record is limited to MaxElementSize.
+func streamPortJSON(br *bufio.Reader, fn HostHandler) (int, error) {
+	guard := newSizeGuard(br)
+	dec := json.NewDecoder(guard)
+	merger := NewCoalescer(nil)
+
+	add := func(rec *portRecord) {
+		if h := rec.toHost(); h != nil {
+			merger.Add(h)
+		}
+	}
+
+	if isJSONArray(br) {
+		if _, err := dec.Token(); err != nil {
+			return 0, fmt.Errorf("parse JSON: %w", err)
+		}
+		for dec.More() {
+			guard.reset()
+			var rec portRecord
+			if err := dec.Decode(&rec); err != nil {
+				return 0, fmt.Errorf("parse JSON: %w", err)
+			}
+			add(&rec)
+		}
+		return merger.Flush(fn)
+	}
+
+	for {
+		guard.reset()
+		var rec portRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("parse JSON: %w", err)
+		}
+		add(&rec)
+	}
+	return merger.Flush(fn)
+}
+
+// ************************************************************************************************
+// isJSONArray reports whether the next non-blank byte of br opens a JSON array, without
+// consuming it.
+func isJSONArray(br *bufio.Reader) bool {
+	for i := 1; ; i++ {
+		b, err := br.Peek(i)
+		if err != nil {
+			return false
+		}
+		switch b[i-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[':
+			return true
+		}
+		return false
+	}
+}
+
+// ************************************************************************************************
+// Coalescer merges hosts sharing the same key, by default their primary address, for scanners
+// such as masscan or naabu that report every open port as a separate host entry, and for hosts
+// found in several inputs. First-seen order is preserved.
+type Coalescer struct {
+	key   func(h *Host) string
+	order []string
+	hosts map[string]*Host
+}
+
+// NewCoalescer creates an empty coalescer merging hosts with the same key, by primary address when
+// key is nil. Hosts with an empty key are never merged.
+func NewCoalescer(key func(h *Host) string) *Coalescer {
+	if key == nil {
+		key = (*Host).PrimaryAddr
+	}
+	return &Coalescer{key: key, hosts: make(map[string]*Host)}
+}
+
+// Add merges h into the host already known under the same key, or records it as a new one.
+func (c *Coalescer) Add(h *Host) {
+	key := c.key(h)
+	if key == "" {
+		key = fmt.Sprintf("\x00%d", len(c.order))
+	}
+	prev, ok := c.hosts[key]
+	if !ok {
+		c.hosts[key] = h
+		c.order = append(c.order, key)
+		return
+	}
+	MergeHost(prev, h)
+}
+
+// ************************************************************************************************
+// MergeHost merges the information of h into prev. Ports are unique by number and protocol: an
+// open state wins over any other, so a host scanned separately for TCP and UDP, or found open in
+// one scan only, keeps all its open ports. Addresses, hostnames and the other details of h are
+// only added when prev lacks them.
+func MergeHost(prev, h *Host) {
+	if prev.Status != nil && h.IsUp() {
+		prev.Status = h.Status
+	}
+	for _, a := range h.Addresses {
+		known := false
+		for _, pa := range prev.Addresses {
+			known = known || (pa.AddrType == a.AddrType && (pa.Addr == a.Addr || pa.AddrType == "mac"))
+		}
+		if !known {
+			prev.Addresses = append(prev.Addresses, a)
+		}
+	}
+	if len(prev.Hostnames) == 0 {
+		prev.Hostnames = h.Hostnames
+	}
+	for _, p := range h.Ports {
+		found := false
+		for i := range prev.Ports {
+			if prev.Ports[i].PortID == p.PortID && prev.Ports[i].Protocol == p.Protocol {
+				found = true
+				if prev.Ports[i].State.State != "open" {
+					prev.Ports[i] = p
+				}
+				break
+			}
+		}
+		if !found {
+			prev.Ports = append(prev.Ports, p)
+		}
+	}
+	if prev.OS == nil {
+		prev.OS = h.OS
+	}
+	prev.Scripts = append(prev.Scripts, h.Scripts...)
+}
+
+// Flush passes every coalesced host to fn in first-seen order and returns how many were emitted.
+func (c *Coalescer) Flush(fn HostHandler) (int, error) {
+	for i, key := range c.order {
+		if err := fn(c.hosts[key]); err != nil {
+			return i + 1, err
+		}
+	}
+	return len(c.order), nil
+}
+
+// ************************************************************************************************
+// streamRustScan parses RustScan greppable output (-g), made of "10.0.0.1 -> [22,80,443]"
+// lines, and passes each host to fn. RustScan has no JSON output of its own; this is its only
+// machine-readable format. All listed ports are open TCP ports.
+func streamRustScan(r io.Reader, fn HostHandler) (int, error) {
+	sc := newLineScanner(r)
+	merger := NewCoalescer(nil)
+	for sc.Scan() {
+		ip, list, ok := strings.Cut(strings.TrimSpace(sc.Text()), " -> ")
+		if !ok {
+			continue
+		}
+		h := &Host{Addresses: []Address{{Addr: ip, AddrType: addrTypeOf(ip)}}}
+		for _, p := range strings.Split(strings.Trim(list, "[]"), ",") {
+			if id, err := strconv.Atoi(strings.TrimSpace(p)); err == nil {
+				h.Ports = append(h.Ports, Port{Protocol: "tcp", PortID: id, State: State{State: "open"}})
+			}
+		}
+		merger.Add(h)
+	}
+	if err := lineError(sc); err != nil {
+		return 0, err
+	}
+	return merger.Flush(fn)
+}
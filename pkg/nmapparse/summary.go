@@ -0,0 +1,271 @@
+package nmapparse
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ************************************************************************************************
+// HostInfo holds aggregated information about a single host for display in hostname mode.
+// This structure combines data from multiple sources (addresses, hostnames, ports) into
+// a single record that can be easily sorted and displayed in table or CSV format.
+type HostInfo struct {
+	// Hostname is the resolved DNS hostname for this host (first hostname if multiple exist).
+	Hostname string `json:"hostname"`
+
+	// IPv4 is the IPv4 address of the host.
+	IPv4 string `json:"ipv4"`
+
+	// MAC is the MAC address of the host's network interface.
+	MAC string `json:"mac"`
+
+	// Vendor is the NIC manufacturer name associated with the MAC address.
+	Vendor string `json:"vendor"`
+
+	// CountOpen is the total number of open ports detected on this host.
+	CountOpen int `json:"count_open"`
+
+	// Ports is the list of matching open ports that meet the filter criteria, comma-separated port
+	// numbers unless the PortList of Summarize changes its rendering.
+	Ports string `json:"-"`
+
+	// PortList holds the same matching open port numbers as Ports, for structured outputs.
+	PortList []int `json:"ports"`
+
+	// Columns holds the optional columns selected with -columns, by column name. Set by the
+	// nmap2csv command only.
+	Columns map[string]string `json:"columns,omitempty"`
+
+	// Risk is the -risk score of the host, the first sort key of the hostname mode. Structured
+	// outputs carry it in Columns. Set by the nmap2csv command only.
+	Risk int `json:"-"`
+}
+
+// ************************************************************************************************
+// PortInfo holds aggregated information about a port/protocol combination across all scanned hosts.
+// This structure is used in port analysis mode to show which ports are most commonly open
+// in the network, along with their associated service names.
+type PortInfo struct {
+	// Key is the port number and protocol combination in the format "portnum/protocol" (e.g., "80/tcp", "53/udp").
+	Key string `json:"port"`
+
+	// Service is the detected service name for this port (e.g., "http", "ssh", "dns").
+	Service string `json:"service"`
+
+	// Count is the number of hosts that have this port open in the scan results.
+	Count int `json:"count"`
+
+	// State is the port state counted, set when other states than open are selected.
+	State string `json:"state,omitempty"`
+}
+
+// ************************************************************************************************
+// VendorInfo holds aggregated information about a network interface card vendor.
+// This structure is used in vendor analysis mode to identify the distribution of
+// hardware manufacturers across the scanned network.
+type VendorInfo struct {
+	// Name is the vendor or manufacturer name (e.g., "Intel Corporate", "Cisco Systems").
+	Name string `json:"vendor"`
+
+	// Count is the number of devices from this vendor found in the scan results.
+	Count int `json:"count"`
+}
+
+// ************************************************************************************************
+// PortList controls how the open ports of a host are rendered in the Ports column.
+type PortList struct {
+	// Services renders every entry as "port/proto(service)" instead of the bare port number.
+	Services bool
+
+	// Sep separates the entries; empty means a comma.
+	Sep string
+
+	// States appends the port state to every entry (445:filtered), for selections other than
+	// open ports only.
+	States bool
+}
+
+// Entry renders one port of the list.
+func (f PortList) Entry(p *Port) string {
+	e := strconv.Itoa(p.PortID)
+	if f.Services {
+		e = fmt.Sprintf("%d/%s", p.PortID, p.Protocol)
+		if p.Service.Name != "" {
+			e += "(" + p.Service.Name + ")"
+		}
+	}
+	if f.States {
+		e += ":" + p.State.State
+	}
+	return e
+}
+
+// Separator returns the string placed between the entries.
+func (f PortList) Separator() string {
+	if f.Sep == "" {
+		return ","
+	}
+	return f.Sep
+}
+
+// ************************************************************************************************
+// Summarize returns the summary row of a host: its first hostname, IPv4 and MAC addresses, its
+// open port count and the list of its ports selected by f, rendered with list. Ports excluded by
+// f are neither listed nor counted. It returns false when the host has no selected port, along with
+// the row of the host without ports.
+func Summarize(h *Host, f *PortFilter, list PortList) (HostInfo, bool) {
+	var hostname, ipv4, mac, vendor string
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	for _, addr := range h.Addresses {
+		if addr.AddrType == "ipv4" {
+			ipv4 = addr.Addr
+		}
+		if addr.AddrType == "mac" {
+			mac = addr.Addr
+			vendor = addr.Vendor
+		}
+	}
+	countOpen := 0
+	match := false
+	openPort := []string{}
+	portList := []int{}
+	for _, p := range h.Ports {
+		if p.State.State == "open" && !f.Excluded(&p) {
+			countOpen++
+		}
+		if f.Selected(&p) {
+			match = true
+			openPort = append(openPort, list.Entry(&p))
+			portList = append(portList, p.PortID)
+		}
+	}
+	return HostInfo{
+		Hostname:  hostname,
+		IPv4:      ipv4,
+		MAC:       mac,
+		Vendor:    vendor,
+		CountOpen: countOpen,
+		Ports:     strings.Join(openPort, list.Separator()),
+		PortList:  portList,
+	}, match
+}
+
+// ************************************************************************************************
+// HostSummaries returns the summary rows of the hosts of run with a port selected by f (every open
+// port when f is nil), sorted by descending open port count.
+func HostSummaries(run *NmapRun, f *PortFilter) []HostInfo {
+	if f == nil {
+		f = NewPortFilter("", "", "", nil)
+	}
+	var hosts []HostInfo
+	for i := range run.Hosts {
+		if info, ok := Summarize(&run.Hosts[i], f, PortList{}); ok {
+			hosts = append(hosts, info)
+		}
+	}
+	sort.SliceStable(hosts, func(i, j int) bool {
+		return hosts[i].CountOpen > hosts[j].CountOpen
+	})
+	return hosts
+}
+
+// ************************************************************************************************
+// PortCounter counts the hosts having each port/protocol pair in one of the selected states, one
+// host at a time. With states other than open only, pairs are counted per state.
+type PortCounter struct {
+	states PortStates
+	ports  map[string]*PortInfo
+}
+
+// NewPortCounter creates an empty counter of the ports in one of states (open ports when nil).
+func NewPortCounter(states PortStates) *PortCounter {
+	return &PortCounter{states: states, ports: make(map[string]*PortInfo)}
+}
+
+// Add counts the ports of a host.
+func (c *PortCounter) Add(h *Host) {
+	for _, p := range h.Ports {
+		if c.states.Has(&p) {
+			key := fmt.Sprintf("%d/%s", p.PortID, p.Protocol)
+			id := key
+			if !c.states.OpenOnly() {
+				id += " " + p.State.State
+			}
+			if _, ok := c.ports[id]; !ok {
+				c.ports[id] = &PortInfo{Key: key, Service: p.Service.Name, Count: 0}
+				if !c.states.OpenOnly() {
+					c.ports[id].State = p.State.State
+				}
+			}
+			c.ports[id].Count++
+		}
+	}
+}
+
+// Ports returns the counted pairs, sorted by descending count.
+func (c *PortCounter) Ports() []PortInfo {
+	var ports []PortInfo
+	for _, v := range c.ports {
+		ports = append(ports, *v)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].Count > ports[j].Count
+	})
+	return ports
+}
+
+// PortStats returns how many hosts of run have each port/protocol pair open, sorted by descending
+// count.
+func PortStats(run *NmapRun) []PortInfo {
+	c := NewPortCounter(nil)
+	for i := range run.Hosts {
+		c.Add(&run.Hosts[i])
+	}
+	return c.Ports()
+}
+
+// ************************************************************************************************
+// VendorCounter counts the MAC addresses of every NIC vendor, one host at a time.
+type VendorCounter struct {
+	vendors map[string]int
+}
+
+// NewVendorCounter creates an empty vendor counter.
+func NewVendorCounter() *VendorCounter {
+	return &VendorCounter{vendors: make(map[string]int)}
+}
+
+// Add counts the MAC addresses of a host.
+func (c *VendorCounter) Add(h *Host) {
+	for _, addr := range h.Addresses {
+		if addr.AddrType == "mac" {
+			c.vendors[addr.Vendor]++
+		}
+	}
+}
+
+// Vendors returns the counted vendors, sorted by descending count.
+func (c *VendorCounter) Vendors() []VendorInfo {
+	var vendors []VendorInfo
+	for k, v := range c.vendors {
+		vendors = append(vendors, VendorInfo{Name: k, Count: v})
+	}
+	sort.Slice(vendors, func(i, j int) bool {
+		return vendors[i].Count > vendors[j].Count
+	})
+	return vendors
+}
+
+// VendorStats returns how many MAC addresses of run belong to every NIC vendor, sorted by
+// descending count.
+func VendorStats(run *NmapRun) []VendorInfo {
+	c := NewVendorCounter()
+	for i := range run.Hosts {
+		c.Add(&run.Hosts[i])
+	}
+	return c.Vendors()
+}
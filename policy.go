@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/1mm0rt41PC/nmap2csv/pkg/nmapparse"
+)
+
+// errPolicyViolation is returned by run when the policy mode found violations, so that main exits
+// with a failure status once every output is written.
+var errPolicyViolation = errors.New("policy violations found")
+
+// ************************************************************************************************
+// policyRule is a rule of a -policy file: the ports it denies, the networks it applies to (all of
+// them when empty), and the networks where the ports are allowed anyway.
+type policyRule struct {
+	Name     string
+	deny     PortSpec
+	networks []netip.Prefix
+	except   []netip.Prefix
+}
+
+// ************************************************************************************************
+// loadPolicy reads a -policy file, a YAML document listing named rules. deny takes ports, ranges
+// and service names as -whereport does (the -whereservice aliases such as smb or rdp included);
+// networks and except take CIDR networks, as a list or comma-separated:
+//
+//	rules:
+//	  - name: no telnet anywhere
+//	    deny: telnet, 23
+//	  - name: RDP only from the admin network
+//	    deny: 3389, rdp
+//	    except: 10.1.5.0/24
+func loadPolicy(path string) ([]policyRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// parsePolicy parses a YAML policy document.
+func parsePolicy(data []byte) ([]policyRule, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a mapping with a rules key")
+	}
+	list, ok := root["rules"].([]any)
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("expected a non-empty rules sequence")
+	}
+	var rules []policyRule
+	for i, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("rule %d: expected name, deny, networks and except keys", i+1)
+		}
+		name, _ := m["name"].(string)
+		deny := yamlList(m["deny"])
+		if name == "" || len(deny) == 0 {
+			return nil, fmt.Errorf("rule %d: name and deny are required", i+1)
+		}
+		r := policyRule{Name: name, deny: nmapparse.ParsePortSpec(strings.Join(deny, ","))}
+		for n := range r.deny.Names {
+			for _, alias := range nmapparse.ServiceAliases[n] {
+				r.deny.Names[alias] = true
+			}
+		}
+		if r.networks, err = parseNets("policy networks", strings.Join(yamlList(m["networks"]), ",")); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", name, err)
+		}
+		if r.except, err = parseNets("policy except", strings.Join(yamlList(m["except"]), ",")); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", name, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// yamlList returns the entries of a YAML sequence, or of a comma-separated scalar.
+func yamlList(v any) []string {
+	var entries []string
+	switch v := v.(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				entries = append(entries, s)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				entries = append(entries, s)
+			}
+		}
+	}
+	return entries
+}
+
+// applies reports whether the rule covers the address: in its networks (or any network when it
+// has none) and not in its exceptions.
+func (r *policyRule) applies(ip netip.Addr) bool {
+	if len(r.networks) > 0 && !containsAddr(r.networks, ip) {
+		return false
+	}
+	return !containsAddr(r.except, ip)
+}
+
+// ************************************************************************************************
+// policyAggregator implements the policy mode (-policy policy.yaml): every open port of the up
+// hosts is checked against the rules, and each port denied for the address of its host is reported
+// with the rule it violates.
+type policyAggregator struct {
+	rules      []policyRule
+	violations []PolicyViolation
+}
+
+// newPolicyAggregator creates a policy mode aggregator checking the given rules.
+func newPolicyAggregator(rules []policyRule) *policyAggregator {
+	return &policyAggregator{rules: rules}
+}
+
+// Add implements Aggregator.
+func (a *policyAggregator) Add(h *Host) {
+	if !h.IsUp() {
+		return
+	}
+	ip := h.IP()
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return
+	}
+	addr = addr.Unmap()
+	hostname := ""
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	for i := range h.Ports {
+		p := &h.Ports[i]
+		if p.State.State != "open" {
+			continue
+		}
+		for j := range a.rules {
+			r := &a.rules[j]
+			if r.deny.Match(p) && r.applies(addr) {
+				a.violations = append(a.violations, PolicyViolation{
+					Rule:     r.Name,
+					IP:       ip,
+					Hostname: hostname,
+					Port:     fmt.Sprintf("%d/%s", p.PortID, p.Protocol),
+					Service:  p.Service.Name,
+				})
+			}
+		}
+	}
+}
+
+// Report implements Aggregator. Violations are grouped by rule, in the order of the policy file,
+// then sorted by address and port.
+func (a *policyAggregator) Report() *Report {
+	order := make(map[string]int, len(a.rules))
+	for i, r := range a.rules {
+		if _, ok := order[r.Name]; !ok {
+			order[r.Name] = i
+		}
+	}
+	sort.SliceStable(a.violations, func(i, j int) bool {
+		vi, vj := a.violations[i], a.violations[j]
+		if vi.Rule != vj.Rule {
+			return order[vi.Rule] < order[vj.Rule]
+		}
+		if vi.IP != vj.IP {
+			return compareAddrs(vi.IP, vj.IP)
+		}
+		return comparePorts(vi.Port, vj.Port)
+	})
+	report := &Report{Headers: []string{"Rule", "IP", "Hostname", "Port/Proto", "Service"}, Records: a.violations}
+	for _, v := range a.violations {
+		report.Rows = append(report.Rows, []string{v.Rule, v.IP, v.Hostname, v.Port, v.Service})
+	}
+	return report
+}
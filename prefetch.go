@@ -0,0 +1,74 @@
+package main
+
+// prefetchDepth is the number of decoded hosts a worker keeps ahead of the delivery of its file.
+const prefetchDepth = 64
+
+// ************************************************************************************************
+// scanPrefetcher parses the input files with a pool of workers ahead of their delivery, so that the
+// many files of an engagement are decoded concurrently while their hosts are still delivered one
+// file after the other, in input order, as a sequential read would. Workers are started in input
+// order and each holds a slot until its file is fully decoded; as the file being delivered is
+// always the oldest one started, a worker blocked on its full buffer never starves it.
+type scanPrefetcher struct {
+	scans []*prefetchedScan
+}
+
+// prefetchedScan is the stream of decoded events of one input file.
+type prefetchedScan struct {
+	events chan scanEvent
+	count  int
+	err    error
+}
+
+// scanEvent is a host, or the scan-level information of a document, of a prefetched file.
+type scanEvent struct {
+	host *Host
+	meta *ScanMeta
+}
+
+// ************************************************************************************************
+// prefetchScans starts decoding files with the given number of workers.
+func (o *Options) prefetchScans(files []string, workers int) *scanPrefetcher {
+	p := &scanPrefetcher{scans: make([]*prefetchedScan, len(files))}
+	for i := range files {
+		p.scans[i] = &prefetchedScan{events: make(chan scanEvent, prefetchDepth)}
+	}
+	slots := make(chan struct{}, workers)
+	go func() {
+		for i, file := range files {
+			slots <- struct{}{}
+			go func(s *prefetchedScan) {
+				defer func() { <-slots }()
+				s.count, s.err = o.loadScan(file, func(h *Host) error {
+					s.events <- scanEvent{host: h}
+					return nil
+				}, func(m *ScanMeta) {
+					s.events <- scanEvent{meta: m}
+				})
+				close(s.events)
+			}(p.scans[i])
+		}
+	}()
+	return p
+}
+
+// load delivers the decoded events of the i-th file to fn and meta as loadScan would, waiting for
+// the worker decoding it. When fn fails, the remaining events are discarded and its error returned.
+func (p *scanPrefetcher) load(i int, fn HostHandler, meta MetaHandler) (int, error) {
+	s := p.scans[i]
+	var err error
+	for ev := range s.events {
+		switch {
+		case err != nil:
+		case ev.host != nil:
+			err = fn(ev.host)
+		case meta != nil:
+			meta(ev.meta)
+		}
+	}
+	// count and err are set before the events are closed.
+	if err != nil {
+		return s.count, err
+	}
+	return s.count, s.err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// ************************************************************************************************
+// startProfiles starts the -cpuprofile CPU profile and returns the function to call before exiting,
+// which stops it and writes the -memprofile heap profile. Both are in the pprof format, read with
+// go tool pprof.
+func (o *Options) startProfiles() (stop func(), err error) {
+	var cpu *os.File
+	if o.CPUProfile != "" {
+		if cpu, err = os.Create(o.CPUProfile); err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, fmt.Errorf("-cpuprofile: %w", err)
+		}
+	}
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				slog.Error("Cannot write the CPU profile", "file", o.CPUProfile, "err", err)
+			}
+		}
+		if o.MemProfile != "" {
+			if err := writeHeapProfile(o.MemProfile); err != nil {
+				slog.Error("Cannot write the memory profile", "file", o.MemProfile, "err", err)
+			}
+		}
+	}, nil
+}
+
+// writeHeapProfile writes the allocations of the program to path, after a garbage collection so
+// that the live heap is up to date.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ************************************************************************************************
+// runTiming measures the phases of a run for -timing. Parsing and aggregation are interleaved while
+// the inputs are streamed: the time spent delivering the hosts to the enrichers, filters and modes
+// is aggregation, the rest of the streaming is parsing (waiting for the workers with -workers).
+// Writing the outputs follows.
+type runTiming struct {
+	start     time.Time
+	streamed  time.Duration
+	aggregate time.Duration
+	hosts     int
+}
+
+// newRunTiming starts measuring a run.
+func newRunTiming() *runTiming {
+	return &runTiming{start: time.Now()}
+}
+
+// streaming records the end of the streaming of the inputs started at start.
+func (t *runTiming) streaming(start time.Time) {
+	t.streamed += time.Since(start)
+}
+
+// delivered records the delivery of a host started at start.
+func (t *runTiming) delivered(start time.Time) {
+	t.aggregate += time.Since(start)
+	t.hosts++
+}
+
+// write prints the duration of every phase and the peak memory use of the process to w.
+func (t *runTiming) write(w io.Writer) {
+	total := time.Since(t.start)
+	fmt.Fprintf(w, "Timing: %d hosts, parse %v, aggregation %v, output %v, total %v, peak memory %s\n",
+		t.hosts, roundDuration(t.streamed-t.aggregate), roundDuration(t.aggregate), roundDuration(total-t.streamed), roundDuration(total), formatBytes(peakMemory()))
+}
+
+// roundDuration rounds d to the millisecond, or to the microsecond below one.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+// formatBytes formats a size in bytes with a binary unit, e.g. "85.3 MiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
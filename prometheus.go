@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ************************************************************************************************
+// promExporter implements -prometheus: the latest scan file among the inputs is exposed as
+// Prometheus gauges on /metrics. The inputs are checked at every scrape and the file is parsed
+// again when a newer one appears or it changes; when it cannot be read, the previous metrics are
+// kept.
+type promExporter struct {
+	o        *Options
+	patterns []string
+
+	mu      sync.Mutex
+	file    string
+	stamp   fileStamp
+	metrics []byte
+}
+
+// ************************************************************************************************
+// servePrometheus serves the metrics of the inputs matching patterns on the -prometheus address
+// until the server fails.
+func (o *Options) servePrometheus(patterns []string) error {
+	e := &promExporter{o: o, patterns: patterns}
+	if err := e.refresh(); err != nil {
+		slog.Warn("No metrics until a scan can be read", "err", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", e.serveMetrics)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, `<html><body><a href="/metrics">Metrics</a></body></html>`)
+	})
+	srv := &http.Server{Addr: o.Prometheus, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	slog.Info("Serving Prometheus metrics", "addr", o.Prometheus, "file", e.file)
+	return srv.ListenAndServe()
+}
+
+// serveMetrics answers a scrape with the metrics of the latest scan.
+func (e *promExporter) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if err := e.refresh(); err != nil {
+		slog.Warn("Keeping the previous metrics", "err", err)
+	}
+	e.mu.Lock()
+	metrics := e.metrics
+	e.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(metrics)
+}
+
+// refresh parses the latest input file again when it is not the one already parsed.
+func (e *promExporter) refresh() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	files, err := expandInputs(e.patterns)
+	if err != nil {
+		return err
+	}
+	latest, stamp := "", fileStamp{}
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if latest == "" || info.ModTime().After(stamp.modTime) {
+			latest, stamp = f, fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	if latest == "" {
+		return errors.New("no scan file found")
+	}
+	if latest == e.file && stamp == e.stamp && e.metrics != nil {
+		return nil
+	}
+	c := newPromCollector(e.o.portFilter())
+	if failed, _ := e.o.streamInputs([]string{latest}, true, c); failed > 0 {
+		return fmt.Errorf("cannot read %s", latest)
+	}
+	var b strings.Builder
+	c.write(&b, latest)
+	e.file, e.stamp, e.metrics = latest, stamp, []byte(b.String())
+	slog.Info("Metrics reloaded", "file", latest)
+	return nil
+}
+
+// ************************************************************************************************
+// promCollector is a HostConsumer gathering the metrics of one scan.
+type promCollector struct {
+	filter  *PortFilter
+	hostsUp int
+	start   int64
+	hosts   []promHost
+}
+
+// promHost is an up host and its open ports.
+type promHost struct {
+	ip, hostname string
+	ports        []Port
+}
+
+// newPromCollector creates a collector for the open ports selected by filter.
+func newPromCollector(filter *PortFilter) *promCollector {
+	return &promCollector{filter: filter}
+}
+
+// Add implements HostConsumer.
+func (c *promCollector) Add(h *Host) {
+	if !h.IsUp() {
+		return
+	}
+	c.hostsUp++
+	ph := promHost{ip: h.IP()}
+	if len(h.Hostnames) > 0 {
+		ph.hostname = h.Hostnames[0].Name
+	}
+	for _, p := range h.Ports {
+		if p.State.State == "open" && c.filter.Match(&p) {
+			ph.ports = append(ph.ports, p)
+		}
+	}
+	c.hosts = append(c.hosts, ph)
+}
+
+// AddMeta implements MetaConsumer.
+func (c *promCollector) AddMeta(m *ScanMeta) {
+	c.start = m.Start
+}
+
+// write renders the metrics in the Prometheus text exposition format.
+func (c *promCollector) write(w io.Writer, file string) {
+	sort.Slice(c.hosts, func(i, j int) bool { return c.hosts[i].ip < c.hosts[j].ip })
+
+	fmt.Fprintln(w, "# HELP nmap_hosts_up Number of hosts up in the latest scan.")
+	fmt.Fprintln(w, "# TYPE nmap_hosts_up gauge")
+	fmt.Fprintf(w, "nmap_hosts_up %d\n", c.hostsUp)
+
+	fmt.Fprintln(w, "# HELP nmap_host_open_ports Number of open ports of a host in the latest scan.")
+	fmt.Fprintln(w, "# TYPE nmap_host_open_ports gauge")
+	for _, h := range c.hosts {
+		fmt.Fprintf(w, "nmap_host_open_ports{host=%s,hostname=%s} %d\n", promLabel(h.ip), promLabel(h.hostname), len(h.ports))
+	}
+
+	fmt.Fprintln(w, "# HELP nmap_open_ports Open port of a host in the latest scan, always 1.")
+	fmt.Fprintln(w, "# TYPE nmap_open_ports gauge")
+	for _, h := range c.hosts {
+		for _, p := range h.ports {
+			fmt.Fprintf(w, "nmap_open_ports{host=%s,hostname=%s,port=%s,protocol=%s,service=%s} 1\n",
+				promLabel(h.ip), promLabel(h.hostname), promLabel(strconv.Itoa(p.PortID)), promLabel(p.Protocol), promLabel(p.Service.Name))
+		}
+	}
+
+	if c.start > 0 {
+		fmt.Fprintln(w, "# HELP nmap_scan_start_timestamp_seconds Start time of the latest scan.")
+		fmt.Fprintln(w, "# TYPE nmap_scan_start_timestamp_seconds gauge")
+		fmt.Fprintf(w, "nmap_scan_start_timestamp_seconds{file=%s} %d\n", promLabel(file), c.start)
+	}
+}
+
+// promLabel quotes a label value, escaping backslashes, double quotes and newlines.
+func promLabel(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
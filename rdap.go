@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// rdapBootstrapURL redirects IP network queries to the registry (ARIN, RIPE NCC, APNIC...)
+// responsible for the address.
+const rdapBootstrapURL = "https://rdap.org/ip/"
+
+// rdapInterval spaces the RDAP requests, as the registries rate-limit their public servers.
+const rdapInterval = 500 * time.Millisecond
+
+// ************************************************************************************************
+// rdapSource implements -rdap: the public addresses of the hosts are annotated with the network
+// registered for them and its owner. Networks already retrieved are reused for the other addresses
+// they contain, so the hosts of a same netblock cost a single request.
+type rdapSource struct {
+	client *http.Client
+	last   time.Time
+	nets   []rdapNet
+}
+
+// rdapNet is a retrieved registration and the address range it covers.
+type rdapNet struct {
+	first, last netip.Addr
+	info        *OwnerInfo
+}
+
+// newRDAPSource creates the -rdap lookup.
+func newRDAPSource() *rdapSource {
+	return &rdapSource{client: &http.Client{Timeout: exposureHTTPTimeout}}
+}
+
+// Enrich implements hostEnricher. Private, loopback and link-local addresses are not looked up.
+func (s *rdapSource) Enrich(h *Host) {
+	if h.Owner != nil {
+		return
+	}
+	ip, ok := publicAddr(h)
+	if !ok {
+		return
+	}
+	for _, n := range s.nets {
+		if n.first.Compare(ip) <= 0 && ip.Compare(n.last) <= 0 {
+			h.Owner = n.info
+			return
+		}
+	}
+	if wait := rdapInterval - time.Since(s.last); wait > 0 {
+		time.Sleep(wait)
+	}
+	s.last = time.Now()
+	n, err := s.fetch(ip)
+	if err != nil {
+		slog.Warn("RDAP lookup failed", "addr", ip, "err", err)
+		return
+	}
+	s.nets = append(s.nets, n)
+	h.Owner = n.info
+}
+
+// rdapEntity is a contact of an RDAP network object, with its vCard (jCard) and sub-entities.
+type rdapEntity struct {
+	Roles    []string          `json:"roles"`
+	VCard    []json.RawMessage `json:"vcardArray"`
+	Entities []rdapEntity      `json:"entities"`
+}
+
+// fetch retrieves the network registration containing ip.
+func (s *rdapSource) fetch(ip netip.Addr) (rdapNet, error) {
+	req, err := http.NewRequest(http.MethodGet, rdapBootstrapURL+url.PathEscape(ip.String()), nil)
+	if err != nil {
+		return rdapNet{}, err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return rdapNet{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rdapNet{}, fmt.Errorf("%s", resp.Status)
+	}
+	var answer struct {
+		Name     string       `json:"name"`
+		Handle   string       `json:"handle"`
+		Start    string       `json:"startAddress"`
+		End      string       `json:"endAddress"`
+		Entities []rdapEntity `json:"entities"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&answer); err != nil {
+		return rdapNet{}, err
+	}
+	n := rdapNet{first: ip, last: ip, info: &OwnerInfo{NetName: answer.Name, Org: rdapOwner(answer.Entities)}}
+	first, errFirst := netip.ParseAddr(answer.Start)
+	last, errLast := netip.ParseAddr(answer.End)
+	if errFirst == nil && errLast == nil {
+		n.first, n.last = first.Unmap(), last.Unmap()
+		n.info.Range = n.first.String() + " - " + n.last.String()
+	}
+	if n.info.NetName == "" {
+		n.info.NetName = answer.Handle
+	}
+	if n.info.Org == "" && n.info.NetName == "" {
+		return rdapNet{}, errors.New("no registration data")
+	}
+	return n, nil
+}
+
+// rdapOwner returns the name of the registrant of a network, falling back to the first named
+// entity (some registries only list administrative or abuse contacts).
+func rdapOwner(entities []rdapEntity) string {
+	var fallback string
+	var walk func(list []rdapEntity) string
+	walk = func(list []rdapEntity) string {
+		for _, e := range list {
+			name := vcardName(e.VCard)
+			if name != "" && slices.Contains(e.Roles, "registrant") {
+				return name
+			}
+			if fallback == "" {
+				fallback = name
+			}
+			if n := walk(e.Entities); n != "" {
+				return n
+			}
+		}
+		return ""
+	}
+	if n := walk(entities); n != "" {
+		return n
+	}
+	return fallback
+}
+
+// vcardName returns the "fn" (formatted name) property of a jCard: ["vcard", [["fn", {}, "text",
+// "Google LLC"], ...]].
+func vcardName(vcard []json.RawMessage) string {
+	if len(vcard) < 2 {
+		return ""
+	}
+	var props [][]json.RawMessage
+	if err := json.Unmarshal(vcard[1], &props); err != nil {
+		return ""
+	}
+	for _, p := range props {
+		var name, value string
+		if len(p) < 4 || json.Unmarshal(p[0], &name) != nil || name != "fn" {
+			continue
+		}
+		if json.Unmarshal(p[3], &value) == nil {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
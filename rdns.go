@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+// ************************************************************************************************
+// rdnsResolver implements -rdns: the hosts the scanner did not name (-n scans) get the name of the
+// PTR record of their address. Lookups run concurrently while the scans are streamed.
+type rdnsResolver struct {
+	workers int
+	timeout time.Duration
+}
+
+// lookup fills the hostname of h from its PTR record when it has none.
+func (r *rdnsResolver) lookup(h *Host) {
+	if len(h.Hostnames) > 0 {
+		return
+	}
+	ip := h.IP()
+	if ip == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		slog.Debug("Reverse DNS lookup failed", "addr", ip, "err", err)
+		return
+	}
+	h.Hostnames = append(h.Hostnames, Hostname{Name: strings.TrimSuffix(names[0], ".")})
+}
+
+// ************************************************************************************************
+// rdnsPipeline resolves the hosts on up to workers goroutines and hands them to deliver in their
+// original order. At most rdnsWindow hosts per worker are waiting for an earlier one at any time.
+type rdnsPipeline struct {
+	r       *rdnsResolver
+	deliver HostHandler
+	sem     chan struct{}
+	queue   []rdnsJob
+	err     error
+}
+
+// rdnsWindow bounds the hosts buffered per worker while an earlier lookup is pending.
+const rdnsWindow = 4
+
+// rdnsJob is a host whose lookup is running; done is closed when it completes.
+type rdnsJob struct {
+	h    *Host
+	done chan struct{}
+}
+
+// pipeline creates a resolution pipeline delivering the named hosts to deliver.
+func (r *rdnsResolver) pipeline(deliver HostHandler) *rdnsPipeline {
+	return &rdnsPipeline{r: r, deliver: deliver, sem: make(chan struct{}, max(r.workers, 1))}
+}
+
+// Add implements HostHandler: the lookup of h is started and the hosts at the head of the queue
+// whose lookup completed are delivered.
+func (p *rdnsPipeline) Add(h *Host) error {
+	job := rdnsJob{h: h, done: make(chan struct{})}
+	p.sem <- struct{}{}
+	go func() {
+		p.r.lookup(h)
+		<-p.sem
+		close(job.done)
+	}()
+	p.queue = append(p.queue, job)
+	for len(p.queue) > 0 && p.err == nil {
+		if len(p.queue) > cap(p.sem)*rdnsWindow {
+			<-p.queue[0].done
+		} else {
+			select {
+			case <-p.queue[0].done:
+			default:
+				return p.err
+			}
+		}
+		p.err = p.deliver(p.queue[0].h)
+		p.queue = p.queue[1:]
+	}
+	return p.err
+}
+
+// Flush waits for the pending lookups and delivers their hosts. It must be called before the
+// consumers are told about a new scan or its metadata, so hosts are never attributed to the wrong
+// one.
+func (p *rdnsPipeline) Flush() error {
+	for _, job := range p.queue {
+		<-job.done
+		if p.err == nil {
+			p.err = p.deliver(job.h)
+		}
+	}
+	p.queue = nil
+	return p.err
+}
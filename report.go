@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+)
+
+// ************************************************************************************************
+// Report is the tabular result produced by one of the analysis modes.
+// Modes only build the header and rows; rendering to the output formats is shared by all of them.
+type Report struct {
+	// Headers holds the column names, in display order.
+	Headers []string
+
+	// Rows holds one slice of cell values per output line, aligned with Headers.
+	Rows [][]string
+
+	// Records holds the typed rows ([]HostInfo, []PortInfo, ...) in the same order as Rows,
+	// for structured output formats.
+	Records any
+
+	// spool holds the rows and records instead of Rows and Records when the mode spilled them to
+	// temporary files (-spill).
+	spool *rowSpool
+}
+
+// Len returns the number of rows of the report.
+func (r *Report) Len() int {
+	if r.spool != nil {
+		return r.spool.Len()
+	}
+	return len(r.Rows)
+}
+
+// Close removes the temporary files of a spilled report.
+func (r *Report) Close() {
+	if r != nil && r.spool != nil {
+		r.spool.Close()
+	}
+}
+
+// eachRow passes the cells of every row, in order, to fn, stopping at the first error.
+func (r *Report) eachRow(fn func(row []string) error) error {
+	if r.spool != nil {
+		return r.spool.Each(func(row *spooledRow) error { return fn(row.Cells) })
+	}
+	for _, row := range r.Rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachRecord passes every typed record, in order, to fn, stopping at the first error. The records
+// of a spilled report are passed as their JSON encoding.
+func (r *Report) eachRecord(fn func(record any) error) error {
+	if r.spool != nil {
+		return r.spool.Each(func(row *spooledRow) error { return fn(row.Record) })
+	}
+	if r.Records == nil {
+		return nil
+	}
+	records := reflect.ValueOf(r.Records)
+	for i := 0; i < records.Len(); i++ {
+		if err := fn(records.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ************************************************************************************************
+// RenameHeaders replaces the column names found in names (original name to new name). Columns
+// absent from the mapping keep their name. Structured formats (JSON) are not affected.
+func (r *Report) RenameHeaders(names map[string]string) {
+	if r == nil || len(names) == 0 {
+		return
+	}
+	for i, h := range r.Headers {
+		if n, ok := names[h]; ok {
+			r.Headers[i] = n
+		}
+	}
+}
+
+// Output formats supported by Report.Write.
+const (
+	formatTable = "table"
+	formatCSV   = "csv"
+	formatJSON  = "json"
+	formatJSONL = "jsonl"
+	formatMD    = "md"
+	formatLLD   = "zabbix"
+)
+
+// ************************************************************************************************
+// RenderOptions tunes how reports are rendered. The zero value renders the default output.
+type RenderOptions struct {
+	// Delimiter is the CSV field separator; zero means a comma.
+	Delimiter rune
+
+	// Excel makes CSV output open cleanly in Microsoft Excel: UTF-8 BOM, CRLF line endings and
+	// values Excel would auto-convert (MACs, port lists, long numbers) wrapped as ="text".
+	Excel bool
+
+	// NoSanitize disables the CSV formula-injection protection, writing cell values verbatim.
+	NoSanitize bool
+
+	// NoHeader omits the header line of CSV and table output, so that several outputs can be
+	// concatenated or piped into other tools.
+	NoHeader bool
+
+	// appending is set when rows are added to an existing file (-append): neither the header nor
+	// the Excel BOM is written again.
+	appending bool
+}
+
+// ************************************************************************************************
+// Write renders the report to out in the given output format.
+func (r *Report) Write(out io.Writer, format string, opts RenderOptions) error {
+	switch format {
+	case formatCSV:
+		return r.WriteCSV(out, opts)
+	case formatJSON:
+		return r.WriteJSON(out)
+	case formatJSONL:
+		return r.WriteJSONLines(out)
+	case formatMD:
+		return r.WriteMarkdown(out)
+	case formatLLD:
+		return r.WriteZabbixLLD(out)
+	case formatTable:
+		return r.WriteTable(out, opts)
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// ************************************************************************************************
+// WriteCSV renders the report as comma-separated values, header first. The separator can be changed
+// with RenderOptions.Delimiter (e.g. ';' for European Excel locales, '\t' for TSV).
+// Cells are sanitized against formula injection unless RenderOptions.NoSanitize is set.
+func (r *Report) WriteCSV(out io.Writer, opts RenderOptions) error {
+	if opts.Excel && !opts.appending {
+		if _, err := io.WriteString(out, "\ufeff"); err != nil {
+			return err
+		}
+	}
+	w := csv.NewWriter(out)
+	if opts.Delimiter != 0 {
+		w.Comma = opts.Delimiter
+	}
+	w.UseCRLF = opts.Excel
+	if !opts.NoHeader && !opts.appending {
+		if err := w.Write(r.Headers); err != nil {
+			return err
+		}
+	}
+	err := r.eachRow(func(row []string) error {
+		if !opts.NoSanitize {
+			row = sanitizeCells(row)
+		}
+		if opts.Excel {
+			row = excelProtect(row)
+		}
+		return w.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// ************************************************************************************************
+// sanitizeCells returns a copy of row where every cell a spreadsheet would evaluate as a formula is
+// prefixed with a single quote. Hostnames, vendors and service names come from the scanned targets,
+// so a value like =HYPERLINK(...) must not run when the CSV is opened.
+func sanitizeCells(row []string) []string {
+	out := make([]string, len(row))
+	for i, c := range row {
+		if c != "" && strings.ContainsRune(formulaTriggers, rune(c[0])) {
+			c = "'" + c
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// formulaTriggers lists the leading characters that make spreadsheets interpret a cell as a formula.
+const formulaTriggers = "=+-@\t\r"
+
+// ************************************************************************************************
+// excelProtect returns a copy of row where every cell Excel would silently convert is wrapped as
+// a ="..." text formula.
+func excelProtect(row []string) []string {
+	out := make([]string, len(row))
+	for i, c := range row {
+		if excelWouldConvert(c) {
+			c = `="` + strings.ReplaceAll(c, `"`, `""`) + `"`
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// ************************************************************************************************
+// excelWouldConvert reports whether Excel would turn the text into a number, date or time on
+// opening: integers with leading zeros or more than 11 digits (shown in scientific notation),
+// and any digit string mixing separators such as MACs, times, dates, decimals or port lists.
+// Short plain integers are left alone so that counts stay numeric.
+func excelWouldConvert(s string) bool {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return false
+	}
+	plain := true
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.' || c == ',' || c == ':' || c == '/' || c == '-' || c == ' ' || c == 'E' || c == 'e':
+			plain = false
+		default:
+			return false
+		}
+	}
+	if plain {
+		return len(s) > 11 || (len(s) > 1 && s[0] == '0')
+	}
+	return true
+}
+
+// ************************************************************************************************
+// WriteTable renders the report as aligned columns with a dashed line under the header.
+// RenderOptions.NoHeader drops both the header and the dashed line. The column widths depend on
+// every row, which are all buffered until the table is written.
+func (r *Report) WriteTable(out io.Writer, opts RenderOptions) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if !opts.NoHeader {
+		underline := make([]string, len(r.Headers))
+		for i, h := range r.Headers {
+			underline[i] = strings.Repeat("-", len(h))
+		}
+		fmt.Fprintln(w, strings.Join(r.Headers, "\t"))
+		fmt.Fprintln(w, strings.Join(underline, "\t"))
+	}
+	err := r.eachRow(func(row []string) error {
+		_, err := fmt.Fprintln(w, strings.Join(row, "\t"))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// ************************************************************************************************
+// WriteJSON renders the typed records of the report as an indented JSON array, one record at a time.
+// An empty report is written as [] rather than null.
+func (r *Report) WriteJSON(out io.Writer) error {
+	bw := bufio.NewWriter(out)
+	count := 0
+	err := r.eachRecord(func(record any) error {
+		data, err := json.MarshalIndent(record, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			bw.WriteString("[\n  ")
+		} else {
+			bw.WriteString(",\n  ")
+		}
+		count++
+		_, err = bw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		bw.WriteString("[]\n")
+	} else {
+		bw.WriteString("\n]\n")
+	}
+	return bw.Flush()
+}
+
+// ************************************************************************************************
+// WriteJSONLines renders the typed records of the report as JSON Lines: one compact object per
+// line, with no enclosing array, so the output can be streamed into jq, Logstash or bulk loaders.
+func (r *Report) WriteJSONLines(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	return r.eachRecord(func(record any) error { return enc.Encode(record) })
+}
+
+// ************************************************************************************************
+// WriteZabbixLLD renders the rows of the report as Zabbix low-level discovery data: one object per
+// row whose keys are LLD macros named after the columns ("Port/Proto" gives {#PORT_PROTO}), so that
+// the long mode yields {#HOSTNAME}, {#IP}, {#PORT}, {#PROTO}, {#STATE} and {#SERVICE} entries.
+func (r *Report) WriteZabbixLLD(out io.Writer) error {
+	macros := make([]string, len(r.Headers))
+	for i, h := range r.Headers {
+		macros[i] = "{#" + lldMacroName(h) + "}"
+	}
+	data := make([]map[string]string, 0, r.Len())
+	err := r.eachRow(func(row []string) error {
+		entry := make(map[string]string, len(row))
+		for i, cell := range row {
+			entry[macros[i]] = cell
+		}
+		data = append(data, entry)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Data []map[string]string `json:"data"`
+	}{data})
+}
+
+// lldMacroName converts a column name into an LLD macro name: upper case letters, digits and
+// underscores.
+func lldMacroName(header string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, header)
+}
+
+// ************************************************************************************************
+// WriteMarkdown renders the report as a GitHub-flavored Markdown table, ready to be pasted in
+// reports, wikis or pull requests. Pipes and line breaks inside cells are escaped.
+func (r *Report) WriteMarkdown(out io.Writer) error {
+	bw := bufio.NewWriter(out)
+	writeRow := func(cells []string) {
+		bw.WriteString("|")
+		for _, c := range cells {
+			bw.WriteString(" ")
+			bw.WriteString(markdownEscaper.Replace(c))
+			bw.WriteString(" |")
+		}
+		bw.WriteString("\n")
+	}
+	writeRow(r.Headers)
+	separator := make([]string, len(r.Headers))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	writeRow(separator)
+	err := r.eachRow(func(row []string) error {
+		writeRow(row)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// markdownEscaper neutralises the characters that would break a Markdown table cell.
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\r\n", " ", "\n", " ")
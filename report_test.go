@@ -0,0 +1,109 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// ************************************************************************************************
+// TestReportWrite checks the rendering of a report in every output format.
+func TestReportWrite(t *testing.T) {
+	type record struct {
+		Host  string `json:"host"`
+		Ports string `json:"ports"`
+	}
+	report := func() *Report {
+		return &Report{
+			Headers: []string{"Host", "Port/Proto"},
+			Rows:    [][]string{{"=cmd|' /C calc'!A0", "22,443"}, {"db|1", "00123"}},
+			Records: []record{{"=cmd|' /C calc'!A0", "22,443"}, {"db|1", "00123"}},
+		}
+	}
+	tests := []struct {
+		name   string
+		format string
+		opts   RenderOptions
+		want   string
+	}{
+		{"csv", formatCSV, RenderOptions{}, "Host,Port/Proto\n'=cmd|' /C calc'!A0,\"22,443\"\ndb|1,00123\n"},
+		{"csv no-sanitize", formatCSV, RenderOptions{NoSanitize: true}, "Host,Port/Proto\n=cmd|' /C calc'!A0,\"22,443\"\ndb|1,00123\n"},
+		{"csv no-header", formatCSV, RenderOptions{NoHeader: true, Delimiter: ';'}, "'=cmd|' /C calc'!A0;22,443\ndb|1;00123\n"},
+		{"csv excel", formatCSV, RenderOptions{Excel: true}, "\ufeffHost,Port/Proto\r\n'=cmd|' /C calc'!A0,\"=\"\"22,443\"\"\"\r\ndb|1,\"=\"\"00123\"\"\"\r\n"},
+		{"csv appending", formatCSV, RenderOptions{Excel: true, appending: true}, "'=cmd|' /C calc'!A0,\"=\"\"22,443\"\"\"\r\ndb|1,\"=\"\"00123\"\"\"\r\n"},
+		{"table", formatTable, RenderOptions{}, "Host                Port/Proto\n----                ----------\n=cmd|' /C calc'!A0  22,443\ndb|1                00123\n"},
+		{"json", formatJSON, RenderOptions{}, "[\n  {\n    \"host\": \"=cmd|' /C calc'!A0\",\n    \"ports\": \"22,443\"\n  },\n  {\n    \"host\": \"db|1\",\n    \"ports\": \"00123\"\n  }\n]\n"},
+		{"jsonl", formatJSONL, RenderOptions{}, "{\"host\":\"=cmd|' /C calc'!A0\",\"ports\":\"22,443\"}\n{\"host\":\"db|1\",\"ports\":\"00123\"}\n"},
+		{"markdown", formatMD, RenderOptions{}, "| Host | Port/Proto |\n| --- | --- |\n| =cmd\\|' /C calc'!A0 | 22,443 |\n| db\\|1 | 00123 |\n"},
+		{"zabbix", formatLLD, RenderOptions{}, "{\n  \"data\": [\n    {\n      \"{#HOST}\": \"=cmd|' /C calc'!A0\",\n      \"{#PORT_PROTO}\": \"22,443\"\n    },\n    {\n      \"{#HOST}\": \"db|1\",\n      \"{#PORT_PROTO}\": \"00123\"\n    }\n  ]\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := report().Write(&b, tt.format, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", b.String(), tt.want)
+			}
+		})
+	}
+
+	if err := report().Write(&strings.Builder{}, "xml", RenderOptions{}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+// ************************************************************************************************
+// TestSanitizeCells checks the cells prefixed against formula injection.
+func TestSanitizeCells(t *testing.T) {
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{"", ""},
+		{"gw.lan", "gw.lan"},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"\rcmd", "'\rcmd"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeCells([]string{tt.cell}); !slices.Equal(got, []string{tt.want}) {
+			t.Errorf("sanitizeCells(%q) = %q, want %q", tt.cell, got[0], tt.want)
+		}
+	}
+}
+
+// ************************************************************************************************
+// TestExcelProtect checks the cells wrapped so that Excel keeps them as text.
+func TestExcelProtect(t *testing.T) {
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{"", ""},
+		{"42", "42"},
+		{"0", "0"},
+		{"007", `="007"`},
+		{"123456789012", `="123456789012"`},
+		{"12345678901", "12345678901"},
+		{"22,443", `="22,443"`},
+		{"00:11:22:33:44:55", `="00:11:22:33:44:55"`},
+		{"10.0.0.1", `="10.0.0.1"`},
+		{"2024-01-02", `="2024-01-02"`},
+		{"1E5", `="1E5"`},
+		{"1/2", `="1/2"`},
+		{"445/tcp", "445/tcp"},
+		{"22/tcp(ssh)", "22/tcp(ssh)"},
+		{"gw.lan", "gw.lan"},
+	}
+	for _, tt := range tests {
+		if got := excelProtect([]string{tt.cell}); !slices.Equal(got, []string{tt.want}) {
+			t.Errorf("excelProtect(%q) = %q, want %q", tt.cell, got[0], tt.want)
+		}
+	}
+}
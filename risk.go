@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ************************************************************************************************
+// riskRule adds Weight to the risk score of the hosts satisfying a hostExpr condition.
+type riskRule struct {
+	Name   string
+	Weight int
+	expr   *hostExpr
+}
+
+// defaultRiskRules are the built-in rules of -risk, in the -risk-rules format.
+const defaultRiskRules = `
+rules:
+  - name: telnet
+    weight: 40
+    when: service("telnet")
+  - name: anonymous FTP
+    weight: 35
+    when: script("ftp-anon")
+  - name: FTP
+    weight: 10
+    when: service("ftp")
+  - name: SMB vulnerability
+    weight: 50
+    when: script("smb-vuln-*")
+  - name: NetBIOS session (SMBv1 era)
+    weight: 20
+    when: port(139).open
+  - name: SMB
+    weight: 15
+    when: port(445).open
+  - name: RDP
+    weight: 25
+    when: service("rdp")
+  - name: VNC
+    weight: 25
+    when: service("vnc")
+  - name: database
+    weight: 30
+    when: service("mysql") || service("postgresql") || service("mssql") || service("oracle-tns") || service("mongodb") || service("redis") || port(9200).open || port(11211).open
+  - name: SNMP
+    weight: 15
+    when: service("snmp")
+  - name: cleartext web
+    weight: 5
+    when: cleartext("http")
+`
+
+// ************************************************************************************************
+// riskScorer computes the risk score of the hosts: the sum of the weights of the rules they
+// satisfy.
+type riskScorer []riskRule
+
+// ************************************************************************************************
+// newRiskScorer loads the -risk-rules file, or the built-in rules when path is empty. A rules file
+// is a YAML document listing named, weighted conditions in the -filter language:
+//
+//	rules:
+//	  - name: telnet
+//	    weight: 40
+//	    when: service("telnet")
+func newRiskScorer(path string) (riskScorer, error) {
+	data := []byte(defaultRiskRules)
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	s, err := parseRiskRules(data)
+	if err != nil && path != "" {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, err
+}
+
+// parseRiskRules parses a YAML rules document.
+func parseRiskRules(data []byte) (riskScorer, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a mapping with a rules key")
+	}
+	list, ok := root["rules"].([]any)
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("expected a non-empty rules sequence")
+	}
+	var s riskScorer
+	for i, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("rule %d: expected name, weight and when keys", i+1)
+		}
+		name, _ := m["name"].(string)
+		when, _ := m["when"].(string)
+		weight, _ := m["weight"].(string)
+		if name == "" || when == "" {
+			return nil, fmt.Errorf("rule %d: name and when are required", i+1)
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid weight %q", name, weight)
+		}
+		expr, err := parseHostExpr(when)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", name, err)
+		}
+		s = append(s, riskRule{Name: name, Weight: w, expr: expr})
+	}
+	return s, nil
+}
+
+// Enrich implements hostEnricher. It must run after the other enrichers and the device
+// classification, whose data the rules may use.
+func (s riskScorer) Enrich(h *Host) {
+	if h.Risk != nil {
+		return
+	}
+	r := &RiskScore{}
+	for _, rule := range s {
+		if rule.Weight != 0 && rule.expr.Match(h) {
+			r.Score += rule.Weight
+			r.Factors = append(r.Factors, rule.Name)
+		}
+	}
+	h.Risk = r
+}
+
+// riskFactors renders the names of the rules a host satisfied.
+func riskFactors(h *Host) string {
+	if h.Risk == nil {
+		return ""
+	}
+	return strings.Join(h.Risk.Factors, ", ")
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/1mm0rt41PC/nmap2csv/pkg/nmapparse"
+)
+
+// ************************************************************************************************
+// run streams files once through every consumer required by the options (the selected modes, the
+// aggregators behind -xlsx, -pdf and -template, the -sqlite, -db, -xml-out, -influx and -split-csv
+// exporters and the sinks such as -splunk-hec, -syslog, -kafka, -netbox-url, -notify-url and
+// -chat-webhook) and then writes all the outputs, to stdout or to the files chosen by -o / -outdir.
+// The reports can also be uploaded (-s3) and mailed (-mail-to). With -dry-run, nothing is written
+// nor sent and the number of rows of each output is printed. With -timing, the duration of its
+// phases is printed on stderr once done.
+func (o *Options) run(files []string, lenient bool) error {
+	if o.Timing {
+		o.timing = newRunTiming()
+		defer func() {
+			o.timing.write(os.Stderr)
+			o.timing = nil
+		}()
+	}
+
+	var consumers []HostConsumer
+
+	selected := o.selectedModes()
+	modeAggs := make([]Aggregator, len(selected))
+	for i, m := range selected {
+		modeAggs[i] = m.newAggregator(o)
+		consumers = append(consumers, modeAggs[i])
+	}
+
+	// The workbook, the PDF report and the templates expose the three modes at once.
+	var hostsAgg, portsAgg, vendorsAgg Aggregator
+	if o.XLSX != "" || o.PDF != "" || o.tmpl != nil {
+		hostsAgg, portsAgg, vendorsAgg = o.newHostnameAggregator(), newPortAggregator(o.states), newVendorAggregator()
+		consumers = append(consumers, hostsAgg, portsAgg, vendorsAgg)
+	}
+
+	// The body of the -mail-to message and the title page of the PDF report show the summary mode
+	// report.
+	var summaryAgg Aggregator
+	if o.MailTo != "" || o.PDF != "" {
+		summaryAgg = newSummaryAggregator()
+		consumers = append(consumers, summaryAgg)
+	}
+
+	var db *sqlExporter
+	if o.SQLite != "" && !o.DryRun {
+		var err error
+		if db, err = openSQLExporter(dialectSQLite, o.SQLite); err != nil {
+			return fmt.Errorf("open %s: %w", o.SQLite, err)
+		}
+		consumers = append(consumers, db)
+	}
+
+	var remote *sqlExporter
+	var remoteName string
+	if o.DB != "" && !o.DryRun {
+		dialect, dsn, err := parseDatabaseURL(o.DB)
+		if err != nil {
+			return err
+		}
+		remoteName = redactURL(o.DB)
+		if remote, err = openSQLExporter(dialect, dsn); err != nil {
+			return fmt.Errorf("open %s: %w", remoteName, err)
+		}
+		consumers = append(consumers, remote)
+	}
+
+	var xmlOut *xmlExporter
+	if o.XMLOut != "" && !o.DryRun {
+		var err error
+		if xmlOut, err = newXMLExporter(o.XMLOut, o.portFilter()); err != nil {
+			return err
+		}
+		consumers = append(consumers, xmlOut)
+	}
+
+	var influx *influxExporter
+	if o.Influx != "" && !o.DryRun {
+		var err error
+		if influx, err = newInfluxExporter(o.Influx, o.portFilter()); err != nil {
+			return err
+		}
+		consumers = append(consumers, influx)
+	}
+
+	var split *splitCSVExporter
+	if o.SplitCSV != "" && !o.DryRun {
+		var err error
+		if split, err = newSplitCSVExporter(o.SplitCSV, o.Force, o.render); err != nil {
+			return err
+		}
+		consumers = append(consumers, split)
+	}
+
+	// With -dry-run, the exporters and sinks are not opened: the hosts they would receive are
+	// counted instead.
+	var counted *dryRunCounter
+	if o.DryRun {
+		counted = &dryRunCounter{filter: o.portFilter()}
+		consumers = append(consumers, counted)
+	}
+
+	var sinks []namedSink
+	if !o.DryRun {
+		var err error
+		if sinks, err = o.openSinks(); err != nil {
+			return err
+		}
+		for _, s := range sinks {
+			consumers = append(consumers, s.sink)
+		}
+	}
+
+	_, err := o.streamInputs(files, lenient, consumers...)
+
+	// The exporters are closed even when an input could not be loaded, to release their files and
+	// connections; the first error is returned.
+	var closers []namedCloser
+	for _, s := range sinks {
+		closers = append(closers, namedCloser{s.name, s.sink})
+	}
+	if split != nil {
+		closers = append(closers, namedCloser{"write " + o.SplitCSV, split})
+	}
+	if xmlOut != nil {
+		closers = append(closers, namedCloser{"write " + o.XMLOut, xmlOut})
+	}
+	if influx != nil {
+		closers = append(closers, namedCloser{"write " + o.Influx, influx})
+	}
+	if db != nil {
+		closers = append(closers, namedCloser{"write " + o.SQLite, db})
+	}
+	if remote != nil {
+		closers = append(closers, namedCloser{"write " + remoteName, remote})
+	}
+	for _, c := range closers {
+		if cerr := c.closer.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("%s: %w", c.name, cerr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if counted != nil {
+		o.reportDryRunExports(counted)
+	}
+
+	var hosts, ports, vendors *Report
+	if hostsAgg != nil {
+		hosts, ports, vendors = hostsAgg.Report(), portsAgg.Report(), vendorsAgg.Report()
+	}
+
+	reports := make([]*Report, len(selected))
+	for i, agg := range modeAggs {
+		reports[i] = agg.Report()
+		defer reports[i].Close()
+	}
+	for _, r := range append([]*Report{hosts, ports, vendors}, reports...) {
+		r.RenameHeaders(o.headerMap)
+	}
+
+	// With -s3, the outputs are also rendered in memory, to be uploaded once all are written.
+	var uploads []s3Object
+	keep := func(name string, write func(w io.Writer) error) error {
+		if o.S3 == "" || o.DryRun {
+			return nil
+		}
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			return err
+		}
+		uploads = append(uploads, s3Object{name: name + o.outputExt(), body: buf.Bytes()})
+		return nil
+	}
+
+	if o.tmpl != nil {
+		var name string
+		var report *Report
+		if len(reports) > 0 {
+			name, report = selected[0].Name, reports[0]
+		}
+		data := newTemplateData(name, report, hosts, ports, vendors)
+		path := o.outputPath(mode{File: "report"})
+		if o.DryRun {
+			fmt.Fprintf(o.out(), "Would render %d rows through %s to %s%s\n", data.rowCount(), o.Template, destination(path), o.forceNote(path))
+		} else if err := o.writeOutput(path, func(w io.Writer) error { return o.tmpl.Execute(w, data) }); err != nil {
+			return fmt.Errorf("render %s: %w", o.Template, err)
+		}
+		if err := keep("report", func(w io.Writer) error { return o.tmpl.Execute(w, data) }); err != nil {
+			return fmt.Errorf("render %s: %w", o.Template, err)
+		}
+	} else {
+		// Successive reports written to stdout are separated by an empty line.
+		onStdout := false
+		for i, report := range reports {
+			path := o.outputPath(selected[i])
+			if o.DryRun {
+				note := ""
+				if !o.Append {
+					note = o.forceNote(path)
+				}
+				fmt.Fprintf(o.out(), "Would write %d rows to %s%s\n", report.Len(), destination(path), note)
+				continue
+			}
+			if path == "" {
+				if onStdout {
+					fmt.Fprintln(o.out())
+				}
+				onStdout = true
+			}
+			var err error
+			if o.Append && path != "" {
+				err = appendOutput(path, func(w io.Writer, existing bool) error {
+					render := o.render
+					render.appending = existing
+					return report.Write(w, o.format(), render)
+				})
+			} else {
+				err = o.writeOutput(path, func(w io.Writer) error { return report.Write(w, o.format(), o.render) })
+			}
+			if err != nil {
+				return err
+			}
+			if path != "" {
+				slog.Info("Report written", "mode", selected[i].Name, "file", path, "rows", report.Len())
+			}
+			if err := keep(selected[i].File, func(w io.Writer) error { return report.Write(w, o.format(), o.render) }); err != nil {
+				return err
+			}
+		}
+	}
+
+	if o.S3 != "" {
+		if o.DryRun {
+			count := len(reports)
+			if o.tmpl != nil {
+				count = 1
+			}
+			fmt.Fprintf(o.out(), "Would upload %d reports to %s\n", count, o.S3)
+		} else if cfg, err := o.s3Options(); err != nil {
+			return fmt.Errorf("-s3: %w", err)
+		} else if err := uploadS3(cfg, uploads); err != nil {
+			return fmt.Errorf("-s3: %w", err)
+		}
+	}
+
+	if o.XLSX != "" {
+		sheets := []xlsxSheet{{Name: "Hosts", Report: hosts}, {Name: "Ports", Report: ports}, {Name: "Vendors", Report: vendors}}
+		if o.DryRun {
+			fmt.Fprintf(o.out(), "Would write %d rows to %s\n", len(hosts.Rows)+len(ports.Rows)+len(vendors.Rows), o.XLSX)
+		} else if err := writeXLSX(o.XLSX, sheets); err != nil {
+			return fmt.Errorf("write %s: %w", o.XLSX, err)
+		}
+	}
+
+	if o.PDF != "" {
+		sections := []pdfSection{{Title: "Hosts", Report: hosts}, {Title: "Port Statistics", Report: ports}, {Title: "Vendors", Report: vendors}}
+		if o.DryRun {
+			fmt.Fprintf(o.out(), "Would write %d rows to %s\n", len(hosts.Rows)+len(ports.Rows)+len(vendors.Rows), o.PDF)
+		} else if err := writePDF(o.PDF, summaryAgg.Report(), sections); err != nil {
+			return fmt.Errorf("write %s: %w", o.PDF, err)
+		}
+	}
+
+	if o.MailTo != "" {
+		if o.DryRun {
+			fmt.Fprintf(o.out(), "Would mail %d reports to %s\n", len(reports), o.MailTo)
+		} else if err := o.mailReports(selected, reports, summaryAgg.Report()); err != nil {
+			return fmt.Errorf("-mail-to: %w", err)
+		}
+	}
+
+	// The delta mode inputs become the state the next run is compared to.
+	for i, m := range selected {
+		if m.Name != "delta" {
+			continue
+		}
+		if o.DryRun {
+			fmt.Fprintf(o.out(), "Would update the state of %s\n", o.StateDir)
+		} else if err := o.saveState(modeAggs[i].(*diffAggregator).cur); err != nil {
+			return fmt.Errorf("-state-dir: %w", err)
+		}
+	}
+
+	// Policy violations fail the run, once every output is written.
+	for i, m := range selected {
+		if m.Name == "policy" && len(reports[i].Rows) > 0 {
+			return fmt.Errorf("%w: %d open port(s) denied by %s", errPolicyViolation, len(reports[i].Rows), o.Policy)
+		}
+	}
+	return nil
+}
+
+// ************************************************************************************************
+// dryRunCounter counts the hosts and ports the exporters and sinks would receive, for -dry-run.
+type dryRunCounter struct {
+	filter   *PortFilter
+	hosts    int
+	up       int
+	ports    int
+	selected int
+}
+
+// Add implements HostConsumer.
+func (c *dryRunCounter) Add(h *Host) {
+	c.hosts++
+	if h.IsUp() {
+		c.up++
+	}
+	c.ports += len(h.Ports)
+	for i := range h.Ports {
+		if c.filter.Selected(&h.Ports[i]) {
+			c.selected++
+			break
+		}
+	}
+}
+
+// ************************************************************************************************
+// reportDryRunExports prints what the -sqlite, -db, -xml-out, -influx and -split-csv exporters
+// would write and the sinks would send, from the counts of c.
+func (o *Options) reportDryRunExports(c *dryRunCounter) {
+	if o.SQLite != "" {
+		fmt.Fprintf(o.out(), "Would write %d hosts and %d ports to %s\n", c.hosts, c.ports, o.SQLite)
+	}
+	if o.DB != "" {
+		fmt.Fprintf(o.out(), "Would write %d hosts and %d ports to %s\n", c.hosts, c.ports, redactURL(o.DB))
+	}
+	if o.XMLOut != "" {
+		fmt.Fprintf(o.out(), "Would write %d hosts to %s\n", c.selected, o.XMLOut)
+	}
+	if o.Influx != "" {
+		fmt.Fprintf(o.out(), "Would write %d hosts to %s\n", c.up, o.Influx)
+	}
+	if o.SplitCSV != "" {
+		for _, name := range []string{"hosts.csv", "ports.csv", "services.csv"} {
+			path := filepath.Join(o.SplitCSV, name)
+			fmt.Fprintf(o.out(), "Would write %d hosts and %d ports to %s%s\n", c.hosts, c.ports, path, o.forceNote(path))
+		}
+	}
+	for _, s := range []struct{ name, target string }{
+		{"-splunk-hec", o.SplunkHEC}, {"-syslog", o.Syslog}, {"-kafka", o.Kafka},
+		{"-netbox-url", o.NetBoxURL}, {"-notify-url", o.NotifyURL}, {"-chat-webhook", o.ChatWebhook},
+	} {
+		if s.target != "" {
+			fmt.Fprintf(o.out(), "Would send %d hosts to %s (%s)\n", c.hosts, redactURL(s.target), s.name)
+		}
+	}
+}
+
+// forceNote returns the note of a -dry-run line about a file output that already exists, and would
+// only be replaced with -force.
+func (o *Options) forceNote(path string) string {
+	if path == "" || o.Force {
+		return ""
+	}
+	if _, err := os.Stat(path); err == nil {
+		return " (exists, needs -force)"
+	}
+	return ""
+}
+
+// ************************************************************************************************
+// namedCloser is an exporter to close once the inputs are streamed and the name its errors are
+// reported with.
+type namedCloser struct {
+	name   string
+	closer io.Closer
+}
+
+// ************************************************************************************************
+// streamInputs streams every input file through all the given consumers.
+// A file that cannot be loaded stops the streaming with an error, unless lenient is set (watch
+// mode, where a file may still be in the middle of being written), in which case it is logged,
+// skipped and counted in failed, and no error is returned.
+// With -merge-by, hosts sharing the same key are merged across all the inputs: they are buffered
+// and only delivered once every file has been read, as a single scan. Hosts are completed by the
+// enrichers (-oui, -geoip, -asn, -rdap, -exposure, -rdns) and those rejected by the host filters (-include-net,
+// -exclude-net, -wherehostname, -filter) are not delivered. With -workers, the files are decoded
+// concurrently ahead of their delivery, which keeps the input order.
+func (o *Options) streamInputs(files []string, lenient bool, consumers ...HostConsumer) (failed int, err error) {
+	if o.timing != nil {
+		defer o.timing.streaming(time.Now())
+	}
+	startScan := func(source string) {
+		for _, c := range consumers {
+			if s, ok := c.(ScanStarter); ok {
+				s.StartScan(source)
+			}
+		}
+	}
+	deliver := func(h *Host) error {
+		if o.timing != nil {
+			defer o.timing.delivered(time.Now())
+		}
+		for _, e := range o.enrichers {
+			e.Enrich(h)
+		}
+		if !o.hosts.Match(h) {
+			return nil
+		}
+		for _, c := range consumers {
+			c.Add(h)
+		}
+		return nil
+	}
+	add, flush := deliver, func() {}
+	if o.rdns != nil {
+		p := o.rdns.pipeline(deliver)
+		add, flush = p.Add, func() { p.Flush() }
+	}
+	var merger *nmapparse.Coalescer
+	if o.mergeKey != nil {
+		merger = nmapparse.NewCoalescer(o.mergeKey)
+		startScan(strings.Join(files, ","))
+	}
+	load := func(i int, fn HostHandler, meta MetaHandler) (int, error) { return o.loadScan(files[i], fn, meta) }
+	if o.Workers > 1 && len(files) > 1 {
+		load = o.prefetchScans(files, o.Workers).load
+	}
+	for i, file := range files {
+		if merger == nil {
+			startScan(file)
+		}
+		count, err := load(i, func(h *Host) error {
+			slog.Debug("Host parsed", "addr", h.PrimaryAddr(), "hostnames", len(h.Hostnames), "ports", len(h.Ports))
+			if merger != nil {
+				merger.Add(h)
+				return nil
+			}
+			return add(h)
+		}, func(m *ScanMeta) {
+			flush()
+			for _, c := range consumers {
+				if mc, ok := c.(MetaConsumer); ok {
+					mc.AddMeta(m)
+				}
+			}
+		})
+		flush()
+		if err != nil {
+			if !lenient {
+				return failed, fmt.Errorf("load %s: %w", file, err)
+			}
+			slog.Warn("Skipping unreadable scan", "file", file, "err", err)
+			failed++
+			continue
+		}
+		slog.Info("Scan loaded", "file", file, "hosts", count)
+	}
+	if merger != nil {
+		count, _ := merger.Flush(add)
+		flush()
+		slog.Info("Hosts merged", "inputs", len(files), "hosts", count)
+	}
+	return failed, nil
+}
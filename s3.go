@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ************************************************************************************************
+// s3Config is the destination of the -s3 uploads and the credentials used to sign them.
+type s3Config struct {
+	Bucket string
+	Prefix string
+
+	// Endpoint is the base URL of the S3 API: AWS for the region by default, or a MinIO (or other
+	// S3-compatible) server. Objects are addressed path-style, as /bucket/key.
+	Endpoint string
+	Region   string
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// s3Object is an output uploaded by -s3, named after its -outdir file.
+type s3Object struct {
+	name string
+	body []byte
+}
+
+// ************************************************************************************************
+// s3Options returns the configuration of the -s3 uploads. The credentials come from the standard
+// AWS environment variables (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and, for temporary ones,
+// AWS_SESSION_TOKEN), and the region from -s3-region, AWS_REGION, or us-east-1.
+func (o *Options) s3Options() (s3Config, error) {
+	u, err := url.Parse(o.S3)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return s3Config{}, fmt.Errorf("invalid destination %q, expected s3://bucket/prefix/", o.S3)
+	}
+	cfg := s3Config{
+		Bucket:       u.Host,
+		Prefix:       strings.Trim(u.Path, "/"),
+		Endpoint:     strings.TrimSuffix(o.S3Endpoint, "/"),
+		Region:       o.S3Region,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return s3Config{}, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return cfg, nil
+}
+
+// ************************************************************************************************
+// uploadS3 uploads the objects under "<prefix>/<UTC timestamp>/", so that every run is archived
+// next to the previous ones instead of replacing them.
+func uploadS3(cfg s3Config, objects []s3Object) error {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, obj := range objects {
+		key := path.Join(cfg.Prefix, stamp, obj.name)
+		if err := cfg.put(client, key, obj.body); err != nil {
+			return fmt.Errorf("upload %s: %w", key, err)
+		}
+		slog.Info("Report uploaded", "url", "s3://"+cfg.Bucket+"/"+key, "bytes", len(obj.body))
+	}
+	return nil
+}
+
+// put stores body as the object key of the bucket.
+func (cfg s3Config) put(client *http.Client, key string, body []byte) error {
+	uri := "/" + s3EscapePath(cfg.Bucket+"/"+key)
+	req, err := http.NewRequest(http.MethodPut, cfg.Endpoint+uri, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	now := time.Now().UTC()
+	hash := sha256.Sum256(body)
+	signed := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": hex.EncodeToString(hash[:]),
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	if cfg.SessionToken != "" {
+		signed["x-amz-security-token"] = cfg.SessionToken
+	}
+	for name, value := range signed {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("Authorization", cfg.sign(http.MethodPut, req.URL.EscapedPath(), "", signed, now))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// sign returns the Authorization header of a request, following AWS Signature Version 4: the
+// canonical request (method, path, query, the signed headers given with lowercase names, and the
+// payload hash they include) is hashed and signed with a key derived from the secret, the date,
+// the region and the service.
+func (cfg s3Config) sign(method, uri, query string, headers map[string]string, now time.Time) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	fmt.Fprintf(&canonical, "%s\n%s\n%s\n", method, uri, query)
+	for _, name := range names {
+		fmt.Fprintf(&canonical, "%s:%s\n", name, strings.TrimSpace(headers[name]))
+	}
+	signedHeaders := strings.Join(names, ";")
+	fmt.Fprintf(&canonical, "\n%s\n%s", signedHeaders, headers["x-amz-content-sha256"])
+
+	date := now.Format("20060102")
+	scope := date + "/" + cfg.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + cfg.SecretKey)
+	for _, part := range []string{date, cfg.Region, "s3", "aws4_request", toSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x", cfg.AccessKey, scope, signedHeaders, key)
+}
+
+// ************************************************************************************************
+// s3EscapePath percent-encodes an object path the way S3 signs it: every byte but the unreserved
+// characters and the slashes.
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
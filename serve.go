@@ -0,0 +1,340 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1mm0rt41PC/nmap2csv/pkg/nmapparse"
+)
+
+// maxUpload bounds the size of a scan sent to the -serve upload endpoint.
+const maxUpload = 512 << 20
+
+// serveContentTypes maps the output formats to the Content-Type of the -serve responses.
+var serveContentTypes = map[string]string{
+	formatTable: "text/plain; charset=utf-8",
+	formatCSV:   "text/csv; charset=utf-8",
+	formatJSON:  "application/json",
+	formatJSONL: "application/x-ndjson",
+	formatMD:    "text/markdown; charset=utf-8",
+	formatLLD:   "application/json",
+}
+
+// uploadNameCleaner replaces the characters of an uploaded file name not kept in the stored name.
+var uploadNameCleaner = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ************************************************************************************************
+// apiServer implements -serve: the inputs are parsed once and kept in memory, and every mode is
+// exposed as a REST endpoint named after its -outdir file (/hosts, /ports, /vendors...), computed
+// on demand over the loaded scans. With an uploads directory, new scans can be POSTed to /upload;
+// they are stored there and added to the loaded ones.
+type apiServer struct {
+	o       *Options
+	uploads string
+	token   string
+
+	// parsing serializes the parsing of the uploads, as the enrichers are not safe for concurrent
+	// use; mu only guards scans, so that the requests are not blocked while an upload is parsed.
+	parsing sync.Mutex
+	mu      sync.RWMutex
+	scans   []*apiScan
+}
+
+// apiScan is a loaded input: its hosts, after enrichment and host filtering, and its metadata,
+// replayed to the aggregators of every request.
+type apiScan struct {
+	source string
+	hosts  []*Host
+	metas  []*ScanMeta
+}
+
+// scanCollector is a HostConsumer recording scans as apiScans.
+type scanCollector struct {
+	scans []*apiScan
+}
+
+// StartScan implements ScanStarter.
+func (c *scanCollector) StartScan(source string) {
+	c.scans = append(c.scans, &apiScan{source: source})
+}
+
+// Add implements HostConsumer.
+func (c *scanCollector) Add(h *Host) {
+	s := c.scans[len(c.scans)-1]
+	s.hosts = append(s.hosts, h)
+}
+
+// AddMeta implements MetaConsumer.
+func (c *scanCollector) AddMeta(m *ScanMeta) {
+	s := c.scans[len(c.scans)-1]
+	s.metas = append(s.metas, m)
+}
+
+// ************************************************************************************************
+// serveAPI loads files and serves the API on the -serve address until the server fails. Uploads
+// are only accepted when -serve-uploads names the directory storing them. When the
+// NMAP2CSV_API_TOKEN environment variable is set, every request must carry it as a bearer token;
+// without it, uploads are open to anyone reaching the address and a warning is logged.
+func (o *Options) serveAPI(files []string) error {
+	s := &apiServer{o: o, uploads: o.ServeUploads, token: os.Getenv("NMAP2CSV_API_TOKEN")}
+	if len(files) == 0 && s.uploads == "" {
+		return errors.New("nothing to serve: give scan files, or -serve-uploads to receive them")
+	}
+	if len(files) > 0 {
+		c := &scanCollector{}
+		if _, err := o.streamInputs(files, false, c); err != nil {
+			return err
+		}
+		s.scans = c.scans
+	}
+
+	if s.uploads != "" && s.token == "" {
+		slog.Warn("Uploads are not authenticated, set NMAP2CSV_API_TOKEN to require a token", "addr", o.Serve)
+	}
+	srv := &http.Server{Addr: o.Serve, Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	slog.Info("Serving the API", "addr", o.Serve, "scans", len(s.scans), "uploads", s.uploads, "token", s.token != "")
+	return srv.ListenAndServe()
+}
+
+// handler returns the routes of the API, behind the token check.
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.serveIndex)
+	if s.uploads != "" {
+		mux.HandleFunc("POST /upload", s.serveUpload)
+	}
+	for _, m := range s.modes() {
+		mux.HandleFunc("GET /"+m.File, func(w http.ResponseWriter, r *http.Request) { s.serveMode(w, r, m) })
+	}
+	return s.authorize(mux)
+}
+
+// authorize rejects the requests without the API token, when one is configured.
+func (s *apiServer) authorize(next http.Handler) http.Handler {
+	if s.token == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or invalid API token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// modes returns the modes served: all of them, except the diff, CVE, policy and baseline modes when
+// their older scan, feed, rules or approved pairs were not given, and the delta mode, whose state
+// only moves forward with the runs on the command line.
+func (s *apiServer) modes() []mode {
+	var served []mode
+	for _, m := range modes {
+		if (m.Name == "diff" && s.o.diffBase == nil) || (m.Name == "cve" && s.o.cveFeed == nil) || (m.Name == "policy" && s.o.policy == nil) ||
+			(m.Name == "baseline" && s.o.Baseline == "") || m.Name == "delta" {
+			continue
+		}
+		served = append(served, m)
+	}
+	return served
+}
+
+// serveIndex lists the endpoints and the loaded scans.
+func (s *apiServer) serveIndex(w http.ResponseWriter, r *http.Request) {
+	var index struct {
+		Endpoints []string `json:"endpoints"`
+		Scans     []string `json:"scans"`
+	}
+	for _, m := range s.modes() {
+		index.Endpoints = append(index.Endpoints, "/"+m.File)
+	}
+	if s.uploads != "" {
+		index.Endpoints = append(index.Endpoints, "/upload")
+	}
+	s.mu.RLock()
+	for _, scan := range s.scans {
+		index.Scans = append(index.Scans, scan.source)
+	}
+	s.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(index)
+}
+
+// serveMode answers with the report of mode m over the loaded scans. The query parameters port,
+// service, state, filter, subnet and group play the role of -whereport, -whereservice, -state,
+// -filter, -subnet and -group-by, and format (or an Accept: text/csv header) selects the output
+// format, JSON by default.
+func (s *apiServer) serveMode(w http.ResponseWriter, r *http.Request, m mode) {
+	o, expr, format, err := s.requestOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	agg := m.newAggregator(o)
+	s.mu.RLock()
+	for _, scan := range s.scans {
+		if st, ok := agg.(ScanStarter); ok {
+			st.StartScan(scan.source)
+		}
+		for _, h := range scan.hosts {
+			if expr == nil || expr.Match(h) {
+				agg.Add(h)
+			}
+		}
+		if mc, ok := agg.(MetaConsumer); ok {
+			for _, meta := range scan.metas {
+				mc.AddMeta(meta)
+			}
+		}
+	}
+	s.mu.RUnlock()
+	report := agg.Report()
+	report.RenameHeaders(o.headerMap)
+	w.Header().Set("Content-Type", serveContentTypes[format])
+	if err := report.Write(w, format, o.render); err != nil {
+		slog.Warn("Failed to write the response", "path", r.URL.Path, "err", err)
+	}
+}
+
+// requestOptions returns a copy of the options with the query parameters of r applied, the -filter
+// expression of the request and its output format.
+func (s *apiServer) requestOptions(r *http.Request) (*Options, *hostExpr, string, error) {
+	o := *s.o
+	q := r.URL.Query()
+	if v := q.Get("port"); v != "" {
+		ports, err := o.expandPresets(v)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		o.WherePorts = ports
+	}
+	if v := q.Get("service"); v != "" {
+		o.WhereServices = v
+	}
+	if v := q.Get("state"); v != "" {
+		states, err := nmapparse.ParsePortStates(v)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		o.states = states
+	}
+	if o.subnetBits == 0 {
+		o.subnetBits = 24
+	}
+	if v := q.Get("subnet"); v != "" {
+		bits, err := parseSubnetBits(v)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		o.subnetBits = bits
+	}
+	if o.groupKey.Header == "" {
+		o.groupKey = groupKeys["osfamily"]
+	}
+	if v := q.Get("group"); v != "" {
+		key, ok := groupKeys[strings.ToLower(v)]
+		if !ok {
+			return nil, nil, "", fmt.Errorf("unknown group %q, expected osfamily, devicetype or distance", v)
+		}
+		o.groupKey = key
+	}
+	var expr *hostExpr
+	if v := q.Get("filter"); v != "" {
+		var err error
+		if expr, err = parseHostExpr(v); err != nil {
+			return nil, nil, "", err
+		}
+	}
+	format := strings.ToLower(q.Get("format"))
+	if format == "" {
+		format = formatJSON
+		if accept, _, _ := mime.ParseMediaType(r.Header.Get("Accept")); accept == "text/csv" {
+			format = formatCSV
+		}
+	}
+	if _, ok := serveContentTypes[format]; !ok {
+		return nil, nil, "", fmt.Errorf("unknown format %q, expected json, jsonl, csv, md, table or zabbix", format)
+	}
+	return &o, expr, format, nil
+}
+
+// serveUpload stores the scan sent as the request body, or as the "file" field of a multipart
+// form, and loads it.
+func (s *apiServer) serveUpload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUpload)
+	var body io.Reader = r.Body
+	name := r.URL.Query().Get("name")
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == "multipart/form-data" {
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "multipart upload without a file field: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		body, name = f, header.Filename
+	}
+	name = uploadNameCleaner.ReplaceAllString(filepath.Base(name), "_")
+	if name == "" || name == "." || name == "_" {
+		name = "scan.xml"
+	}
+	path := filepath.Join(s.uploads, time.Now().UTC().Format("20060102T150405.000000000")+"-"+name)
+	if err := saveUpload(path, body); err != nil {
+		http.Error(w, "cannot store the scan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A document without hosts nor scan information is not a scan, even if the parser accepted it.
+	c := &scanCollector{}
+	s.parsing.Lock()
+	failed, _ := s.o.streamInputs([]string{path}, true, c)
+	s.parsing.Unlock()
+	hosts, metas := 0, 0
+	for _, scan := range c.scans {
+		hosts += len(scan.hosts)
+		metas += len(scan.metas)
+	}
+	ok := failed == 0 && hosts+metas > 0
+	if ok {
+		s.mu.Lock()
+		s.scans = append(s.scans, c.scans...)
+		s.mu.Unlock()
+	}
+	if !ok {
+		os.Remove(path)
+		http.Error(w, "not a readable scan", http.StatusBadRequest)
+		return
+	}
+	slog.Info("Scan uploaded", "file", path, "hosts", hosts)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"scan": path, "hosts": hosts})
+}
+
+// saveUpload writes an uploaded scan to path.
+func saveUpload(path string, body io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
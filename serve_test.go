@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ************************************************************************************************
+// TestServeAPI checks the -serve endpoints over testXML.
+func TestServeAPI(t *testing.T) {
+	scan := filepath.Join(t.TempDir(), "scan.xml")
+	if err := os.WriteFile(scan, []byte(testXML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		token   string
+		uploads bool
+		method  string
+		target  string
+		header  map[string]string
+		body    string
+		status  int
+		want    []string
+		notWant []string
+	}{
+		{name: "index", method: "GET", target: "/", status: http.StatusOK, want: []string{`"/hosts"`, `"/web-services"`, scan}, notWant: []string{`"/upload"`, `"/diff"`}},
+		{name: "index with uploads", uploads: true, method: "GET", target: "/", status: http.StatusOK, want: []string{`"/upload"`}},
+		{name: "hosts json", method: "GET", target: "/hosts", status: http.StatusOK, want: []string{`"hostname": "gw.lan"`, `"ipv4": "10.0.0.2"`}},
+		{name: "hosts csv", method: "GET", target: "/hosts?format=csv&port=3389", status: http.StatusOK, want: []string{"Hostname,IPv4", ",10.0.0.2,,,1,3389\n"}, notWant: []string{"gw.lan"}},
+		{name: "accept csv", method: "GET", target: "/ports?state=closed", header: map[string]string{"Accept": "text/csv"}, status: http.StatusOK, want: []string{"1,445/tcp,microsoft-ds,closed"}},
+		{name: "filter", method: "GET", target: "/host-ports?format=csv&filter=vendor+contains+%22Cisco%22&service=ssh", status: http.StatusOK, want: []string{"gw.lan,10.0.0.1,22,tcp,open,ssh"}, notWant: []string{"10.0.0.2"}},
+		{name: "unknown format", method: "GET", target: "/hosts?format=xml", status: http.StatusBadRequest, want: []string{`unknown format "xml"`}},
+		{name: "invalid filter", method: "GET", target: "/hosts?filter=(", status: http.StatusBadRequest},
+		{name: "unknown endpoint", method: "GET", target: "/diff", status: http.StatusNotFound},
+		{name: "missing token", token: "secret", method: "GET", target: "/hosts", status: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", method: "GET", target: "/hosts", header: map[string]string{"Authorization": "Bearer guess"}, status: http.StatusUnauthorized},
+		{name: "token", token: "secret", method: "GET", target: "/hosts", header: map[string]string{"Authorization": "Bearer secret"}, status: http.StatusOK, want: []string{"gw.lan"}},
+		{name: "uploads disabled", method: "POST", target: "/upload", body: testXML, status: http.StatusNotFound},
+		{name: "upload", uploads: true, method: "POST", target: "/upload?name=../new.xml", body: testXML, status: http.StatusCreated, want: []string{`"hosts":2`, "-new.xml"}},
+		{name: "upload not a scan", uploads: true, method: "POST", target: "/upload", body: "hello", status: http.StatusBadRequest, want: []string{"not a readable scan"}},
+		{name: "upload without token", token: "secret", uploads: true, method: "POST", target: "/upload", body: testXML, status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := testOptions(t)
+			s := &apiServer{o: o, token: tt.token}
+			if tt.uploads {
+				s.uploads = t.TempDir()
+			}
+			c := &scanCollector{}
+			if _, err := o.streamInputs([]string{scan}, false, c); err != nil {
+				t.Fatal(err)
+			}
+			s.scans = c.scans
+
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			s.handler().ServeHTTP(w, r)
+			body := w.Body.String()
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, body)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("response lacks %q:\n%s", want, body)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(body, notWant) {
+					t.Errorf("response has %q:\n%s", notWant, body)
+				}
+			}
+		})
+	}
+}
+
+// ************************************************************************************************
+// TestServeUploadAdds checks that an uploaded scan is served along with the loaded ones.
+func TestServeUploadAdds(t *testing.T) {
+	s := &apiServer{o: testOptions(t), uploads: t.TempDir()}
+	h := s.handler()
+	for range 2 {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/upload", strings.NewReader(testXML)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("upload: got status %d: %s", w.Code, w.Body)
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/vendors?format=csv", nil))
+	if want := "Count,VendorName\n2,Cisco\n"; w.Body.String() != want {
+		t.Errorf("got %q, want %q", w.Body.String(), want)
+	}
+	if files, _ := os.ReadDir(s.uploads); len(files) != 2 {
+		t.Errorf("got %d stored uploads, want 2", len(files))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import "fmt"
+
+// ************************************************************************************************
+// hostSink is a HostConsumer sending the hosts to another system (a SIEM, a collector...) instead
+// of an output file. As Add cannot fail, the first error is latched and returned by Close, which
+// also sends what is still buffered.
+type hostSink interface {
+	HostConsumer
+
+	// Close sends the pending data and releases the connection.
+	Close() error
+}
+
+// namedSink is an open sink and the option that requested it, for error messages.
+type namedSink struct {
+	name string
+	sink hostSink
+}
+
+// ************************************************************************************************
+// openSinks connects the sinks requested by the options. On error, the sinks already opened are
+// closed.
+func (o *Options) openSinks() ([]namedSink, error) {
+	var sinks []namedSink
+	add := func(name string, s hostSink, err error) error {
+		if err != nil {
+			for _, open := range sinks {
+				open.sink.Close()
+			}
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		sinks = append(sinks, namedSink{name: name, sink: s})
+		return nil
+	}
+	if o.SplunkHEC != "" {
+		s, err := newHECSink(o.SplunkHEC, o.hecOptions())
+		if err := add("-splunk-hec", s, err); err != nil {
+			return nil, err
+		}
+	}
+	if o.Syslog != "" {
+		s, err := newSyslogSink(o.Syslog, o.SyslogFormat, o.portFilter())
+		if err := add("-syslog", s, err); err != nil {
+			return nil, err
+		}
+	}
+	if o.Kafka != "" {
+		s, err := newKafkaSink(o.Kafka, o.newHostnameAggregator())
+		if err := add("-kafka", s, err); err != nil {
+			return nil, err
+		}
+	}
+	if o.NetBoxURL != "" {
+		s, err := newNetBoxSink(o.netboxOptions())
+		if err := add("-netbox-url", s, err); err != nil {
+			return nil, err
+		}
+	}
+	if o.NotifyURL != "" {
+		s, err := newNotifier(o.NotifyURL, o.NotifyBaseline)
+		if err := add("-notify-url", s, err); err != nil {
+			return nil, err
+		}
+	}
+	if o.ChatWebhook != "" {
+		s, err := newChatSink(o.ChatWebhook, o.ChatFormat, o.diffBase, o.Diff)
+		if err := add("-chat-webhook", s, err); err != nil {
+			return nil, err
+		}
+	}
+	return sinks, nil
+}
+
+// hasSink reports whether the options request a sink.
+func (o *Options) hasSink() bool {
+	return o.SplunkHEC != "" || o.Syslog != "" || o.Kafka != "" || o.NetBoxURL != "" || o.NotifyURL != "" ||
+		o.ChatWebhook != ""
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// spoolFanIn is the number of run files merged at once: when as many runs of the same size are
+// written, they are merged into a larger one, so that a spool never opens more files than that.
+const spoolFanIn = 64
+
+// ************************************************************************************************
+// rowSpool holds the rows of a report too large to be kept in memory (-spill): at most limit rows
+// are buffered, beyond which they are sorted and written as a run to a temporary file. The runs
+// and the buffer are merged back in order every time the rows are read. Rows are sorted by
+// descending keys, in insertion order otherwise, as the in-memory modes sort them.
+type rowSpool struct {
+	limit int
+	buf   []spooledRow
+	runs  []spoolFile
+	count int
+
+	// err is the first error met while spilling, reported when the rows are read.
+	err error
+}
+
+// spoolFile is a run file of a spool. Its level is the number of merges its rows went through.
+type spoolFile struct {
+	path  string
+	level int
+}
+
+// spooledRow is a row of a spool: its sort keys, its cells and its typed record as JSON.
+type spooledRow struct {
+	Keys   []int
+	Seq    int
+	Cells  []string
+	Record json.RawMessage
+}
+
+// newRowSpool creates a spool keeping at most limit rows in memory.
+func newRowSpool(limit int) *rowSpool {
+	return &rowSpool{limit: limit}
+}
+
+// Len returns the number of rows added.
+func (s *rowSpool) Len() int {
+	return s.count
+}
+
+// Add appends a row ranked by keys, with its cells and its typed record for structured outputs.
+func (s *rowSpool) Add(keys []int, cells []string, record any) {
+	if s.err != nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.buf = append(s.buf, spooledRow{Keys: keys, Seq: s.count, Cells: cells, Record: data})
+	s.count++
+	if len(s.buf) >= s.limit {
+		s.err = s.spill()
+	}
+}
+
+// spill writes the sorted buffer to a new run file and empties it, then merges the last runs
+// while spoolFanIn of them have the same level.
+func (s *rowSpool) spill() error {
+	sortSpooled(s.buf)
+	rows := s.buf
+	path, err := writeRun(func(fn func(row *spooledRow) error) error {
+		for i := range rows {
+			if err := fn(&rows[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, spoolFile{path: path})
+	s.buf = s.buf[:0]
+
+	for n := len(s.runs); n >= spoolFanIn && s.runs[n-spoolFanIn].level == s.runs[n-1].level; n = len(s.runs) {
+		tail := s.runs[n-spoolFanIn:]
+		path, err := writeRun(func(fn func(row *spooledRow) error) error { return mergeRuns(tail, nil, fn) })
+		if err != nil {
+			return err
+		}
+		for _, run := range tail {
+			os.Remove(run.path)
+		}
+		s.runs = append(s.runs[:n-spoolFanIn], spoolFile{path: path, level: tail[0].level + 1})
+	}
+	return nil
+}
+
+// writeRun writes the rows given by each to a new temporary file and returns its path.
+func writeRun(each func(fn func(row *spooledRow) error) error) (string, error) {
+	f, err := os.CreateTemp("", "nmap2csv-spill-*")
+	if err != nil {
+		return "", err
+	}
+	w := bufio.NewWriter(f)
+	enc := gob.NewEncoder(w)
+	err = each(func(row *spooledRow) error { return enc.Encode(row) })
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// sortSpooled sorts rows in spool order.
+func sortSpooled(rows []spooledRow) {
+	sort.Slice(rows, func(i, j int) bool { return spooledLess(&rows[i], &rows[j]) })
+}
+
+// spooledLess orders rows by descending keys, then by insertion order.
+func spooledLess(a, b *spooledRow) bool {
+	for i := 0; i < len(a.Keys) && i < len(b.Keys); i++ {
+		if a.Keys[i] != b.Keys[i] {
+			return a.Keys[i] > b.Keys[i]
+		}
+	}
+	return a.Seq < b.Seq
+}
+
+// Each passes every row, in order, to fn, stopping at the first error.
+func (s *rowSpool) Each(fn func(row *spooledRow) error) error {
+	if s.err != nil {
+		return s.err
+	}
+	sortSpooled(s.buf)
+	return mergeRuns(s.runs, s.buf, fn)
+}
+
+// Close removes the run files.
+func (s *rowSpool) Close() {
+	for _, run := range s.runs {
+		os.Remove(run.path)
+	}
+	s.runs = nil
+}
+
+// ************************************************************************************************
+// mergeRuns passes the rows of the run files and of the sorted rows in memory to fn, in spool order.
+func mergeRuns(runs []spoolFile, mem []spooledRow, fn func(row *spooledRow) error) error {
+	merge := &spoolMerge{}
+	defer merge.close()
+	for _, run := range runs {
+		f, err := os.Open(run.path)
+		if err != nil {
+			return err
+		}
+		merge.files = append(merge.files, f)
+		if err := merge.push(&spoolRun{dec: gob.NewDecoder(bufio.NewReader(f))}); err != nil {
+			return err
+		}
+	}
+	if err := merge.push(&spoolRun{mem: mem}); err != nil {
+		return err
+	}
+	for merge.Len() > 0 {
+		run := merge.runs[0]
+		if err := fn(&run.head); err != nil {
+			return err
+		}
+		ok, err := run.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(merge, 0)
+		} else {
+			heap.Pop(merge)
+		}
+	}
+	return nil
+}
+
+// ************************************************************************************************
+// spoolRun is a sorted source of rows being merged: a run file, or the in-memory buffer.
+type spoolRun struct {
+	dec  *gob.Decoder
+	mem  []spooledRow
+	head spooledRow
+}
+
+// next reads the following row of the run into head, false when the run is exhausted.
+func (r *spoolRun) next() (bool, error) {
+	if r.dec == nil {
+		if len(r.mem) == 0 {
+			return false, nil
+		}
+		r.head, r.mem = r.mem[0], r.mem[1:]
+		return true, nil
+	}
+	r.head = spooledRow{}
+	if err := r.dec.Decode(&r.head); errors.Is(err, io.EOF) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// spoolMerge is a heap of runs ordered by their head row.
+type spoolMerge struct {
+	runs  []*spoolRun
+	files []*os.File
+}
+
+func (m *spoolMerge) Len() int           { return len(m.runs) }
+func (m *spoolMerge) Less(i, j int) bool { return spooledLess(&m.runs[i].head, &m.runs[j].head) }
+func (m *spoolMerge) Swap(i, j int)      { m.runs[i], m.runs[j] = m.runs[j], m.runs[i] }
+func (m *spoolMerge) Push(x any)         { m.runs = append(m.runs, x.(*spoolRun)) }
+func (m *spoolMerge) Pop() any {
+	run := m.runs[len(m.runs)-1]
+	m.runs = m.runs[:len(m.runs)-1]
+	return run
+}
+
+// push adds a run to the heap once its first row is read, dropping empty runs.
+func (m *spoolMerge) push(run *spoolRun) error {
+	ok, err := run.next()
+	if err != nil || !ok {
+		return err
+	}
+	heap.Push(m, run)
+	return nil
+}
+
+// close closes the run files.
+func (m *spoolMerge) close() {
+	for _, f := range m.files {
+		f.Close()
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+)
+
+// ************************************************************************************************
+// splitCSVExporter is a HostConsumer writing the scans as linked CSV files in a directory, one per
+// entity, so they can be joined in pandas, Power BI or a database instead of splitting the Ports
+// cell: hosts.csv holds one row per host, ports.csv one row per host/port and services.csv one row
+// per detected service. Rows reference each other through host_id and port_id, as in the -sqlite
+// schema. As Add cannot fail, the first error is latched and returned by Close.
+type splitCSVExporter struct {
+	files          []io.WriteCloser
+	hosts          *csv.Writer
+	ports          *csv.Writer
+	services       *csv.Writer
+	sanitize       bool
+	source         string
+	hostID, portID int
+	err            error
+}
+
+// ************************************************************************************************
+// newSplitCSVExporter creates the three CSV files in dir and writes their headers. Existing files
+// are only replaced when force is set; the files are committed atomically by Close.
+func newSplitCSVExporter(dir string, force bool, opts RenderOptions) (*splitCSVExporter, error) {
+	e := &splitCSVExporter{sanitize: !opts.NoSanitize}
+	var writers []*csv.Writer
+	for _, name := range []string{"hosts.csv", "ports.csv", "services.csv"} {
+		f, err := createOutput(filepath.Join(dir, name), force)
+		if err != nil {
+			e.abort()
+			return nil, err
+		}
+		e.files = append(e.files, f)
+		w := csv.NewWriter(f)
+		if opts.Delimiter != 0 {
+			w.Comma = opts.Delimiter
+		}
+		writers = append(writers, w)
+	}
+	e.hosts, e.ports, e.services = writers[0], writers[1], writers[2]
+	e.write(e.hosts, "host_id", "source", "hostname", "ipv4", "ipv6", "mac", "vendor")
+	e.write(e.ports, "port_id", "host_id", "port", "protocol", "state")
+	e.write(e.services, "port_id", "host_id", "service", "product", "version", "extrainfo")
+	return e, nil
+}
+
+// write adds one record to w, latching the first error.
+func (e *splitCSVExporter) write(w *csv.Writer, cells ...string) {
+	if e.err != nil {
+		return
+	}
+	if e.sanitize {
+		cells = sanitizeCells(cells)
+	}
+	e.err = w.Write(cells)
+}
+
+// StartScan implements ScanStarter: hosts are tagged with the input file they come from.
+func (e *splitCSVExporter) StartScan(source string) {
+	e.source = source
+}
+
+// Add implements HostConsumer.
+func (e *splitCSVExporter) Add(h *Host) {
+	e.hostID++
+	hostID := strconv.Itoa(e.hostID)
+	var hostname, ipv4, ipv6, mac, vendor string
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	for _, a := range h.Addresses {
+		switch a.AddrType {
+		case "ipv4":
+			ipv4 = a.Addr
+		case "ipv6":
+			ipv6 = a.Addr
+		case "mac":
+			mac, vendor = a.Addr, a.Vendor
+		}
+	}
+	e.write(e.hosts, hostID, e.source, hostname, ipv4, ipv6, mac, vendor)
+	for _, p := range h.Ports {
+		e.portID++
+		portID := strconv.Itoa(e.portID)
+		e.write(e.ports, portID, hostID, strconv.Itoa(p.PortID), p.Protocol, p.State.State)
+		if p.Service.Name != "" {
+			e.write(e.services, portID, hostID, p.Service.Name, p.Service.Product, p.Service.Version, p.Service.ExtraInfo)
+		}
+	}
+}
+
+// abort discards every file created so far.
+func (e *splitCSVExporter) abort() {
+	for _, f := range e.files {
+		if af, ok := f.(*atomicFile); ok {
+			af.Abort()
+		}
+	}
+}
+
+// Close flushes and commits the three files, or discards them all when a write failed.
+func (e *splitCSVExporter) Close() error {
+	for _, w := range []*csv.Writer{e.hosts, e.ports, e.services} {
+		if e.err != nil {
+			break
+		}
+		w.Flush()
+		e.err = w.Error()
+	}
+	if e.err != nil {
+		e.abort()
+		return e.err
+	}
+	for _, f := range e.files {
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("commit %s: %w", f.(*atomicFile).path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// stateFile is the name of the snapshot kept in the -state-dir directory.
+const stateFile = "state.json"
+
+// ************************************************************************************************
+// loadState reads the snapshot of the previous run from the -state-dir directory. Before the first
+// run there is none, and the snapshot is empty: every host of the inputs is then new.
+func (o *Options) loadState() (scanSnapshot, error) {
+	path := filepath.Join(o.StateDir, stateFile)
+	snap, err := loadBaseline(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Info("No previous state, every host is new", "dir", o.StateDir)
+		return make(scanSnapshot), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return snap, nil
+}
+
+// ************************************************************************************************
+// saveState replaces the snapshot of the -state-dir directory, created when missing, with the
+// inputs of this run, which the delta mode of the next run (or of the next -watch pass) is
+// compared to.
+func (o *Options) saveState(snap scanSnapshot) error {
+	if err := os.MkdirAll(o.StateDir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(o.StateDir, stateFile)
+	if err := saveBaseline(path, snap); err != nil {
+		return err
+	}
+	o.stateBase = snap
+	slog.Info("State updated", "file", path, "hosts", len(snap))
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// subnetIPv6Bits is the prefix length IPv6 hosts are grouped by in subnet mode.
+const subnetIPv6Bits = 64
+
+// subnetTopServices is the number of services listed in the TopServices column.
+const subnetTopServices = 3
+
+// ************************************************************************************************
+// subnetAggregator implements the subnet mode (-subnet /24).
+// Hosts are grouped by their network prefix (IPv4 hosts with the given prefix length, IPv6 hosts
+// by /64) to show which segments are the most exposed. Rows are sorted by descending number of
+// open ports.
+type subnetAggregator struct {
+	bits    int
+	subnets map[netip.Prefix]*subnetStats
+}
+
+// subnetStats accumulates the hosts of one subnet.
+type subnetStats struct {
+	hosts, open int
+	services    map[string]int
+}
+
+// newSubnetAggregator creates a subnet mode aggregator grouping IPv4 hosts by bits-long prefixes.
+func newSubnetAggregator(bits int) *subnetAggregator {
+	return &subnetAggregator{bits: bits, subnets: make(map[netip.Prefix]*subnetStats)}
+}
+
+// Add implements Aggregator.
+func (a *subnetAggregator) Add(h *Host) {
+	if !h.IsUp() {
+		return
+	}
+	addr, err := netip.ParseAddr(h.IP())
+	if err != nil {
+		return
+	}
+	bits := a.bits
+	if addr.Is6() && !addr.Is4In6() {
+		bits = subnetIPv6Bits
+	}
+	prefix, err := addr.Unmap().Prefix(bits)
+	if err != nil {
+		return
+	}
+	st, ok := a.subnets[prefix]
+	if !ok {
+		st = &subnetStats{services: make(map[string]int)}
+		a.subnets[prefix] = st
+	}
+	st.hosts++
+	for _, p := range h.Ports {
+		if p.State.State == "open" {
+			st.open++
+			if p.Service.Name != "" {
+				st.services[p.Service.Name]++
+			}
+		}
+	}
+}
+
+// Report implements Aggregator.
+func (a *subnetAggregator) Report() *Report {
+	var subnets []SubnetInfo
+	prefixes := make(map[string]netip.Prefix)
+	for prefix, st := range a.subnets {
+		subnets = append(subnets, SubnetInfo{
+			Subnet:      prefix.String(),
+			Hosts:       st.hosts,
+			OpenPorts:   st.open,
+			TopServices: topServices(st.services),
+		})
+		prefixes[prefix.String()] = prefix
+	}
+	sort.Slice(subnets, func(i, j int) bool {
+		if subnets[i].OpenPorts != subnets[j].OpenPorts {
+			return subnets[i].OpenPorts > subnets[j].OpenPorts
+		}
+		return prefixes[subnets[i].Subnet].Addr().Less(prefixes[subnets[j].Subnet].Addr())
+	})
+
+	report := &Report{Headers: []string{"Subnet", "Hosts", "OpenPorts", "TopServices"}, Records: subnets}
+	for _, s := range subnets {
+		report.Rows = append(report.Rows, []string{s.Subnet, fmt.Sprint(s.Hosts), fmt.Sprint(s.OpenPorts), s.TopServices})
+	}
+	return report
+}
+
+// ************************************************************************************************
+// topServices formats the most common services of a subnet as "name(count)" entries.
+func topServices(services map[string]int) string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if services[names[i]] != services[names[j]] {
+			return services[names[i]] > services[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > subnetTopServices {
+		names = names[:subnetTopServices]
+	}
+	for i, name := range names {
+		names[i] = name + "(" + strconv.Itoa(services[name]) + ")"
+	}
+	return strings.Join(names, " ")
+}
+
+// ************************************************************************************************
+// parseSubnetBits parses a -subnet value, "/24" or "24", into an IPv4 prefix length.
+func parseSubnetBits(s string) (int, error) {
+	bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(s), "/"))
+	if err != nil || bits < 0 || bits > 32 {
+		return 0, fmt.Errorf("invalid -subnet %q: expected an IPv4 prefix length such as /24", s)
+	}
+	return bits, nil
+}
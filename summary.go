@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ************************************************************************************************
+// summaryAggregator implements the summary mode (-summary): a one-screen overview of the scans with
+// host and port totals, unique services and vendors, and the scanner information and duration
+// taken from the Nmap XML root element and <runstats>.
+// Nmap only lists down hosts in verbose mode, so the number of down hosts of a document comes from
+// its run statistics when it has some.
+type summaryAggregator struct {
+	scans                  int
+	up, down               int
+	open, filtered, closed int
+	services, vendors      map[string]bool
+	scanners, args         []string
+	start, end             int64
+	elapsed                float64
+	scanUp, scanDown       int
+	scanMeta               *ScanMeta
+}
+
+// newSummaryAggregator creates an empty summary mode aggregator.
+func newSummaryAggregator() *summaryAggregator {
+	return &summaryAggregator{services: make(map[string]bool), vendors: make(map[string]bool)}
+}
+
+// StartScan implements ScanStarter.
+func (a *summaryAggregator) StartScan(source string) {
+	a.flushScan()
+	a.scans++
+}
+
+// flushScan adds the host counters of the current input to the totals.
+func (a *summaryAggregator) flushScan() {
+	down := a.scanDown
+	if a.scanMeta != nil && a.scanMeta.RunStats.Hosts.Total > 0 {
+		down = max(down, a.scanMeta.RunStats.Hosts.Down)
+	}
+	a.up += a.scanUp
+	a.down += down
+	a.scanUp, a.scanDown, a.scanMeta = 0, 0, nil
+}
+
+// Add implements Aggregator.
+func (a *summaryAggregator) Add(h *Host) {
+	if !h.IsUp() {
+		a.scanDown++
+		return
+	}
+	a.scanUp++
+	for _, addr := range h.Addresses {
+		if addr.AddrType == "mac" && addr.Vendor != "" {
+			a.vendors[addr.Vendor] = true
+		}
+	}
+	for _, e := range h.ExtraPorts {
+		switch {
+		case e.State == "closed":
+			a.closed += e.Count
+		case strings.Contains(e.State, "filtered"):
+			a.filtered += e.Count
+		}
+	}
+	for _, p := range h.Ports {
+		switch {
+		case p.State.State == "open":
+			a.open++
+			if p.Service.Name != "" {
+				a.services[p.Service.Name] = true
+			}
+		case p.State.State == "closed":
+			a.closed++
+		case strings.Contains(p.State.State, "filtered"):
+			a.filtered++
+		}
+	}
+}
+
+// AddMeta implements MetaConsumer.
+func (a *summaryAggregator) AddMeta(m *ScanMeta) {
+	a.scanMeta = m
+	if m.Scanner != "" {
+		a.scanners = appendUnique(a.scanners, strings.TrimSpace(m.Scanner+" "+m.Version))
+	}
+	if m.Args != "" {
+		a.args = appendUnique(a.args, m.Args)
+	}
+	if m.Start > 0 && (a.start == 0 || m.Start < a.start) {
+		a.start = m.Start
+	}
+	a.end = max(a.end, m.RunStats.Finished.Time)
+	a.elapsed += m.RunStats.Finished.Elapsed
+}
+
+// appendUnique appends v to list unless it is already present.
+func appendUnique(list []string, v string) []string {
+	for _, e := range list {
+		if e == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// Report implements Aggregator.
+func (a *summaryAggregator) Report() *Report {
+	a.flushScan()
+	metrics := []MetricInfo{
+		{"Scans", fmt.Sprint(a.scans)},
+		{"Scanner", strings.Join(a.scanners, "; ")},
+		{"Arguments", strings.Join(a.args, "; ")},
+		{"Start", formatUnix(a.start)},
+		{"End", formatUnix(a.end)},
+		{"Duration", (time.Duration(a.elapsed * float64(time.Second))).Round(time.Second).String()},
+		{"Hosts up", fmt.Sprint(a.up)},
+		{"Hosts down", fmt.Sprint(a.down)},
+		{"Open ports", fmt.Sprint(a.open)},
+		{"Filtered ports", fmt.Sprint(a.filtered)},
+		{"Closed ports", fmt.Sprint(a.closed)},
+		{"Unique services", fmt.Sprint(len(a.services))},
+		{"Unique vendors", fmt.Sprint(len(a.vendors))},
+	}
+	report := &Report{Headers: []string{"Metric", "Value"}, Records: metrics}
+	for _, m := range metrics {
+		report.Rows = append(report.Rows, []string{m.Name, m.Value})
+	}
+	return report
+}
+
+// ************************************************************************************************
+// formatUnix formats a Unix time for display, or returns "" when it is unknown.
+func formatUnix(t int64) string {
+	if t == 0 {
+		return ""
+	}
+	return time.Unix(t, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslogPriority is the priority of the messages: facility local0, severity informational.
+const syslogPriority = 16*8 + 6
+
+// syslogTimeout bounds the connection and every write to the syslog server.
+const syslogTimeout = 10 * time.Second
+
+// ************************************************************************************************
+// syslogSink implements -syslog: every selected port (open ones by default) is sent as a CEF or
+// LEEF message to a syslog server, for the SIEMs that only ingest syslog. Messages use the
+// BSD syslog header (RFC 3164); over TCP and TLS they are newline-terminated (RFC 6587).
+type syslogSink struct {
+	conn     net.Conn
+	stream   bool
+	format   string
+	hostname string
+	filter   *PortFilter
+	sent     int
+	err      error
+}
+
+// ************************************************************************************************
+// newSyslogSink connects to rawURL, udp://host[:514], tcp://host[:514] or tls://host[:6514], and
+// formats the messages as format, "cef" or "leef".
+func newSyslogSink(rawURL, format string, filter *PortFilter) (*syslogSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q, expected udp://host:514", rawURL)
+	}
+	format = strings.ToLower(format)
+	if format != "cef" && format != "leef" {
+		return nil, fmt.Errorf("unknown -syslog-format %q, expected cef or leef", format)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "514"
+		if u.Scheme == "tls" {
+			port = "6514"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "udp", "tcp":
+		conn, err = dialer.Dial(u.Scheme, addr)
+	case "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unknown scheme %q, expected udp, tcp or tls", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &syslogSink{conn: conn, stream: u.Scheme != "udp", format: format, hostname: hostname, filter: filter}, nil
+}
+
+// Add implements HostConsumer.
+func (s *syslogSink) Add(h *Host) {
+	if !h.IsUp() {
+		return
+	}
+	ip := h.IP()
+	hostname := ""
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	for i := range h.Ports {
+		p := &h.Ports[i]
+		if !s.filter.Selected(p) {
+			continue
+		}
+		var body string
+		if s.format == "leef" {
+			body = leefMessage(ip, hostname, p)
+		} else {
+			body = cefMessage(ip, hostname, p)
+		}
+		s.send(body)
+	}
+}
+
+// send writes one message, latching the first error.
+func (s *syslogSink) send(body string) {
+	if s.err != nil {
+		return
+	}
+	msg := fmt.Sprintf("<%d>%s %s nmap2csv: %s", syslogPriority, time.Now().Format(time.Stamp), s.hostname, body)
+	if s.stream {
+		msg += "\n"
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		s.err = err
+		return
+	}
+	s.sent++
+}
+
+// Close implements hostSink.
+func (s *syslogSink) Close() error {
+	err := s.conn.Close()
+	if s.err != nil {
+		return s.err
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("Syslog messages sent", "server", s.conn.RemoteAddr(), "messages", s.sent)
+	return nil
+}
+
+// ************************************************************************************************
+// cefMessage renders a port as an ArcSight Common Event Format record:
+// CEF:0|nmap2csv|nmap2csv|1.0|port-open|Port open|3|dst=10.0.0.1 dpt=22 proto=TCP app=ssh ...
+func cefMessage(ip, hostname string, p *Port) string {
+	header := []string{"CEF:0", "nmap2csv", "nmap2csv", "1.0", portEventID(p), "Port " + cefHeader(p.State.State), "3"}
+	ext := []string{"dst=" + cefValue(ip), "dpt=" + strconv.Itoa(p.PortID), "proto=" + strings.ToUpper(p.Protocol)}
+	for _, kv := range [][2]string{{"dhost", hostname}, {"app", p.Service.Name}} {
+		if kv[1] != "" {
+			ext = append(ext, kv[0]+"="+cefValue(kv[1]))
+		}
+	}
+	// Product and version go to custom string fields, named by their label.
+	for i, kv := range [][2]string{{"product", p.Service.Product}, {"version", p.Service.Version}} {
+		if kv[1] != "" {
+			ext = append(ext, fmt.Sprintf("cs%dLabel=%s cs%d=%s", i+1, kv[0], i+1, cefValue(kv[1])))
+		}
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(ext, " ")
+}
+
+// cefHeader escapes a CEF header field.
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ", "\r", " ").Replace(s)
+}
+
+// cefValue escapes a CEF extension value.
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+// ************************************************************************************************
+// leefMessage renders a port as an IBM QRadar Log Event Extended Format 1.0 record, whose
+// attributes are tab-separated: LEEF:1.0|nmap2csv|nmap2csv|1.0|port-open|dst=10.0.0.1<tab>dstPort=22...
+func leefMessage(ip, hostname string, p *Port) string {
+	attrs := []string{"cat=port", "dst=" + ip, "dstPort=" + strconv.Itoa(p.PortID), "proto=" + strings.ToUpper(p.Protocol), "state=" + leefValue(p.State.State)}
+	for _, kv := range [][2]string{
+		{"dstHostName", hostname},
+		{"service", p.Service.Name},
+		{"product", p.Service.Product},
+		{"version", p.Service.Version},
+	} {
+		if kv[1] != "" {
+			attrs = append(attrs, kv[0]+"="+leefValue(kv[1]))
+		}
+	}
+	return "LEEF:1.0|nmap2csv|nmap2csv|1.0|" + portEventID(p) + "|" + strings.Join(attrs, "\t")
+}
+
+// portEventID returns the event class of a port message: port-open, port-open-filtered... The
+// header separators, escapes and line breaks a hostile scan may put in the state become dashes.
+func portEventID(p *Port) string {
+	return "port-" + eventIDReplacer.Replace(p.State.State)
+}
+
+// eventIDReplacer replaces the characters not kept in an event class.
+var eventIDReplacer = strings.NewReplacer("|", "-", " ", "-", "\t", "-", "\r", "-", "\n", "-", `\`, "-")
+
+// leefValue removes the attribute separators from a LEEF value.
+func leefValue(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// ************************************************************************************************
+// TestPortMessages checks that the CEF and LEEF messages of a port stay on one line with the
+// expected header, whatever its state and service strings.
+func TestPortMessages(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		svc   string
+		id    string
+		cef   string
+		leef  string
+	}{
+		{"open", "open", "ssh", "port-open",
+			"CEF:0|nmap2csv|nmap2csv|1.0|port-open|Port open|3|dst=10.0.0.1 dpt=22 proto=TCP dhost=gw.lan app=ssh",
+			"LEEF:1.0|nmap2csv|nmap2csv|1.0|port-open|cat=port\tdst=10.0.0.1\tdstPort=22\tproto=TCP\tstate=open\tdstHostName=gw.lan\tservice=ssh"},
+		{"open|filtered", "open|filtered", "", "port-open-filtered",
+			`CEF:0|nmap2csv|nmap2csv|1.0|port-open-filtered|Port open\|filtered|3|dst=10.0.0.1 dpt=22 proto=TCP dhost=gw.lan`,
+			"LEEF:1.0|nmap2csv|nmap2csv|1.0|port-open-filtered|cat=port\tdst=10.0.0.1\tdstPort=22\tproto=TCP\tstate=open|filtered\tdstHostName=gw.lan"},
+		{"line breaks", "open\r\nCEF:0|forged", "a=b\nc", "port-open--CEF:0-forged",
+			`CEF:0|nmap2csv|nmap2csv|1.0|port-open--CEF:0-forged|Port open  CEF:0\|forged|3|dst=10.0.0.1 dpt=22 proto=TCP dhost=gw.lan app=a\=b\nc`,
+			"LEEF:1.0|nmap2csv|nmap2csv|1.0|port-open--CEF:0-forged|cat=port\tdst=10.0.0.1\tdstPort=22\tproto=TCP\tstate=open  CEF:0|forged\tdstHostName=gw.lan\tservice=a=b c"},
+		{"escapes", `open\`, "", "port-open-",
+			`CEF:0|nmap2csv|nmap2csv|1.0|port-open-|Port open\\|3|dst=10.0.0.1 dpt=22 proto=TCP dhost=gw.lan`,
+			"LEEF:1.0|nmap2csv|nmap2csv|1.0|port-open-|cat=port\tdst=10.0.0.1\tdstPort=22\tproto=TCP\tstate=open\\\tdstHostName=gw.lan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Port{PortID: 22, Protocol: "tcp"}
+			p.State.State = tt.state
+			p.Service.Name = tt.svc
+			if got := portEventID(p); got != tt.id {
+				t.Errorf("portEventID = %q, want %q", got, tt.id)
+			}
+			for _, msg := range []struct{ got, want string }{
+				{cefMessage("10.0.0.1", "gw.lan", p), tt.cef},
+				{leefMessage("10.0.0.1", "gw.lan", p), tt.leef},
+			} {
+				if strings.ContainsAny(msg.got, "\r\n") {
+					t.Errorf("message spans several lines: %q", msg.got)
+				}
+				if msg.got != msg.want {
+					t.Errorf("got  %q\nwant %q", msg.got, msg.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// ************************************************************************************************
+// templateData is the value a -template file is executed with.
+type templateData struct {
+	// Mode is the name of the selected mode ("hostname", "port", "vendor", ...), empty when none is
+	// selected.
+	Mode string
+
+	// Report is the report of the selected mode (nil when none is selected). Its Headers and Rows
+	// give generic access to the table, whatever the mode.
+	Report *Report
+
+	// Hosts, Ports and Vendors are the typed rows of the three modes, computed in every case.
+	// Hosts honours -whereport.
+	Hosts   []HostInfo
+	Ports   []PortInfo
+	Vendors []VendorInfo
+}
+
+// ************************************************************************************************
+// newTemplateData assembles the template value from the name and report of the selected mode
+// (empty and nil without one) and the reports of the three main modes.
+func newTemplateData(name string, report, hosts, ports, vendors *Report) *templateData {
+	data := &templateData{Mode: name, Report: report}
+	data.Hosts, _ = hosts.Records.([]HostInfo)
+	data.Ports, _ = ports.Records.([]PortInfo)
+	data.Vendors, _ = vendors.Records.([]VendorInfo)
+	return data
+}
+
+// rowCount returns the number of rows of the selected mode, or of the host list without one.
+func (d *templateData) rowCount() int {
+	if d.Report != nil {
+		return len(d.Report.Rows)
+	}
+	return len(d.Hosts)
+}
+
+// ************************************************************************************************
+// templateFuncs are the helpers available to -template files in addition to the text/template
+// builtins.
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"ints":  joinInts,
+}
+
+// ************************************************************************************************
+// loadTemplate parses a -template file with the helpers of templateFuncs.
+func loadTemplate(path string) (*template.Template, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(filepath.Base(path)).Funcs(templateFuncs).Parse(string(content))
+}
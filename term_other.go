@@ -0,0 +1,32 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// ************************************************************************************************
+// terminal is the controlling terminal of -tui, only available on Unix systems.
+type terminal struct {
+	*os.File
+}
+
+// openTerminal reports that -tui is not supported on this system.
+func openTerminal() (*terminal, error) {
+	return nil, errors.New("-tui needs a Unix terminal")
+}
+
+// Size returns the number of columns and rows of the terminal.
+func (t *terminal) Size() (width, height int) {
+	return 80, 24
+}
+
+// Restore puts the terminal back in its original mode and closes it.
+func (t *terminal) Restore() error {
+	return t.File.Close()
+}
+
+// notifyResize relays the window size changes of the terminal to ch.
+func notifyResize(ch chan<- os.Signal) {}
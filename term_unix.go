@@ -0,0 +1,74 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// ************************************************************************************************
+// terminal is the controlling terminal of the process, in raw mode while -tui runs. It is opened
+// from /dev/tty, so that the scan can still be piped on the standard input.
+type terminal struct {
+	*os.File
+	saved syscall.Termios
+}
+
+// openTerminal opens the controlling terminal and switches it to raw mode: keys are read one by
+// one, without echo nor line editing, and Ctrl-C is read as a key instead of a signal.
+func openTerminal() (*terminal, error) {
+	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	t := &terminal{File: f}
+	if err := ioctl(f, ioctlGetTermios, unsafe.Pointer(&t.saved)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	raw := t.saved
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(f, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Size returns the number of columns and rows of the terminal, 80x24 when unknown.
+func (t *terminal) Size() (width, height int) {
+	var ws struct{ Row, Col, X, Y uint16 }
+	if err := ioctl(t.File, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 80, 24
+	}
+	return int(ws.Col), int(ws.Row)
+}
+
+// Restore puts the terminal back in its original mode and closes it.
+func (t *terminal) Restore() error {
+	err := ioctl(t.File, ioctlSetTermios, unsafe.Pointer(&t.saved))
+	t.File.Close()
+	return err
+}
+
+// notifyResize relays the window size changes of the terminal to ch.
+func notifyResize(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGWINCH)
+}
+
+// ioctl runs an ioctl request on the terminal.
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// ************************************************************************************************
+// trendAggregator implements the trend mode (-trend): given historical scans, it tracks when every
+// host and every open port was first and last seen and in how many scans it was present, turning
+// a directory of dated scans into a timeline of the attack surface.
+// The date of a scan is its Nmap start time, or the modification time of the file when the format
+// has none. Hosts are identified by address.
+type trendAggregator struct {
+	scans []*trendScan
+	cur   *trendScan
+}
+
+// trendScan is what one input contributed to the timeline.
+type trendScan struct {
+	date time.Time
+
+	// seen holds the trend keys (host, or host and port) present in the scan, with their hostname.
+	seen map[trendKey]string
+}
+
+// trendKey identifies a timeline row: a host (empty port) or one open port of a host.
+type trendKey struct {
+	ip, port string
+}
+
+// newTrendAggregator creates an empty trend mode aggregator.
+func newTrendAggregator() *trendAggregator {
+	return &trendAggregator{}
+}
+
+// StartScan implements ScanStarter.
+func (a *trendAggregator) StartScan(source string) {
+	date := time.Now()
+	if fi, err := os.Stat(source); err == nil && source != stdinPath {
+		date = fi.ModTime()
+	}
+	a.cur = &trendScan{date: date, seen: make(map[trendKey]string)}
+	a.scans = append(a.scans, a.cur)
+}
+
+// AddMeta implements MetaConsumer.
+func (a *trendAggregator) AddMeta(m *ScanMeta) {
+	if a.cur != nil && m.Start > 0 {
+		a.cur.date = time.Unix(m.Start, 0)
+	}
+}
+
+// Add implements Aggregator.
+func (a *trendAggregator) Add(h *Host) {
+	if a.cur == nil {
+		a.StartScan(stdinPath)
+	}
+	if !h.IsUp() {
+		return
+	}
+	ip := h.IP()
+	if ip == "" {
+		ip = h.PrimaryAddr()
+	}
+	hostname := ""
+	if len(h.Hostnames) > 0 {
+		hostname = h.Hostnames[0].Name
+	}
+	a.cur.seen[trendKey{ip: ip}] = hostname
+	for _, p := range h.Ports {
+		if p.State.State == "open" {
+			a.cur.seen[trendKey{ip, fmt.Sprintf("%d/%s", p.PortID, p.Protocol)}] = hostname
+		}
+	}
+}
+
+// Report implements Aggregator.
+func (a *trendAggregator) Report() *Report {
+	sort.SliceStable(a.scans, func(i, j int) bool { return a.scans[i].date.Before(a.scans[j].date) })
+
+	rows := make(map[trendKey]*TrendInfo)
+	for i, scan := range a.scans {
+		date := scan.date.UTC().Format(time.RFC3339)
+		for key, hostname := range scan.seen {
+			t, ok := rows[key]
+			if !ok {
+				t = &TrendInfo{IP: key.ip, Port: key.port, FirstSeen: date}
+				rows[key] = t
+			}
+			if hostname != "" {
+				t.Hostname = hostname
+			}
+			t.LastSeen = date
+			t.Scans++
+			t.active = i == len(a.scans)-1
+		}
+	}
+
+	trends := make([]TrendInfo, 0, len(rows))
+	for _, t := range rows {
+		t.Status = "gone"
+		if t.active {
+			t.Status = "active"
+		}
+		trends = append(trends, *t)
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].IP != trends[j].IP {
+			return compareAddrs(trends[i].IP, trends[j].IP)
+		}
+		if trends[i].Port == "" || trends[j].Port == "" {
+			return trends[i].Port == ""
+		}
+		return comparePorts(trends[i].Port, trends[j].Port)
+	})
+
+	report := &Report{Headers: []string{"IP", "Hostname", "Port/Proto", "FirstSeen", "LastSeen", "Scans", "Status"}, Records: trends}
+	for _, t := range trends {
+		report.Rows = append(report.Rows, []string{t.IP, t.Hostname, t.Port, t.FirstSeen, t.LastSeen, fmt.Sprintf("%d/%d", t.Scans, len(a.scans)), t.Status})
+	}
+	return report
+}
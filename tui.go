@@ -0,0 +1,734 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ANSI sequences used by the -tui screen.
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiFaint     = "\x1b[2m"
+	ansiUnderline = "\x1b[4m"
+	ansiReverse   = "\x1b[7m"
+)
+
+// tuiEscapes names the keys sent as escape sequences, by the sequence following "ESC [" or
+// "ESC O".
+var tuiEscapes = map[string]string{
+	"A": "up", "B": "down", "C": "right", "D": "left", "H": "home", "F": "end",
+	"1~": "home", "4~": "end", "7~": "home", "8~": "end", "5~": "pgup", "6~": "pgdown",
+}
+
+// Key help of the status line, when there is no message to show.
+const (
+	tuiTableHelp  = "↑↓ move  ←→ column  s sort  / search  n next  f filter  F expression  Enter details  Tab view  w write CSV  q quit"
+	tuiDetailHelp = "↑↓ scroll  w write CSV  Esc back  Ctrl-C quit"
+)
+
+// ************************************************************************************************
+// tuiTable is a table of the -tui browser. Every row is linked to its host, and the rows shown are
+// the ones kept by the filters, in the selected order.
+type tuiTable struct {
+	name    string
+	headers []string
+	rows    [][]string
+	hosts   []*Host
+
+	// filter keeps the rows with a cell containing it, ignoring case, and expr the rows of the
+	// hosts satisfying the -filter expression exprSrc.
+	filter  string
+	expr    *hostExpr
+	exprSrc string
+
+	// column is the column selected in the header; sortCol is the column the rows are sorted by,
+	// -1 for the scan order.
+	column   int
+	sortCol  int
+	sortDesc bool
+
+	// visible lists the indexes of the rows shown, cursor is the position of the selected one in
+	// visible and top the position of the first one on screen.
+	visible []int
+	cursor  int
+	top     int
+
+	// widths is the width of every column, fitting its header and its visible cells.
+	widths []int
+}
+
+// newTUITable creates an empty table.
+func newTUITable(name string, headers []string) *tuiTable {
+	return &tuiTable{name: name, headers: headers, sortCol: -1}
+}
+
+// add appends the row of host h.
+func (t *tuiTable) add(row []string, h *Host) {
+	t.rows = append(t.rows, row)
+	t.hosts = append(t.hosts, h)
+}
+
+// refresh recomputes the visible rows after a change of the filters or of the order, keeping the
+// selected row when it is still visible.
+func (t *tuiTable) refresh() {
+	selected := -1
+	if t.cursor < len(t.visible) {
+		selected = t.visible[t.cursor]
+	}
+	needle := strings.ToLower(t.filter)
+	t.visible = t.visible[:0]
+	for i, row := range t.rows {
+		if t.expr != nil && !t.expr.Match(t.hosts[i]) {
+			continue
+		}
+		if needle != "" && !tuiRowContains(row, needle) {
+			continue
+		}
+		t.visible = append(t.visible, i)
+	}
+	if t.sortCol >= 0 {
+		sort.SliceStable(t.visible, func(i, j int) bool {
+			a, b := t.rows[t.visible[i]][t.sortCol], t.rows[t.visible[j]][t.sortCol]
+			if t.sortDesc {
+				return tuiLess(b, a)
+			}
+			return tuiLess(a, b)
+		})
+	}
+	t.cursor, t.top = 0, 0
+	for i, r := range t.visible {
+		if r == selected {
+			t.cursor = i
+			break
+		}
+	}
+
+	// The header keeps room for the sort marker.
+	t.widths = make([]int, len(t.headers))
+	for i, h := range t.headers {
+		t.widths[i] = utf8.RuneCountInString(h) + 2
+	}
+	for _, r := range t.visible {
+		for i, cell := range t.rows[r] {
+			t.widths[i] = max(t.widths[i], min(utf8.RuneCountInString(cell), 40))
+		}
+	}
+}
+
+// move moves the cursor by delta rows, within the visible rows.
+func (t *tuiTable) move(delta int) {
+	t.cursor = max(0, min(t.cursor+delta, len(t.visible)-1))
+}
+
+// selectedHost returns the host of the selected row, nil when no row is visible.
+func (t *tuiTable) selectedHost() *Host {
+	if t.cursor >= len(t.visible) {
+		return nil
+	}
+	return t.hosts[t.visible[t.cursor]]
+}
+
+// search moves the cursor to the next visible row, after the selected one and wrapping around,
+// with a cell containing text, ignoring case. It reports whether one was found.
+func (t *tuiTable) search(text string) bool {
+	needle := strings.ToLower(text)
+	for i := 1; i <= len(t.visible); i++ {
+		pos := (t.cursor + i) % len(t.visible)
+		if tuiRowContains(t.rows[t.visible[pos]], needle) {
+			t.cursor = pos
+			return true
+		}
+	}
+	return false
+}
+
+// report returns the visible rows as a report, in their displayed order.
+func (t *tuiTable) report() *Report {
+	r := &Report{Headers: t.headers}
+	for _, i := range t.visible {
+		r.Rows = append(r.Rows, t.rows[i])
+	}
+	return r
+}
+
+// tuiRowContains reports whether a cell of the row contains needle, in lowercase.
+func tuiRowContains(row []string, needle string) bool {
+	for _, cell := range row {
+		if strings.Contains(strings.ToLower(cell), needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// tuiLess orders cells numerically when both are numbers or addresses, as text ignoring case
+// otherwise.
+func tuiLess(a, b string) bool {
+	na, errA := strconv.ParseFloat(a, 64)
+	nb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		return na < nb
+	}
+	ia, errA := netip.ParseAddr(a)
+	ib, errB := netip.ParseAddr(b)
+	if errA == nil && errB == nil {
+		return ia.Less(ib)
+	}
+	return strings.ToLower(a) < strings.ToLower(b)
+}
+
+// ************************************************************************************************
+// tuiDetail is the detail page of a host: its addresses, OS, ports and script results.
+type tuiDetail struct {
+	title string
+	lines []string
+	top   int
+
+	// ports is the port table of the page, written by the CSV export.
+	ports *Report
+	file  string
+}
+
+// newTUIDetail creates the detail page of h.
+func newTUIDetail(h *Host) *tuiDetail {
+	ip := h.IP()
+	if ip == "" {
+		ip = h.PrimaryAddr()
+	}
+	d := &tuiDetail{title: ip, file: strings.ReplaceAll(ip, ":", "_") + ".csv"}
+	var names []string
+	for _, n := range h.Hostnames {
+		names = append(names, n.Name)
+	}
+	if len(names) > 0 {
+		d.title += " (" + names[0] + ")"
+	}
+
+	field := func(name, value string) {
+		if value != "" {
+			d.lines = append(d.lines, fmt.Sprintf("%-12s%s", name, value))
+		}
+	}
+	for _, a := range h.Addresses {
+		addr := a.Addr + " (" + a.AddrType
+		if a.Vendor != "" {
+			addr += ", " + a.Vendor
+		}
+		field("Address", addr+")")
+	}
+	field("Hostnames", strings.Join(names, ", "))
+	if h.Status != nil {
+		field("Status", h.Status.State)
+	}
+	if m := h.BestOSMatch(); m != nil {
+		field("OS", fmt.Sprintf("%s (%d%%)", m.Name, m.Accuracy))
+	}
+	field("Device type", h.DeviceType)
+	if h.Geo != nil {
+		field("Location", strings.Trim(h.Geo.City+", "+h.Geo.Country, ", "))
+	}
+	if h.Risk != nil {
+		field("Risk", fmt.Sprintf("%d %s", h.Risk.Score, strings.Join(h.Risk.Factors, ", ")))
+	}
+
+	d.ports = &Report{Headers: []string{"Port/Proto", "State", "Service", "Product", "Version", "ExtraInfo"}}
+	for _, p := range h.Ports {
+		d.ports.Rows = append(d.ports.Rows, []string{
+			fmt.Sprintf("%d/%s", p.PortID, p.Protocol), p.State.State, p.Service.Name, p.Service.Product, p.Service.Version, p.Service.ExtraInfo,
+		})
+	}
+	if len(d.ports.Rows) > 0 {
+		var buf bytes.Buffer
+		d.ports.WriteTable(&buf, RenderOptions{})
+		d.lines = append(d.lines, "")
+		d.lines = append(d.lines, strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")...)
+	}
+
+	script := func(target string, s Script) {
+		d.lines = append(d.lines, "", target+" "+s.ID)
+		for _, line := range strings.Split(strings.TrimSpace(s.Output), "\n") {
+			d.lines = append(d.lines, "    "+strings.TrimRight(line, " \r"))
+		}
+	}
+	for _, p := range h.Ports {
+		for _, s := range p.Scripts {
+			script(fmt.Sprintf("%d/%s", p.PortID, p.Protocol), s)
+		}
+	}
+	for _, s := range h.Scripts {
+		script("host", s)
+	}
+	return d
+}
+
+// ************************************************************************************************
+// tuiBrowser is the state of the -tui screen: the tables of the scans, and the detail page and the
+// prompt when one is open.
+type tuiBrowser struct {
+	o      *Options
+	out    *bufio.Writer
+	width  int
+	height int
+
+	tables []*tuiTable
+	table  int
+	detail *tuiDetail
+	prompt *tuiPrompt
+
+	// search is the text of the last search, repeated by n; status is the message of the last
+	// action, shown instead of the key help.
+	search string
+	status string
+	quit   bool
+}
+
+// tuiPrompt is a line of text being typed in the status line, passed to done once confirmed.
+type tuiPrompt struct {
+	label string
+	text  []rune
+	done  func(text string)
+}
+
+// ************************************************************************************************
+// runTUI loads the inputs and lets the user browse them interactively: a hosts table, with the
+// hostname mode columns, and a ports table, one row per selected port, which can be sorted,
+// filtered and searched; the detail page of a host shows all its ports and script results, and the
+// current view can be written to a CSV file.
+func (o *Options) runTUI(files []string) error {
+	scans := &scanCollector{}
+	if _, err := o.streamInputs(files, false, scans); err != nil {
+		return err
+	}
+
+	agg := o.newHostnameAggregator()
+	filter := o.portFilter()
+	hosts := newTUITable("Hosts", agg.headers())
+	ports := newTUITable("Ports", []string{"Hostname", "IP", "Port", "Proto", "State", "Service", "Product", "Version"})
+	for _, s := range scans.scans {
+		for _, h := range s.hosts {
+			if info, ok := agg.hostInfo(h); ok {
+				hosts.add(agg.row(info), h)
+			}
+			hostname := ""
+			if len(h.Hostnames) > 0 {
+				hostname = h.Hostnames[0].Name
+			}
+			for i := range h.Ports {
+				p := &h.Ports[i]
+				if filter.Selected(p) {
+					ports.add([]string{hostname, h.IP(), strconv.Itoa(p.PortID), p.Protocol, p.State.State, p.Service.Name, p.Service.Product, p.Service.Version}, h)
+				}
+			}
+		}
+	}
+	b := &tuiBrowser{o: o, tables: []*tuiTable{hosts, ports}}
+	for _, t := range b.tables {
+		(&Report{Headers: t.headers}).RenameHeaders(o.headerMap)
+		t.refresh()
+	}
+
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.Restore()
+	return b.run(term)
+}
+
+// run shows the browser on the terminal until the user quits.
+func (b *tuiBrowser) run(term *terminal) error {
+	b.out = bufio.NewWriter(term)
+	keys := make(chan []string)
+	failed := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := term.Read(buf)
+			if err != nil {
+				failed <- err
+				return
+			}
+			keys <- tuiKeys(buf[:n])
+		}
+	}()
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	defer signal.Stop(resized)
+
+	// The alternate screen keeps the shell output intact.
+	fmt.Fprint(b.out, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(b.out, "\x1b[?25h\x1b[?1049l")
+		b.out.Flush()
+	}()
+	for !b.quit {
+		b.width, b.height = term.Size()
+		b.draw()
+		if err := b.out.Flush(); err != nil {
+			return err
+		}
+		select {
+		case ks := <-keys:
+			for _, k := range ks {
+				if b.handle(k); b.quit {
+					break
+				}
+			}
+		case <-resized:
+		case err := <-failed:
+			return err
+		}
+	}
+	return nil
+}
+
+// tuiKeys splits the bytes read from the terminal into key names: "up", "enter", "esc"... for the
+// special keys, the character itself for the others.
+func tuiKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		switch c := b[0]; {
+		case c == 0x1b && len(b) >= 3 && (b[1] == '[' || b[1] == 'O'):
+			end := 2
+			for end < len(b) && (b[end] < 0x40 || b[end] > 0x7e) {
+				end++
+			}
+			if end == len(b) {
+				end--
+			}
+			if k, ok := tuiEscapes[string(b[2:end+1])]; ok {
+				keys = append(keys, k)
+			}
+			b = b[end+1:]
+			continue
+		case c == 0x1b:
+			keys = append(keys, "esc")
+		case c == '\r' || c == '\n':
+			keys = append(keys, "enter")
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, "backspace")
+		case c == '\t':
+			keys = append(keys, "tab")
+		case c == 0x03:
+			keys = append(keys, "ctrl-c")
+		case c >= 0x20:
+			r, size := utf8.DecodeRune(b)
+			keys = append(keys, string(r))
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// handle applies a key.
+func (b *tuiBrowser) handle(key string) {
+	if b.prompt != nil {
+		b.handlePrompt(key)
+		return
+	}
+	b.status = ""
+	if key == "ctrl-c" {
+		b.quit = true
+		return
+	}
+	if b.detail != nil {
+		b.handleDetail(key)
+		return
+	}
+
+	t := b.tables[b.table]
+	page := max(1, b.height-3)
+	switch key {
+	case "q":
+		b.quit = true
+	case "up", "k":
+		t.move(-1)
+	case "down", "j":
+		t.move(1)
+	case "pgup":
+		t.move(-page)
+	case "pgdown":
+		t.move(page)
+	case "home", "g":
+		t.move(-len(t.visible))
+	case "end", "G":
+		t.move(len(t.visible))
+	case "left":
+		t.column = max(0, t.column-1)
+	case "right":
+		t.column = min(len(t.headers)-1, t.column+1)
+	case "s":
+		if t.sortCol == t.column {
+			t.sortDesc = !t.sortDesc
+		} else {
+			t.sortCol, t.sortDesc = t.column, false
+		}
+		t.refresh()
+	case "tab":
+		b.table = (b.table + 1) % len(b.tables)
+	case "/":
+		b.ask("Search: ", b.search, func(text string) {
+			b.search = text
+			b.findNext()
+		})
+	case "n":
+		b.findNext()
+	case "f":
+		b.ask("Filter: ", t.filter, func(text string) {
+			t.filter = text
+			t.refresh()
+		})
+	case "F":
+		b.ask("Filter expression: ", t.exprSrc, func(text string) {
+			var expr *hostExpr
+			if text != "" {
+				var err error
+				if expr, err = parseHostExpr(text); err != nil {
+					b.status = "Invalid expression: " + err.Error()
+					return
+				}
+			}
+			t.expr, t.exprSrc = expr, text
+			t.refresh()
+		})
+	case "enter":
+		if h := t.selectedHost(); h != nil {
+			b.detail = newTUIDetail(h)
+		}
+	case "w":
+		b.ask("Write CSV to: ", strings.ToLower(t.name)+".csv", func(path string) {
+			b.export(path, t.report())
+		})
+	}
+}
+
+// handleDetail applies a key to the detail page.
+func (b *tuiBrowser) handleDetail(key string) {
+	d := b.detail
+	page := max(1, b.height-2)
+	last := max(0, len(d.lines)-page)
+	switch key {
+	case "esc", "backspace", "left", "q":
+		b.detail = nil
+	case "up", "k":
+		d.top = max(0, d.top-1)
+	case "down", "j":
+		d.top = min(last, d.top+1)
+	case "pgup":
+		d.top = max(0, d.top-page)
+	case "pgdown":
+		d.top = min(last, d.top+page)
+	case "home", "g":
+		d.top = 0
+	case "end", "G":
+		d.top = last
+	case "w":
+		b.ask("Write CSV to: ", d.file, func(path string) {
+			b.export(path, d.ports)
+		})
+	}
+}
+
+// ask opens a prompt in the status line, prefilled with text.
+func (b *tuiBrowser) ask(label, text string, done func(text string)) {
+	b.prompt = &tuiPrompt{label: label, text: []rune(text), done: done}
+}
+
+// handlePrompt applies a key to the open prompt: Enter confirms it and Esc cancels it.
+func (b *tuiBrowser) handlePrompt(key string) {
+	p := b.prompt
+	switch key {
+	case "enter":
+		b.prompt = nil
+		p.done(strings.TrimSpace(string(p.text)))
+	case "esc", "ctrl-c":
+		b.prompt = nil
+	case "backspace":
+		if len(p.text) > 0 {
+			p.text = p.text[:len(p.text)-1]
+		}
+	default:
+		if utf8.RuneCountInString(key) == 1 {
+			p.text = append(p.text, []rune(key)...)
+		}
+	}
+}
+
+// findNext selects the next row matching the last search.
+func (b *tuiBrowser) findNext() {
+	if b.search == "" {
+		return
+	}
+	if !b.tables[b.table].search(b.search) {
+		b.status = fmt.Sprintf("No row contains %q", b.search)
+	}
+}
+
+// export writes the report to a CSV file, honoring -delimiter, -excel and -force.
+func (b *tuiBrowser) export(path string, r *Report) {
+	if path == "" {
+		return
+	}
+	if err := writeOutput(path, b.o.Force, func(w io.Writer) error { return r.WriteCSV(w, b.o.render) }); err != nil {
+		b.status = "Write failed: " + err.Error()
+		return
+	}
+	b.status = fmt.Sprintf("%d rows written to %s", len(r.Rows), path)
+}
+
+// ************************************************************************************************
+// draw renders the whole screen: the title bar, the table or the detail page, and the status line.
+func (b *tuiBrowser) draw() {
+	if b.detail != nil {
+		d := b.detail
+		b.line(1, ansiReverse, fmt.Sprintf(" nmap2csv  Host %s  %d/%d", d.title, min(d.top+b.height-2, len(d.lines)), len(d.lines)))
+		for row := 2; row < b.height; row++ {
+			text := ""
+			if i := d.top + row - 2; i < len(d.lines) {
+				text = " " + d.lines[i]
+			}
+			b.line(row, "", text)
+		}
+		b.drawStatus(tuiDetailHelp)
+		return
+	}
+
+	t := b.tables[b.table]
+	title := " nmap2csv "
+	for i, tt := range b.tables {
+		tab := fmt.Sprintf(" %s %d/%d ", tt.name, len(tt.visible), len(tt.rows))
+		if i == b.table {
+			tab = "[" + tab[1:len(tab)-1] + "]"
+		}
+		title += " " + tab
+	}
+	if t.filter != "" {
+		title += fmt.Sprintf("  filter: %q", t.filter)
+	}
+	if t.exprSrc != "" {
+		title += "  expression: " + t.exprSrc
+	}
+	b.line(1, ansiReverse, title)
+
+	widths := b.fitColumns(t.widths)
+	var header strings.Builder
+	header.WriteString(ansiBold + " ")
+	for i, h := range t.headers {
+		if t.sortCol == i {
+			h += map[bool]string{false: " ▲", true: " ▼"}[t.sortDesc]
+		}
+		if i == t.column {
+			header.WriteString(ansiUnderline + tuiPad(h, widths[i]) + ansiReset + ansiBold)
+		} else {
+			header.WriteString(tuiPad(h, widths[i]))
+		}
+		header.WriteString("  ")
+	}
+	b.raw(2, header.String())
+
+	page := max(1, b.height-3)
+	if t.cursor < t.top {
+		t.top = t.cursor
+	}
+	if t.cursor >= t.top+page {
+		t.top = t.cursor - page + 1
+	}
+	for row := 3; row < b.height; row++ {
+		i := t.top + row - 3
+		if i >= len(t.visible) {
+			text := ""
+			if i == 0 {
+				text = " No row matches the filters"
+			}
+			b.line(row, ansiFaint, text)
+			continue
+		}
+		cells := make([]string, len(widths))
+		for c, cell := range t.rows[t.visible[i]] {
+			cells[c] = tuiPad(cell, widths[c])
+		}
+		style := ""
+		if i == t.cursor {
+			style = ansiReverse
+		}
+		b.line(row, style, " "+strings.Join(cells, "  "))
+	}
+	b.drawStatus(tuiTableHelp)
+}
+
+// drawStatus renders the status line: the prompt, the last message, or the key help.
+func (b *tuiBrowser) drawStatus(help string) {
+	switch {
+	case b.prompt != nil:
+		b.line(b.height, ansiBold, " "+b.prompt.label+string(b.prompt.text)+"█")
+	case b.status != "":
+		b.line(b.height, ansiBold, " "+b.status)
+	default:
+		b.line(b.height, ansiFaint, " "+help)
+	}
+}
+
+// fitColumns shrinks the widest columns until the table fits the screen.
+func (b *tuiBrowser) fitColumns(widths []int) []int {
+	fitted := append([]int(nil), widths...)
+	total := 1 + 2*len(fitted)
+	for _, w := range fitted {
+		total += w
+	}
+	for total > b.width {
+		widest := 0
+		for i, w := range fitted {
+			if w > fitted[widest] {
+				widest = i
+			}
+		}
+		if fitted[widest] <= 3 {
+			break
+		}
+		fitted[widest]--
+		total--
+	}
+	return fitted
+}
+
+// line renders a screen row with the given style, cut or padded to the screen width.
+func (b *tuiBrowser) line(row int, style, text string) {
+	b.raw(row, style+tuiPad(text, b.width)+ansiReset)
+}
+
+// raw writes an already formatted screen row; the rest of the row is cleared.
+func (b *tuiBrowser) raw(row int, text string) {
+	fmt.Fprintf(b.out, "\x1b[%d;1H%s\x1b[K"+ansiReset, row, text)
+}
+
+// tuiPad cuts s to width characters, marking the cut with an ellipsis, or pads it with spaces.
+// Control characters are shown as spaces.
+func tuiPad(s string, width int) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+	n := utf8.RuneCountInString(s)
+	switch {
+	case n > width && width > 0:
+		return string([]rune(s)[:width-1]) + "…"
+	case n > width:
+		return ""
+	}
+	return s + strings.Repeat(" ", width-n)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/1mm0rt41PC/nmap2csv/pkg/nmapparse"
+)
+
+// Validation statuses of a scan file, from the best to the worst.
+const (
+	validOK      = "ok"
+	validWarning = "warning"
+	validInvalid = "invalid"
+)
+
+// ************************************************************************************************
+// scanValidator reads one scan file for -validate, counting its hosts and ports and noting its
+// anomalies instead of aggregating it.
+type scanValidator struct {
+	info ValidationInfo
+
+	// versioned is set once an open port carries version detection results.
+	versioned bool
+}
+
+// Add implements HostConsumer.
+func (v *scanValidator) Add(h *Host) {
+	v.info.Hosts++
+	if !h.IsUp() {
+		return
+	}
+	v.info.Up++
+	for i := range h.Ports {
+		p := &h.Ports[i]
+		if p.State.State != "open" {
+			continue
+		}
+		v.info.OpenPorts++
+		if p.Service.Product != "" || p.Service.Version != "" {
+			v.versioned = true
+		}
+	}
+}
+
+// AddMeta implements MetaConsumer.
+func (v *scanValidator) AddMeta(m *ScanMeta) {
+	v.info.Scanner = strings.TrimSpace(m.Scanner + " " + m.Version)
+	v.info.Args = m.Args
+}
+
+// anomaly records a problem of the file, raising its status to at least status.
+func (v *scanValidator) anomaly(status, text string) {
+	if status == validInvalid || v.info.Status == validOK {
+		v.info.Status = status
+	}
+	v.info.Anomalies = append(v.info.Anomalies, text)
+}
+
+// ************************************************************************************************
+// validateScan reads path and returns its validation result. Truncated files are read up to their
+// last complete host whatever -lenient, so that their content is reported too.
+func (o *Options) validateScan(path string) ValidationInfo {
+	v := &scanValidator{info: ValidationInfo{File: path, Status: validOK}}
+	strict := *o
+	strict.Lenient = false
+	_, err := strict.loadScan(path, func(h *Host) error {
+		v.Add(h)
+		return nil
+	}, v.AddMeta)
+	switch {
+	case errors.Is(err, nmapparse.ErrTruncated):
+		v.anomaly(validInvalid, "truncated")
+	case err != nil:
+		v.anomaly(validInvalid, err.Error())
+		return v.info
+	}
+	if v.info.Hosts == 0 && v.info.Scanner == "" {
+		v.anomaly(validInvalid, "no scan data")
+	} else if v.info.Up == 0 {
+		v.anomaly(validWarning, "no host up")
+	} else if v.info.OpenPorts > 0 && !v.versioned {
+		v.anomaly(validWarning, "no service version detection")
+	}
+	return v.info
+}
+
+// ************************************************************************************************
+// runValidate runs -validate over the inputs given by patterns: every file is parsed and reported
+// on one row, in the output format of the options, instead of producing the reports. It returns the
+// exit code: 1 when a file is invalid (unparseable, truncated or empty), 0 otherwise, anomalies such
+// as a scan without host up only being reported.
+func (o *Options) runValidate(patterns []string) int {
+	files, err := expandInputs(patterns)
+	if err != nil {
+		slog.Error("Invalid input files", "err", err)
+		return 1
+	}
+	code := 0
+	var infos []ValidationInfo
+	for _, file := range files {
+		info := o.validateScan(file)
+		if info.Status == validInvalid {
+			code = 1
+		}
+		infos = append(infos, info)
+	}
+
+	report := &Report{Headers: []string{"File", "Status", "Scanner", "Args", "Hosts", "Up", "OpenPorts", "Anomalies"}, Records: infos}
+	for _, v := range infos {
+		report.Rows = append(report.Rows, []string{v.File, v.Status, v.Scanner, v.Args, strconv.Itoa(v.Hosts), strconv.Itoa(v.Up), strconv.Itoa(v.OpenPorts), strings.Join(v.Anomalies, "; ")})
+	}
+	report.RenameHeaders(o.headerMap)
+	if err := report.Write(o.out(), o.format(), o.render); err != nil {
+		slog.Error("Failed to write results", "err", err)
+		return 1
+	}
+	return code
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ************************************************************************************************
+// fileStamp is the modification time and size of a watched file, used to detect changes.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// ************************************************************************************************
+// watchDirectory polls dir every interval and calls run with the sorted list of its regular files
+// whenever that list or any of the files changed. A change is only acted upon once the directory
+// has been stable for a whole interval, so files still being written by a scanner are not parsed
+// half-way. Errors returned by run are logged and watching goes on; watchDirectory only returns
+// when the directory itself cannot be read.
+func watchDirectory(dir string, interval time.Duration, run func(files []string) error) error {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	slog.Info("Watching directory", "dir", dir, "interval", interval)
+
+	var processed, previous map[string]fileStamp
+	for {
+		current, err := snapshotDir(dir)
+		if err != nil {
+			return err
+		}
+		stable := previous != nil && maps.Equal(current, previous)
+		if stable && !maps.Equal(current, processed) {
+			files := make([]string, 0, len(current))
+			for path := range current {
+				files = append(files, path)
+			}
+			sort.Strings(files)
+			slog.Info("Directory changed, regenerating report", "dir", dir, "files", len(files))
+			if err := run(files); err != nil {
+				slog.Error("Report generation failed", "dir", dir, "err", err)
+			}
+			processed = current
+		}
+		previous = current
+		time.Sleep(interval)
+	}
+}
+
+// ************************************************************************************************
+// snapshotDir returns the stamp of every regular, non-hidden file directly inside dir.
+func snapshotDir(dir string) (map[string]fileStamp, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	snap := make(map[string]fileStamp, len(entries))
+	for _, e := range entries {
+		if !e.Type().IsRegular() || e.Name()[0] == '.' {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		snap[filepath.Join(dir, e.Name())] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return snap, nil
+}
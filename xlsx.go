@@ -0,0 +1,198 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ************************************************************************************************
+// xlsxSheet is one worksheet of an exported workbook.
+type xlsxSheet struct {
+	// Name is the tab name (31 characters at most, no []:*?/\).
+	Name string
+
+	// Report holds the header and rows written to the sheet.
+	Report *Report
+}
+
+// ************************************************************************************************
+// writeXLSX writes the sheets to path as an Office Open XML workbook.
+// The workbook is generated with the standard library only: every sheet gets a bold, frozen header
+// row and an auto-filter, and columns whose cells are all integers are stored as numbers so that
+// Excel sorts and sums them correctly, while IPs, MACs and port lists stay text.
+func writeXLSX(path string, sheets []xlsxSheet) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+
+	add := func(name, content string) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(content))
+		return err
+	}
+
+	var contentTypes, workbookSheets, workbookRels, definedNames strings.Builder
+	for i, sheet := range sheets {
+		n := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbookSheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.Name), n, n)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		fmt.Fprintf(&definedNames, `<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">'%s'!%s</definedName>`, i, xmlEscape(sheet.Name), xlsxRange(sheet.Report, true))
+	}
+	stylesID := len(sheets) + 1
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			contentTypes.String() + `</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + workbookSheets.String() + `</sheets>` +
+			`<definedNames>` + definedNames.String() + `</definedNames></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			workbookRels.String() +
+			fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, stylesID) +
+			`</Relationships>`},
+		{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+	for i, sheet := range sheets {
+		parts = append(parts, struct{ name, content string }{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxSheetXML(sheet.Report)})
+	}
+
+	for _, p := range parts {
+		if err := add(p.name, p.content); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ************************************************************************************************
+// xlsxSheetXML renders the worksheet part for a report.
+func xlsxSheetXML(r *Report) string {
+	numeric := numericColumns(r)
+	widths := make([]int, len(r.Headers))
+	for i, h := range r.Headers {
+		widths[i] = len(h)
+	}
+	for _, row := range r.Rows {
+		for i, c := range row {
+			if i < len(widths) && len(c) > widths[i] {
+				widths[i] = len(c)
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	b.WriteString(`<cols>`)
+	for i, w := range widths {
+		fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, min(w, 80)+2)
+	}
+	b.WriteString(`</cols><sheetData>`)
+
+	writeRow := func(n int, cells []string, header bool) {
+		fmt.Fprintf(&b, `<row r="%d">`, n)
+		for i, c := range cells {
+			ref := xlsxColumn(i) + strconv.Itoa(n)
+			switch {
+			case header:
+				fmt.Fprintf(&b, `<c r="%s" s="1" t="inlineStr"><is><t>%s</t></is></c>`, ref, xmlEscape(c))
+			case c == "":
+				continue
+			case i < len(numeric) && numeric[i]:
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, c)
+			default:
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(c))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	writeRow(1, r.Headers, true)
+	for i, row := range r.Rows {
+		writeRow(i+2, row, false)
+	}
+	b.WriteString(`</sheetData>`)
+	fmt.Fprintf(&b, `<autoFilter ref="%s"/>`, xlsxRange(r, false))
+	b.WriteString(`</worksheet>`)
+	return b.String()
+}
+
+// ************************************************************************************************
+// numericColumns reports, for each column of the report, whether every non-empty cell is an
+// integer without leading zeros, in which case the column is stored as numbers.
+func numericColumns(r *Report) []bool {
+	numeric := make([]bool, len(r.Headers))
+	for i := range numeric {
+		numeric[i] = len(r.Rows) > 0
+	}
+	for _, row := range r.Rows {
+		for i, c := range row {
+			if i >= len(numeric) || !numeric[i] || c == "" {
+				continue
+			}
+			if _, err := strconv.ParseInt(c, 10, 64); err != nil || (len(c) > 1 && c[0] == '0') {
+				numeric[i] = false
+			}
+		}
+	}
+	return numeric
+}
+
+// ************************************************************************************************
+// xlsxRange returns the cell range covering the header and every row of the report, e.g. "A1:F42",
+// with absolute references ("$A$1:$F$42") when absolute is set.
+func xlsxRange(r *Report, absolute bool) string {
+	last := xlsxColumn(max(len(r.Headers)-1, 0))
+	rows := strconv.Itoa(len(r.Rows) + 1)
+	if absolute {
+		return "$A$1:$" + last + "$" + rows
+	}
+	return "A1:" + last + rows
+}
+
+// ************************************************************************************************
+// xlsxColumn converts a zero-based column index to its spreadsheet letters (0 → A, 26 → AA).
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// ************************************************************************************************
+// xmlEscape escapes s for use in XML text and attribute values.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
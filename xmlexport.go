@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ************************************************************************************************
+// xmlExporter is a HostConsumer re-exporting the hosts matching the -whereport filter as a new
+// Nmap XML document, so a trimmed-down scan can be fed to tools that only understand Nmap XML.
+// Only the open ports selected by the filter are kept, and hosts without any are dropped. The
+// document holds the fields nmap2csv parses; anything else of the original scan is not carried over.
+type xmlExporter struct {
+	f      *os.File
+	w      *bufio.Writer
+	enc    *xml.Encoder
+	filter *PortFilter
+	hosts  int
+	err    error
+}
+
+// ************************************************************************************************
+// newXMLExporter creates path and writes the document prologue and <nmaprun> root element.
+func newXMLExporter(path string, filter *PortFilter) (*xmlExporter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &xmlExporter{f: f, w: bufio.NewWriter(f), filter: filter}
+	now := time.Now()
+	fmt.Fprintf(e.w, "%s<!DOCTYPE nmaprun>\n", xml.Header)
+	fmt.Fprintf(e.w, "<nmaprun scanner=\"nmap\" args=\"%s\" start=\"%d\" startstr=\"%s\" xmloutputversion=\"1.05\">\n",
+		xmlEscape(strings.Join(os.Args, " ")), now.Unix(), xmlEscape(now.Format(time.ANSIC)))
+	e.enc = xml.NewEncoder(e.w)
+	e.enc.Indent("", "  ")
+	return e, nil
+}
+
+// Add implements HostConsumer.
+func (e *xmlExporter) Add(h *Host) {
+	if e.err != nil {
+		return
+	}
+	trimmed := *h
+	trimmed.Ports = nil
+	for _, p := range h.Ports {
+		if e.filter.Selected(&p) {
+			trimmed.Ports = append(trimmed.Ports, p)
+		}
+	}
+	if len(trimmed.Ports) == 0 {
+		return
+	}
+	e.hosts++
+	if err := e.enc.EncodeElement(&trimmed, xml.StartElement{Name: xml.Name{Local: "host"}}); err != nil {
+		e.err = err
+		return
+	}
+	e.err = e.enc.Flush()
+}
+
+// Close writes the run statistics, closes the root element and the file.
+// It returns the first error met while writing.
+func (e *xmlExporter) Close() error {
+	if e.err == nil {
+		now := time.Now()
+		if e.hosts > 0 {
+			e.w.WriteString("\n")
+		}
+		fmt.Fprintf(e.w, "<runstats><finished time=\"%d\" timestr=\"%s\" summary=\"re-exported by nmap2csv\" exit=\"success\"/>", now.Unix(), xmlEscape(now.Format(time.ANSIC)))
+		fmt.Fprintf(e.w, "<hosts up=\"%d\" down=\"0\" total=\"%d\"/></runstats>\n</nmaprun>\n", e.hosts, e.hosts)
+		e.err = e.w.Flush()
+	}
+	if err := e.f.Close(); e.err == nil {
+		e.err = err
+	}
+	return e.err
+}
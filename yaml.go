@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ************************************************************************************************
+// yamlLine is a significant line of a YAML document: its indentation, its content without the
+// indentation and comment, and its 1-based number for error messages.
+type yamlLine struct {
+	indent int
+	text   string
+	num    int
+}
+
+// ************************************************************************************************
+// parseYAML parses the YAML subset used by the rules and configuration files: block mappings,
+// block sequences (including sequences of mappings), plain, single- and double-quoted scalars,
+// flow sequences of scalars ([a, b]) and # comments. Mappings are returned as map[string]any,
+// sequences as []any and scalars as strings; an empty value is "". Anchors, tags, multi-line
+// scalars and multiple documents are not supported.
+func parseYAML(data []byte) (any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(raw, "---") && strings.TrimSpace(raw[3:]) == "" {
+			continue
+		}
+		text := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed in indentation", i+1)
+		}
+		text = strings.TrimSpace(yamlStripComment(text))
+		if text == "" {
+			continue
+		}
+		lines = append(lines, yamlLine{indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: text, num: i + 1})
+	}
+	if len(lines) == 0 {
+		return map[string]any{}, nil
+	}
+	p := &yamlParser{lines: lines}
+	v, err := p.parseBlock(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return v, nil
+}
+
+// yamlParser walks the significant lines of a document.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseBlock parses the mapping or sequence whose lines start at the given indentation.
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	l := p.lines[p.pos]
+	if l.indent != indent {
+		return nil, fmt.Errorf("line %d: unexpected indentation", l.num)
+	}
+	if l.text == "-" || strings.HasPrefix(l.text, "- ") {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+// parseSequence parses the "- item" lines at indent. The content of an item is re-read as a line
+// indented to its column, so that "- key: value" starts a mapping continued by the following lines.
+func (p *yamlParser) parseSequence(indent int) ([]any, error) {
+	list := []any{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		l := p.lines[p.pos]
+		if l.text != "-" && !strings.HasPrefix(l.text, "- ") {
+			return nil, fmt.Errorf("line %d: expected a sequence item", l.num)
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			v, err := p.parseChild(indent, false)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			continue
+		}
+		p.lines[p.pos] = yamlLine{indent: indent + len(l.text) - len(rest), text: rest, num: l.num}
+		if _, _, ok := yamlSplitKey(rest); ok {
+			v, err := p.parseMapping(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			continue
+		}
+		v, err := yamlScalar(rest, l.num)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		p.pos++
+	}
+	return list, nil
+}
+
+// parseMapping parses the "key: value" lines at indent.
+func (p *yamlParser) parseMapping(indent int) (map[string]any, error) {
+	m := map[string]any{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		l := p.lines[p.pos]
+		key, rest, ok := yamlSplitKey(l.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", l.num)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", l.num, key)
+		}
+		p.pos++
+		var v any
+		var err error
+		if rest == "" {
+			v, err = p.parseChild(indent, true)
+		} else {
+			v, err = yamlScalar(rest, l.num)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// parseChild parses the block nested under a key or an empty sequence item at indent. A mapping
+// value may also be a sequence at the same indentation as its key. A missing block is "".
+func (p *yamlParser) parseChild(indent int, sameIndentSeq bool) (any, error) {
+	if p.pos >= len(p.lines) {
+		return "", nil
+	}
+	next := p.lines[p.pos]
+	switch {
+	case next.indent > indent:
+		return p.parseBlock(next.indent)
+	case sameIndentSeq && next.indent == indent && (next.text == "-" || strings.HasPrefix(next.text, "- ")):
+		return p.parseSequence(indent)
+	}
+	return "", nil
+}
+
+// yamlSplitKey splits a "key: value" line. The key may be quoted; the colon must be followed by a
+// space or end the line, so that URLs and times in plain scalars are not taken for keys.
+func yamlSplitKey(text string) (key, rest string, ok bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := yamlQuoteEnd(text)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ':' {
+			return "", "", false
+		}
+		k, err := yamlScalar(text[:end+1], 0)
+		if err != nil {
+			return "", "", false
+		}
+		rest = text[end+2:]
+		if rest != "" && rest[0] != ' ' {
+			return "", "", false
+		}
+		return k.(string), strings.TrimSpace(rest), true
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			if i == 0 || strings.ContainsAny(text[:i], "[{\"") {
+				return "", "", false
+			}
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// yamlScalar converts a scalar or flow sequence to its value.
+func yamlScalar(text string, num int) (any, error) {
+	switch text[0] {
+	case '"':
+		if yamlQuoteEnd(text) != len(text)-1 {
+			return nil, fmt.Errorf("line %d: unterminated string", num)
+		}
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid string %s", num, text)
+		}
+		return s, nil
+	case '\'':
+		if yamlQuoteEnd(text) != len(text)-1 {
+			return nil, fmt.Errorf("line %d: unterminated string", num)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case '[':
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("line %d: unterminated flow sequence", num)
+		}
+		list := []any{}
+		for _, item := range yamlSplitFlow(text[1 : len(text)-1]) {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			v, err := yamlScalar(item, num)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	}
+	return text, nil
+}
+
+// yamlQuoteEnd returns the index of the quote closing the string starting text, -1 when none.
+func yamlQuoteEnd(text string) int {
+	q := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case q == '"' && text[i] == '\\':
+			i++
+		case q == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+// yamlSplitFlow splits the items of a flow sequence on the commas outside quotes.
+func yamlSplitFlow(text string) []string {
+	var items []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			if end := yamlQuoteEnd(text[i:]); end > 0 {
+				i += end
+			}
+		case ',':
+			items = append(items, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, text[start:])
+}
+
+// yamlStripComment removes a trailing comment: a # at the start of the line or after a space,
+// outside quoted strings.
+func yamlStripComment(text string) string {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			if i == 0 || text[i-1] == ' ' || text[i-1] == '[' || text[i-1] == ',' {
+				if end := yamlQuoteEnd(text[i:]); end > 0 {
+					i += end
+				}
+			}
+		case '#':
+			if i == 0 || text[i-1] == ' ' {
+				return text[:i]
+			}
+		}
+	}
+	return text
+}